@@ -0,0 +1,238 @@
+package barbara
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os/exec"
+
+	"github.com/therecipe/qt/core"
+	"github.com/therecipe/qt/gui"
+	"github.com/therecipe/qt/widgets"
+)
+
+const (
+	// ActionReload is an internal action that re-renders all bars, restarting all modules.
+	ActionReload = "reload"
+	// ActionPopup is an internal action that opens a module's popup, if it has one.
+	ActionPopup = "popup"
+)
+
+// ModuleActionsConfig holds the configuration for actions that are run in response to input on a
+// module. Any module can be given actions, they're handled outside of the module itself.
+type ModuleActionsConfig struct {
+	OnClick       *ActionConfig `json:"on_click,omitempty"`
+	OnRightClick  *ActionConfig `json:"on_right_click,omitempty"`
+	OnMiddleClick *ActionConfig `json:"on_middle_click,omitempty"`
+	OnScrollUp    *ActionConfig `json:"on_scroll_up,omitempty"`
+	OnScrollDown  *ActionConfig `json:"on_scroll_down,omitempty"`
+	OnHover       *ActionConfig `json:"on_hover,omitempty"`
+}
+
+// empty returns true if no actions are configured.
+func (c ModuleActionsConfig) empty() bool {
+	return c.OnClick == nil &&
+		c.OnRightClick == nil &&
+		c.OnMiddleClick == nil &&
+		c.OnScrollUp == nil &&
+		c.OnScrollDown == nil &&
+		c.OnHover == nil
+}
+
+// ActionConfig holds the configuration for a single action. Only one of Exec or Action should be
+// set. An action may also be configured using just a string, which is treated as Exec.
+type ActionConfig struct {
+	// Exec is a command to run, using the shell.
+	Exec string `json:"exec,omitempty"`
+	// Action is the name of an internal action, e.g. "reload", or "popup".
+	Action string `json:"action,omitempty"`
+}
+
+// UnmarshalJSON allows an ActionConfig to be unmarshalled from either an object, or a string that
+// is a command to run.
+func (c *ActionConfig) UnmarshalJSON(raw []byte) error {
+	var command string
+	if err := json.Unmarshal(raw, &command); err == nil {
+		c.Exec = command
+		return nil
+	}
+
+	// Use a different type to avoid recursing back into this method.
+	type actionConfig ActionConfig
+
+	var config actionConfig
+
+	err := json.Unmarshal(raw, &config)
+	if err != nil {
+		return err
+	}
+
+	if config.Exec != "" && config.Action != "" {
+		return fmt.Errorf("action must have only one of exec or action, got exec %q and action %q", config.Exec, config.Action)
+	}
+
+	switch config.Action {
+	case "", ActionReload, ActionPopup:
+	default:
+		return fmt.Errorf("invalid action %q", config.Action)
+	}
+
+	*c = ActionConfig(config)
+
+	return nil
+}
+
+// PopupModule is a Module that has a popup (e.g. a menu) that can be opened by the "popup" action.
+type PopupModule interface {
+	Module
+
+	// Popup opens this Module's popup.
+	Popup()
+}
+
+// actionModule is a Module that wraps another Module, running configured actions in response to
+// input on whatever the wrapped Module renders.
+type actionModule struct {
+	Module
+
+	app     *Application
+	actions ModuleActionsConfig
+
+	layout *widgets.QHBoxLayout
+	widget *widgets.QWidget
+}
+
+// newActionModule returns a new actionModule instance.
+func newActionModule(module Module, actions ModuleActionsConfig, app *Application) *actionModule {
+	return &actionModule{
+		Module:  module,
+		app:     app,
+		actions: actions,
+	}
+}
+
+// Render renders the wrapped Module, placing it's layout into a widget that can receive input.
+func (m *actionModule) Render() (widgets.QLayout_ITF, error) {
+	inner, err := m.Module.Render()
+	if err != nil {
+		return nil, err
+	}
+
+	// The wrapped Module's layout becomes the top-level layout of our widget, which would normally
+	// give it margins. We want it to look the same as it would if it weren't wrapped.
+	inner.QLayout_PTR().SetContentsMargins(0, 0, 0, 0)
+
+	m.widget = widgets.NewQWidget(nil, 0)
+	m.widget.SetLayout(inner)
+	m.widget.ConnectMousePressEvent(m.onMousePress)
+	m.widget.ConnectWheelEvent(m.onWheel)
+	m.widget.ConnectEnterEvent(m.onEnter)
+
+	m.layout = widgets.NewQHBoxLayout()
+	m.layout.SetContentsMargins(0, 0, 0, 0)
+	m.layout.AddWidget(m.widget, 0, core.Qt__AlignJustify)
+
+	return m.layout, nil
+}
+
+// Destroy destroys the wrapped Module, then frees up resources used to handle actions.
+func (m *actionModule) Destroy() error {
+	err := m.Module.Destroy()
+
+	if m.layout != nil {
+		m.layout.DestroyQHBoxLayout()
+	}
+
+	if m.widget != nil {
+		m.widget.Destroy(true, true)
+	}
+
+	m.layout = nil
+	m.widget = nil
+
+	return err
+}
+
+// onMousePress is the mouse press handler, used to run click actions.
+func (m *actionModule) onMousePress(event *gui.QMouseEvent) {
+	var action *ActionConfig
+	switch event.Button() {
+	case core.Qt__LeftButton:
+		action = m.actions.OnClick
+	case core.Qt__RightButton:
+		action = m.actions.OnRightClick
+	case core.Qt__MiddleButton:
+		action = m.actions.OnMiddleClick
+	}
+
+	if action == nil {
+		m.widget.MousePressEventDefault(event)
+		return
+	}
+
+	m.run(action)
+}
+
+// onWheel is the mouse wheel handler, used to run scroll actions.
+func (m *actionModule) onWheel(event *gui.QWheelEvent) {
+	var action *ActionConfig
+	switch delta := event.AngleDelta().Y(); {
+	case delta > 0:
+		action = m.actions.OnScrollUp
+	case delta < 0:
+		action = m.actions.OnScrollDown
+	}
+
+	if action == nil {
+		m.widget.WheelEventDefault(event)
+		return
+	}
+
+	m.run(action)
+}
+
+// onEnter is the handler for the mouse entering the widget, used to run the hover action.
+func (m *actionModule) onEnter(event *core.QEvent) {
+	if m.actions.OnHover == nil {
+		m.widget.EnterEventDefault(event)
+		return
+	}
+
+	m.run(m.actions.OnHover)
+}
+
+// run runs the given action. Commands are started in the background so they don't block the UI.
+func (m *actionModule) run(action *ActionConfig) {
+	switch action.Action {
+	case ActionReload:
+		m.app.RecreateWindows()
+		return
+	case ActionPopup:
+		if popup, ok := m.Module.(PopupModule); ok {
+			popup.Popup()
+		} else {
+			log.Println("popup action used on a module without a popup")
+		}
+
+		return
+	}
+
+	if action.Exec == "" {
+		return
+	}
+
+	cmd := exec.Command("sh", "-c", action.Exec)
+
+	err := cmd.Start()
+	if err != nil {
+		log.Printf("failed to start action %q: %v\n", action.Exec, err)
+		return
+	}
+
+	go func() {
+		err := cmd.Wait()
+		if err != nil {
+			log.Printf("action %q failed: %v\n", action.Exec, err)
+		}
+	}()
+}
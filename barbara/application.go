@@ -3,7 +3,6 @@ package barbara
 import (
 	"encoding/json"
 	"log"
-	"os"
 
 	"github.com/therecipe/qt/core"
 	"github.com/therecipe/qt/gui"
@@ -21,6 +20,8 @@ var (
 	eventRecreateWindows = core.QEvent__Type(2002)
 	// eventExit is used to signal to the QApplication event loop that it should exit.
 	eventExit = core.QEvent__Type(2003)
+	// eventRunOnMainThread is used to run functions queued by RunOnMainThread.
+	eventRunOnMainThread = core.QEvent__Type(2004)
 )
 
 // Application is a type that sets up the Barbara QApplication, connecting event handlers, and
@@ -28,22 +29,28 @@ var (
 // TODO(elliot): Application is a bit of a rubbish name.
 type Application struct {
 	app     *widgets.QApplication
+	clock   Clock
 	windows []*Window
 
 	moduleFactory   *ModuleFactory
+	services        *ServiceRegistry
 	primaryConfig   WindowConfig
 	secondaryConfig WindowConfig
 }
 
 // NewApplication returns a new instance of Application.
 func NewApplication(
+	app *widgets.QApplication,
+	clock Clock,
 	moduleFactory *ModuleFactory,
+	services *ServiceRegistry,
 	primaryConfig, secondaryConfig WindowConfig,
 ) *Application {
 	application := &Application{
-		// TODO(elliot): Not exactly testable, is it this?
-		app:             widgets.NewQApplication(len(os.Args), os.Args),
+		app:             app,
+		clock:           clock,
 		moduleFactory:   moduleFactory,
+		services:        services,
 		primaryConfig:   primaryConfig,
 		secondaryConfig: secondaryConfig,
 	}
@@ -54,6 +61,16 @@ func NewApplication(
 	return application
 }
 
+// NewQApplication creates the QApplication that Barbara runs in. If platform is not empty, it is
+// used to select the Qt platform plugin (e.g. "offscreen" to render without a display server).
+func NewQApplication(args []string, platform string) *widgets.QApplication {
+	if platform != "" {
+		args = append([]string{args[0], "-platform", platform}, args[1:]...)
+	}
+
+	return widgets.NewQApplication(len(args), args)
+}
+
 // CreateWindows provides a thread-safe mechanism for running the code that handles creating all
 // Barbara bars. Internally it uses Qt's event system to ensure that the event is handled on the
 // main thread.
@@ -104,6 +121,8 @@ func (a *Application) applyEventHandlers() {
 			a.onRecreateWindowsEvent()
 		case eventExit:
 			a.onExit()
+		case eventRunOnMainThread:
+			runMainThreadFns()
 		}
 
 		return true
@@ -131,6 +150,14 @@ func (a *Application) createWindow(primaryScreen, screen *gui.QScreen) *Window {
 		config = a.primaryConfig
 	}
 
+	return a.RenderWindow(config, screen)
+}
+
+// RenderWindow creates a single bar window on the given screen using the given configuration,
+// starting it's modules, and rendering the window. Unlike CreateWindows, this must be called on the
+// main thread, and the returned Window is not tracked by the Application, so the caller is
+// responsible for destroying it.
+func (a *Application) RenderWindow(config WindowConfig, screen Screen) *Window {
 	window := NewWindow(config, screen)
 
 	leftModules := a.createModules(ModuleAlignmentLeft, config.Left, window)
@@ -158,7 +185,9 @@ func (a *Application) createModules(alignment ModuleAlignment, rawConfigs []json
 
 		mctx := ModuleContext{
 			Alignment: alignment,
+			Clock:     a.clock,
 			Config:    rawConfig,
+			Services:  a.services,
 			Window:    window,
 		}
 
@@ -168,6 +197,10 @@ func (a *Application) createModules(alignment ModuleAlignment, rawConfigs []json
 			continue
 		}
 
+		if !moduleConfig.Actions.empty() {
+			module = newActionModule(module, moduleConfig.Actions, a)
+		}
+
 		modules = append(modules, module)
 	}
 
@@ -177,20 +210,26 @@ func (a *Application) createModules(alignment ModuleAlignment, rawConfigs []json
 // onDestroyWindowsEvent is an internal event handler run via Qt when a Qt user event with the type
 // defined in eventDestroyWindows is received.
 func (a *Application) onDestroyWindowsEvent() {
-	for _, window := range a.windows {
-		window.Destroy()
-	}
+	a.destroyWindows()
 }
 
 // onRecreateWindowsEvent is an internal event handler run via Qt when a Qt user event with the type
 // defined in eventRecreateWindows is received.
 func (a *Application) onRecreateWindowsEvent() {
+	a.destroyWindows()
+
+	// Send event to create new windows.
+	a.app.PostEvent(a.app, core.NewQEvent(eventCreateWindows), 0)
+}
+
+// destroyWindows destroys all windows, and forgets about them, so that they're never destroyed more
+// than once. Destroying windows destroys their modules, releasing any services they were using.
+func (a *Application) destroyWindows() {
 	for _, window := range a.windows {
 		window.Destroy()
 	}
 
-	// Send event to create new windows.
-	a.app.PostEvent(a.app, core.NewQEvent(eventCreateWindows), 0)
+	a.windows = nil
 }
 
 // onExit is an internal event handler run via Qt when a Qt user event with the type defined in
@@ -229,5 +268,14 @@ func (a *Application) applyStylesheet() {
 			border: 1px solid #333;
 			border-radius: 3px;
 		}
+
+		.barbara-warning {
+			color: #f0c674;
+		}
+
+		.barbara-error,
+		.barbara-urgent {
+			color: #e06c75;
+		}
 	`)
 }
@@ -0,0 +1,13 @@
+// Package barbaratest provides utilities for testing Barbara's UI without a display server.
+//
+// Bars are rendered using Qt's "offscreen" platform plugin, on virtual screens, and can then be
+// compared against golden images stored in a package's testdata directory. Qt must be driven from
+// the main thread, so packages using barbaratest must hand control of it over in TestMain:
+//
+//	func TestMain(m *testing.M) {
+//	    barbaratest.Main(m)
+//	}
+//
+// Tests can then render windows using a Harness, and compare the result using AssertGolden. Set
+// the BARBARA_UPDATE_GOLDEN environment variable to write new golden images instead of comparing.
+package barbaratest
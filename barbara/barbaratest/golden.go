@@ -0,0 +1,119 @@
+package barbaratest
+
+import (
+	"image"
+	"image/png"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// UpdateGoldenEnv is the name of the environment variable that, when set to any non-empty value,
+// makes AssertGolden write golden images instead of comparing against them.
+const UpdateGoldenEnv = "BARBARA_UPDATE_GOLDEN"
+
+// AssertGolden compares the given image with the golden image with the given name, stored as a PNG
+// in the testdata directory of the package under test. If the images differ, the test is failed,
+// and the actual image is written to a temporary file so that it can be inspected.
+func AssertGolden(t testing.TB, name string, actual image.Image) {
+	t.Helper()
+
+	goldenPath := filepath.Join("testdata", name+".png")
+
+	if os.Getenv(UpdateGoldenEnv) != "" {
+		err := writePNG(goldenPath, actual)
+		if err != nil {
+			t.Fatalf("failed to write golden image %q: %v", goldenPath, err)
+		}
+
+		return
+	}
+
+	expected, err := readPNG(goldenPath)
+	if err != nil {
+		t.Fatalf("failed to read golden image %q (set %s to create it): %v", goldenPath, UpdateGoldenEnv, err)
+	}
+
+	diff := Diff(expected, actual)
+	if diff == 0 {
+		return
+	}
+
+	t.Errorf("rendered image differs from %q by %d pixel(s)", goldenPath, diff)
+
+	actualFile, err := ioutil.TempFile("", "barbaratest-"+name)
+	if err != nil {
+		return
+	}
+
+	defer actualFile.Close()
+
+	if png.Encode(actualFile, actual) == nil {
+		t.Logf("actual image written to %q", actualFile.Name())
+	}
+}
+
+// Diff returns the number of pixels that differ between the two given images. If the images are
+// not the same size, every pixel in the larger of the two is considered different.
+func Diff(a, b image.Image) int {
+	aBounds := a.Bounds()
+	bBounds := b.Bounds()
+
+	if aBounds.Dx() != bBounds.Dx() || aBounds.Dy() != bBounds.Dy() {
+		return maxInt(aBounds.Dx()*aBounds.Dy(), bBounds.Dx()*bBounds.Dy())
+	}
+
+	var diff int
+	for y := 0; y < aBounds.Dy(); y++ {
+		for x := 0; x < aBounds.Dx(); x++ {
+			ar, ag, ab, aa := a.At(aBounds.Min.X+x, aBounds.Min.Y+y).RGBA()
+			br, bg, bb, ba := b.At(bBounds.Min.X+x, bBounds.Min.Y+y).RGBA()
+
+			if ar != br || ag != bg || ab != bb || aa != ba {
+				diff++
+			}
+		}
+	}
+
+	return diff
+}
+
+// readPNG reads a PNG image from the file with the given name.
+func readPNG(fileName string) (image.Image, error) {
+	file, err := os.Open(fileName)
+	if err != nil {
+		return nil, err
+	}
+
+	defer file.Close()
+
+	return png.Decode(file)
+}
+
+// writePNG writes the given image as a PNG to the file with the given name, creating the parent
+// directory if necessary.
+func writePNG(fileName string, img image.Image) error {
+	err := os.MkdirAll(filepath.Dir(fileName), os.ModePerm)
+	if err != nil {
+		return err
+	}
+
+	file, err := os.Create(fileName)
+	if err != nil {
+		return err
+	}
+
+	defer file.Close()
+
+	return png.Encode(file, img)
+}
+
+// maxInt returns the larger of the two given ints.
+func maxInt(a, b int) int {
+	if a > b {
+		return a
+	}
+
+	return b
+}
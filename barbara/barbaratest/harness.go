@@ -0,0 +1,81 @@
+package barbaratest
+
+import (
+	"encoding/json"
+	"fmt"
+	"image"
+	"image/png"
+	"io/ioutil"
+	"os"
+
+	"github.com/seeruk/barbara/barbara"
+	"github.com/therecipe/qt/core"
+)
+
+// Harness renders Barbara bars offscreen, so that they can be inspected in tests.
+type Harness struct {
+	app *barbara.Application
+}
+
+// NewHarness returns a new Harness instance. Modules in rendered bars are created using the given
+// ModuleFactory, and acquire services from the given ServiceRegistry, so tests can register only
+// the modules and services they need, with fake dependencies. Modules are given the given Clock,
+// which should usually be a barbara.FrozenClock to keep output stable.
+func NewHarness(
+	moduleFactory *barbara.ModuleFactory,
+	services *barbara.ServiceRegistry,
+	clock barbara.Clock,
+) *Harness {
+	var app *barbara.Application
+
+	Do(func() {
+		app = barbara.NewApplication(
+			qapp,
+			clock,
+			moduleFactory,
+			services,
+			barbara.WindowConfig{},
+			barbara.WindowConfig{},
+		)
+	})
+
+	return &Harness{
+		app: app,
+	}
+}
+
+// Render creates a bar window using the given configuration on the given screen, renders it, and
+// returns an image of it. The window, and all of it's modules, are destroyed afterwards.
+func (h *Harness) Render(config barbara.WindowConfig, screen barbara.Screen) (image.Image, error) {
+	file, err := ioutil.TempFile("", "barbaratest")
+	if err != nil {
+		return nil, err
+	}
+
+	defer os.Remove(file.Name())
+	defer file.Close()
+
+	var saved bool
+
+	Do(func() {
+		window := h.app.RenderWindow(config, screen)
+		defer window.Destroy()
+
+		// Let Qt lay out and paint the window before grabbing it.
+		core.QCoreApplication_ProcessEvents(core.QEventLoop__AllEvents)
+
+		saved = window.Grab().Save(file.Name(), "PNG", -1)
+	})
+
+	if !saved {
+		return nil, fmt.Errorf("barbaratest: failed to save rendered window to %q", file.Name())
+	}
+
+	return png.Decode(file)
+}
+
+// RenderModule renders a bar on the given screen containing only the module with the given raw
+// configuration, placed on the left of the bar.
+func (h *Harness) RenderModule(rawConfig json.RawMessage, screen barbara.Screen) (image.Image, error) {
+	return h.Render(barbara.WindowConfig{Left: []json.RawMessage{rawConfig}}, screen)
+}
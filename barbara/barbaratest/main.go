@@ -0,0 +1,58 @@
+package barbaratest
+
+import (
+	"os"
+	"runtime"
+	"testing"
+
+	"github.com/seeruk/barbara/barbara"
+	"github.com/therecipe/qt/widgets"
+)
+
+var (
+	// mainCh is used to send functions to be run on the main thread.
+	mainCh = make(chan func())
+	// qapp is the offscreen QApplication shared by all tests in a package.
+	qapp *widgets.QApplication
+)
+
+func init() {
+	// Qt must only be used from the main thread. Locking here, during initialisation, ensures that
+	// the main goroutine stays on the main thread, which is where Main will run.
+	runtime.LockOSThread()
+}
+
+// Main creates an offscreen QApplication, then runs the tests in m in the background while the
+// main thread handles functions passed to Do. It exits the process once all tests have run, so it
+// should be called from TestMain.
+func Main(m *testing.M) {
+	qapp = barbara.NewQApplication(os.Args[:1], "offscreen")
+
+	codeCh := make(chan int, 1)
+
+	go func() {
+		codeCh <- m.Run()
+	}()
+
+	for {
+		select {
+		case fn := <-mainCh:
+			fn()
+		case code := <-codeCh:
+			os.Exit(code)
+		}
+	}
+}
+
+// Do runs the given function on the main thread, blocking until it has returned. Main must be used
+// to run the tests calling Do, otherwise Do will block forever.
+func Do(fn func()) {
+	done := make(chan struct{})
+
+	mainCh <- func() {
+		defer close(done)
+		fn()
+	}
+
+	<-done
+}
@@ -0,0 +1,26 @@
+package barbara
+
+import "time"
+
+// Clock provides the current time. Modules should use the Clock in their ModuleContext instead of
+// calling time.Now directly, so that time can be frozen when rendering reproducible output.
+type Clock interface {
+	// Now returns the current time, according to this Clock.
+	Now() time.Time
+}
+
+// SystemClock is a Clock that returns the real current time.
+type SystemClock struct{}
+
+// Now returns the current local time.
+func (c SystemClock) Now() time.Time {
+	return time.Now()
+}
+
+// FrozenClock is a Clock that always returns the same time.
+type FrozenClock time.Time
+
+// Now returns the time that this FrozenClock was frozen at.
+func (c FrozenClock) Now() time.Time {
+	return time.Time(c)
+}
@@ -0,0 +1,41 @@
+package barbara
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// Duration is a time.Duration that can be unmarshalled from configuration. It may be given as a
+// Go duration string (e.g. "1m30s"), or as a number of seconds.
+type Duration time.Duration
+
+// Duration returns this Duration as a time.Duration.
+func (d Duration) Duration() time.Duration {
+	return time.Duration(d)
+}
+
+// UnmarshalJSON allows a JSON string or number to be unmarshalled into a Duration.
+func (d *Duration) UnmarshalJSON(raw []byte) error {
+	var seconds float64
+	if err := json.Unmarshal(raw, &seconds); err == nil {
+		*d = Duration(seconds * float64(time.Second))
+		return nil
+	}
+
+	var str string
+
+	err := json.Unmarshal(raw, &str)
+	if err != nil {
+		return err
+	}
+
+	duration, err := time.ParseDuration(str)
+	if err != nil {
+		return fmt.Errorf("invalid duration %q: %v", str, err)
+	}
+
+	*d = Duration(duration)
+
+	return nil
+}
@@ -30,6 +30,8 @@ type ModuleConfig struct {
 	// Kind specifies the kind of module that this configuration is for, allowing the correct Module
 	// to be constructed based on the kind.
 	Kind string `json:"kind"`
+	// Actions specifies actions to run in response to input on the Module (e.g. clicks).
+	Actions ModuleActionsConfig `json:"actions"`
 }
 
 // ModuleConstructorFunc is a function used to construct new Module instances.
@@ -40,8 +42,13 @@ type ModuleConstructorFunc func(mctx ModuleContext) (Module, error)
 type ModuleContext struct {
 	// Alignment is the intended alignment of the Module on a Barbara bar (i.e. left, right).
 	Alignment ModuleAlignment
+	// Clock is the Clock the Module should use to get the current time.
+	Clock Clock
 	// Config is the raw configuration bytes. The Module will have to decode it's configuration.
 	Config json.RawMessage
+	// Services is the registry that the Module should acquire shared services from. Any service
+	// acquired must be released when the Module is destroyed.
+	Services *ServiceRegistry
 	// Window is the Barbara bar's window representation, allowing the module to get info about the
 	// window itself, such as it's position on the screen it's on.
 	Window *Window
@@ -0,0 +1,45 @@
+package barbara
+
+import (
+	"github.com/therecipe/qt/core"
+)
+
+// Screen represents a display that a Barbara bar can be placed on. It is satisfied by *gui.QScreen,
+// but also allows bars to be rendered for screens that don't really exist (e.g. in tests).
+type Screen interface {
+	// Name returns the name of the screen, e.g. the name of the output, like "DP-1".
+	Name() string
+	// Geometry returns the position and size of the screen in the virtual desktop.
+	Geometry() *core.QRect
+}
+
+// VirtualScreen is a Screen that isn't backed by a real display. It's useful for rendering bars
+// offscreen, where the geometry of the screen can't be taken from Qt.
+type VirtualScreen struct {
+	name   string
+	x      int
+	y      int
+	width  int
+	height int
+}
+
+// NewVirtualScreen returns a new VirtualScreen instance.
+func NewVirtualScreen(name string, x, y, width, height int) *VirtualScreen {
+	return &VirtualScreen{
+		name:   name,
+		x:      x,
+		y:      y,
+		width:  width,
+		height: height,
+	}
+}
+
+// Name returns the name of this VirtualScreen.
+func (s *VirtualScreen) Name() string {
+	return s.name
+}
+
+// Geometry returns the position and size of this VirtualScreen.
+func (s *VirtualScreen) Geometry() *core.QRect {
+	return core.NewQRect4(s.x, s.y, s.width, s.height)
+}
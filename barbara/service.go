@@ -0,0 +1,140 @@
+package barbara
+
+import (
+	"fmt"
+	"sync"
+)
+
+// Service is a background process that can be shared by modules, e.g. something that watches for
+// changes in battery information. Services are managed by a ServiceRegistry.
+type Service interface {
+	// Start begins the Service's background processes.
+	Start() error
+	// Stop stops all of the Service's background processes. A stopped Service is never restarted.
+	Stop() error
+}
+
+// ServiceConstructorFunc is a function used to construct new Service instances. The name identifies
+// which instance of a kind of Service is being constructed, e.g. the name of a battery.
+type ServiceConstructorFunc func(name string) (Service, error)
+
+// ServiceRegistry is a type that ServiceConstructorFunc functions can be registered in, allowing
+// modules to share Service instances. Services are reference-counted; a Service is started when
+// it's first acquired, and stopped when the last module using it releases it.
+type ServiceRegistry struct {
+	sync.Mutex
+
+	scfs     map[string]ServiceConstructorFunc
+	services map[serviceKey]*serviceEntry
+}
+
+// serviceKey identifies a single Service instance in a ServiceRegistry.
+type serviceKey struct {
+	kind string
+	name string
+}
+
+// serviceEntry is a running Service, and the number of modules using it. While the Service is
+// being constructed and started, ready is open; once it's closed, either service or err is set.
+type serviceEntry struct {
+	service Service
+	refs    int
+	ready   chan struct{}
+	err     error
+}
+
+// NewServiceRegistry returns a new ServiceRegistry instance.
+func NewServiceRegistry() *ServiceRegistry {
+	return &ServiceRegistry{
+		scfs:     make(map[string]ServiceConstructorFunc),
+		services: make(map[serviceKey]*serviceEntry),
+	}
+}
+
+// RegisterConstructor registers the given ServiceConstructorFunc with the given kind in this
+// ServiceRegistry, allowing Service instances of that kind to be acquired later.
+func (r *ServiceRegistry) RegisterConstructor(kind string, scf ServiceConstructorFunc) {
+	r.Lock()
+	defer r.Unlock()
+
+	r.scfs[kind] = scf
+}
+
+// Acquire returns the running Service of the given kind with the given name, constructing and
+// starting it if it's not already running. Every successful call to Acquire must be paired with a
+// call to Release once the Service is no longer needed. This method is safe for concurrent use.
+// Services are started without holding up other Services being acquired or released; if the same
+// Service is acquired while it's starting, Acquire waits for it to start.
+func (r *ServiceRegistry) Acquire(kind, name string) (Service, error) {
+	r.Lock()
+
+	key := serviceKey{kind: kind, name: name}
+	if entry, ok := r.services[key]; ok {
+		entry.refs++
+		r.Unlock()
+
+		<-entry.ready
+		return entry.service, entry.err
+	}
+
+	scf, ok := r.scfs[kind]
+	if !ok {
+		r.Unlock()
+		return nil, fmt.Errorf("unknown service kind %q", kind)
+	}
+
+	entry := &serviceEntry{
+		refs:  1,
+		ready: make(chan struct{}),
+	}
+
+	r.services[key] = entry
+	r.Unlock()
+
+	service, err := scf(name)
+	if err != nil {
+		err = fmt.Errorf("failed to create %q service %q: %v", kind, name, err)
+	} else if err = service.Start(); err != nil {
+		err = fmt.Errorf("failed to start %q service %q: %v", kind, name, err)
+	}
+
+	r.Lock()
+	defer r.Unlock()
+
+	if err != nil {
+		// Anything waiting for the Service gets the same error, and the next call to Acquire will
+		// try again.
+		entry.err = err
+		delete(r.services, key)
+	} else {
+		entry.service = service
+	}
+
+	close(entry.ready)
+
+	return entry.service, entry.err
+}
+
+// Release signals that a Service previously returned by Acquire is no longer needed. When the last
+// user of a Service releases it, the Service is stopped, and the next call to Acquire will create a
+// new instance. This method is safe for concurrent use.
+func (r *ServiceRegistry) Release(kind, name string) error {
+	r.Lock()
+	defer r.Unlock()
+
+	key := serviceKey{kind: kind, name: name}
+
+	entry, ok := r.services[key]
+	if !ok {
+		return fmt.Errorf("%q service %q released, but was not acquired", kind, name)
+	}
+
+	entry.refs--
+	if entry.refs > 0 {
+		return nil
+	}
+
+	delete(r.services, key)
+
+	return entry.service.Stop()
+}
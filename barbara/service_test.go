@@ -0,0 +1,299 @@
+package barbara
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeService is a Service that records how often it's started and stopped. If startCh is set,
+// Start blocks until it's closed.
+type fakeService struct {
+	sync.Mutex
+
+	name     string
+	startCh  chan struct{}
+	startErr error
+	started  int
+	stopped  int
+}
+
+func (s *fakeService) Start() error {
+	if s.startCh != nil {
+		<-s.startCh
+	}
+
+	s.Lock()
+	defer s.Unlock()
+
+	s.started++
+
+	return s.startErr
+}
+
+func (s *fakeService) Stop() error {
+	s.Lock()
+	defer s.Unlock()
+
+	s.stopped++
+
+	return nil
+}
+
+// counts returns how many times the fakeService has been started and stopped.
+func (s *fakeService) counts() (int, int) {
+	s.Lock()
+	defer s.Unlock()
+
+	return s.started, s.stopped
+}
+
+// fakeServiceConstructor returns a ServiceConstructorFunc that creates fakeServices using the given
+// function, and a function that returns every fakeService created so far.
+func fakeServiceConstructor(create func(name string) (*fakeService, error)) (ServiceConstructorFunc, func() []*fakeService) {
+	var mu sync.Mutex
+	var services []*fakeService
+
+	scf := func(name string) (Service, error) {
+		service, err := create(name)
+		if err != nil {
+			return nil, err
+		}
+
+		mu.Lock()
+		defer mu.Unlock()
+
+		services = append(services, service)
+
+		return service, nil
+	}
+
+	created := func() []*fakeService {
+		mu.Lock()
+		defer mu.Unlock()
+
+		return append([]*fakeService(nil), services...)
+	}
+
+	return scf, created
+}
+
+func TestServiceRegistry_Acquire(t *testing.T) {
+	scf, created := fakeServiceConstructor(func(name string) (*fakeService, error) {
+		return &fakeService{name: name}, nil
+	})
+
+	registry := NewServiceRegistry()
+	registry.RegisterConstructor("fake", scf)
+
+	first, err := registry.Acquire("fake", "BAT0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	second, err := registry.Acquire("fake", "BAT0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if first != second {
+		t.Error("expected the same Service to be shared")
+	}
+
+	other, err := registry.Acquire("fake", "BAT1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if other == first {
+		t.Error("expected a different Service for a different name")
+	}
+
+	if len(created()) != 2 {
+		t.Fatalf("expected 2 Services to be created, got %d", len(created()))
+	}
+
+	service := first.(*fakeService)
+
+	// The Service keeps running until the last module using it releases it.
+	err = registry.Release("fake", "BAT0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if started, stopped := service.counts(); started != 1 || stopped != 0 {
+		t.Errorf("expected the Service to be started once, and still running, got %d starts, and %d stops", started, stopped)
+	}
+
+	err = registry.Release("fake", "BAT0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, stopped := service.counts(); stopped != 1 {
+		t.Errorf("expected the Service to be stopped once, got %d stops", stopped)
+	}
+
+	err = registry.Release("fake", "BAT0")
+	if err == nil {
+		t.Error("expected releasing a Service that isn't acquired to fail")
+	}
+
+	if _, stopped := other.(*fakeService).counts(); stopped != 0 {
+		t.Error("expected other Services to keep running")
+	}
+}
+
+func TestServiceRegistry_Acquire_AfterRelease(t *testing.T) {
+	scf, created := fakeServiceConstructor(func(name string) (*fakeService, error) {
+		return &fakeService{name: name}, nil
+	})
+
+	registry := NewServiceRegistry()
+	registry.RegisterConstructor("fake", scf)
+
+	// Recreating windows releases every Service used by the old windows' modules, then acquires
+	// them again for the new ones.
+	for i := 0; i < 2; i++ {
+		_, err := registry.Acquire("fake", "BAT0")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		err = registry.Release("fake", "BAT0")
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	services := created()
+	if len(services) != 2 {
+		t.Fatalf("expected a new Service after the last was released, got %d Services", len(services))
+	}
+
+	for i, service := range services {
+		if started, stopped := service.counts(); started != 1 || stopped != 1 {
+			t.Errorf("expected Service %d to be started and stopped once, got %d starts, and %d stops", i, started, stopped)
+		}
+	}
+}
+
+func TestServiceRegistry_Acquire_Errors(t *testing.T) {
+	var fail bool
+
+	scf, created := fakeServiceConstructor(func(name string) (*fakeService, error) {
+		if name == "broken" {
+			return nil, errors.New("no such battery")
+		}
+
+		service := &fakeService{name: name}
+		if fail {
+			service.startErr = errors.New("failed to watch")
+		}
+
+		return service, nil
+	})
+
+	registry := NewServiceRegistry()
+	registry.RegisterConstructor("fake", scf)
+
+	tests := []struct {
+		name string
+		kind string
+		fail bool
+	}{
+		{"BAT0", "unknown", false},
+		{"broken", "fake", false},
+		{"BAT0", "fake", true},
+	}
+
+	for _, test := range tests {
+		fail = test.fail
+
+		service, err := registry.Acquire(test.kind, test.name)
+		if err == nil {
+			t.Errorf("expected acquiring %q service %q to fail", test.kind, test.name)
+		}
+
+		if service != nil {
+			t.Errorf("expected no Service, got %v", service)
+		}
+	}
+
+	// A Service that failed to start isn't kept, so it's tried again next time.
+	fail = false
+
+	_, err := registry.Acquire("fake", "BAT0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(created()) != 2 {
+		t.Errorf("expected the Service to be created again, got %d Services", len(created()))
+	}
+}
+
+func TestServiceRegistry_Acquire_Starting(t *testing.T) {
+	startCh := make(chan struct{})
+
+	scf, created := fakeServiceConstructor(func(name string) (*fakeService, error) {
+		service := &fakeService{name: name}
+		if name == "slow" {
+			service.startCh = startCh
+		}
+
+		return service, nil
+	})
+
+	registry := NewServiceRegistry()
+	registry.RegisterConstructor("fake", scf)
+
+	acquired := make(chan Service, 2)
+
+	for i := 0; i < 2; i++ {
+		go func() {
+			service, err := registry.Acquire("fake", "slow")
+			if err != nil {
+				t.Error(err)
+			}
+
+			acquired <- service
+		}()
+	}
+
+	// Other Services can be acquired while one is starting.
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+
+		_, err := registry.Acquire("fake", "fast")
+		if err != nil {
+			t.Error(err)
+		}
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected acquiring a Service not to wait for another to start")
+	}
+
+	select {
+	case <-acquired:
+		t.Fatal("expected Acquire to wait for the Service to start")
+	default:
+	}
+
+	close(startCh)
+
+	first, second := <-acquired, <-acquired
+	if first == nil || first != second {
+		t.Error("expected the same Service to be shared")
+	}
+
+	if len(created()) != 2 {
+		t.Errorf("expected the starting Service to only be created once, got %d Services", len(created()))
+	}
+}
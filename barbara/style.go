@@ -0,0 +1,28 @@
+package barbara
+
+import (
+	"strings"
+
+	"github.com/therecipe/qt/core"
+	"github.com/therecipe/qt/widgets"
+)
+
+const (
+	// ClassError is the style class used for widgets that are showing an error.
+	ClassError = "barbara-error"
+	// ClassWarning is the style class used for widgets that want to draw attention to themselves.
+	ClassWarning = "barbara-warning"
+	// ClassUrgent is the style class used for widgets that need attention urgently.
+	ClassUrgent = "barbara-urgent"
+)
+
+// SetClass replaces the style classes of the given widget with the given classes, so that they can
+// be targeted in the stylesheet (e.g. using ".barbara-error"). Unlike setting the "class" property
+// directly, this also re-applies the stylesheet, so it can be used after a widget has been shown.
+func SetClass(widget widgets.QWidget_ITF, classes ...string) {
+	w := widget.QWidget_PTR()
+	w.SetProperty("class", core.NewQVariant14(strings.Join(classes, " ")))
+
+	w.Style().Unpolish(w)
+	w.Style().Polish(w)
+}
@@ -0,0 +1,39 @@
+package barbara
+
+import (
+	"sync"
+
+	"github.com/therecipe/qt/core"
+)
+
+var (
+	// mainThreadFns is the queue of functions waiting to be run on the main thread.
+	mainThreadFns []func()
+	// mainThreadFnsMu protects mainThreadFns.
+	mainThreadFnsMu sync.Mutex
+)
+
+// RunOnMainThread queues the given function to be run on the main thread by Qt's event loop, and
+// returns immediately. Modules must use this to create or destroy widgets from background
+// processes, as Qt doesn't allow that anywhere but the main thread. This function is safe for
+// concurrent use, but does nothing until an Application has been created.
+func RunOnMainThread(fn func()) {
+	mainThreadFnsMu.Lock()
+	mainThreadFns = append(mainThreadFns, fn)
+	mainThreadFnsMu.Unlock()
+
+	app := core.QCoreApplication_Instance()
+	app.PostEvent(app, core.NewQEvent(eventRunOnMainThread), 0)
+}
+
+// runMainThreadFns runs all of the queued functions. It must only be called on the main thread.
+func runMainThreadFns() {
+	mainThreadFnsMu.Lock()
+	fns := mainThreadFns
+	mainThreadFns = nil
+	mainThreadFnsMu.Unlock()
+
+	for _, fn := range fns {
+		fn()
+	}
+}
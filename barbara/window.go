@@ -18,7 +18,7 @@ type Window struct {
 	config  WindowConfig
 	modules []Module
 
-	screen       *gui.QScreen
+	screen       Screen
 	leftLayout   *widgets.QHBoxLayout
 	rightLayout  *widgets.QHBoxLayout
 	windowLayout *widgets.QHBoxLayout
@@ -26,7 +26,7 @@ type Window struct {
 }
 
 // NewWindow creates a new instance of Window.
-func NewWindow(config WindowConfig, screen *gui.QScreen) *Window {
+func NewWindow(config WindowConfig, screen Screen) *Window {
 	// Construct the window with all static parameters set.
 	window := widgets.NewQMainWindow(nil, core.Qt__Window)
 	window.SetWindowTitle("Barbara Bar")
@@ -60,12 +60,14 @@ func (w *Window) createLayout(parent widgets.QWidget_ITF) {
 	w.windowLayout.AddLayout(w.rightLayout, 1)
 }
 
-// updateDimensions sets the height of the window based on the window's contents.
+// updateDimensions sets the height of the window based on the window's contents, and the width of
+// the window based on the width of the screen it's on.
 func (w *Window) updateDimensions() {
 	if w.windowLayout == nil {
 		return
 	}
 
+	w.window.SetFixedWidth(w.screen.Geometry().Width())
 	w.window.SetFixedHeight(w.windowLayout.SizeHint().Height())
 }
 
@@ -169,11 +171,17 @@ func (w *Window) Position() WindowPosition {
 	return w.config.Position
 }
 
-// Screen returns the QScreen that this Window is placed on.
-func (w *Window) Screen() *gui.QScreen {
+// Screen returns the Screen that this Window is placed on.
+func (w *Window) Screen() Screen {
 	return w.screen
 }
 
+// Grab renders this Window's current contents into a pixmap, e.g. so that it can be saved as an
+// image. Like all other rendering, this must be called on the main thread.
+func (w *Window) Grab() *gui.QPixmap {
+	return w.window.Grab(core.NewQRect4(0, 0, -1, -1))
+}
+
 // WindowConfig holds the configuration for a single on-screen bar.
 type WindowConfig struct {
 	Position WindowPosition    `json:"position"`
@@ -13,6 +13,16 @@ import (
 )
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "screenshot" {
+		screenshot(os.Args[2:])
+		return
+	}
+
+	run()
+}
+
+// run starts Barbara, blocking until it's shut down.
+func run() {
 	log.Println("Started...")
 
 	config, err := internal.LoadConfig()
@@ -24,7 +34,7 @@ func main() {
 	signals := make(chan os.Signal, 1)
 	signal.Notify(signals, os.Interrupt, os.Kill)
 
-	resolver := internal.NewResolver(config)
+	resolver := internal.NewResolver(config, internal.Options{})
 
 	watcher := resolver.ResolveX11RandrEventWatcher()
 	watcher.Watch(context.Background())
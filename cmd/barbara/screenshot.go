@@ -0,0 +1,88 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"github.com/seeruk/barbara/barbara"
+	"github.com/seeruk/barbara/internal"
+	"github.com/therecipe/qt/core"
+)
+
+// screenshot renders a bar offscreen using the given command-line arguments, and saves an image of
+// it. It doesn't need a display server, and it doesn't connect to D-Bus or listen for kernel
+// events. Modules still start their usual background processes (e.g. polling battery information),
+// but they're stopped once the image has been saved.
+func screenshot(args []string) {
+	flags := flag.NewFlagSet("screenshot", flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: barbara screenshot [options]")
+		fmt.Fprintln(os.Stderr)
+		fmt.Fprintln(os.Stderr, "Renders a bar offscreen, and saves an image of it.")
+		fmt.Fprintln(os.Stderr)
+		flags.PrintDefaults()
+	}
+
+	configFile := flags.String("config", "", "configuration file to render (default is the usual configuration file)")
+	output := flags.String("output", "barbara.png", "file to save the image to, the format is taken from the extension")
+	geometry := flags.String("geometry", "1920x1080", "geometry of the screen the bar is rendered on, as WIDTHxHEIGHT")
+	secondary := flags.Bool("secondary", false, "render the secondary bar, instead of the primary bar")
+	frozenTime := flags.String("time", "", "freeze time at the given RFC 3339 time, e.g. 2018-06-01T09:30:00Z")
+	sysfsRoot := flags.String("sysfs", "", "read system information (e.g. batteries) from the given directory, instead of /sys")
+
+	flags.Parse(args)
+
+	var width, height int
+	_, err := fmt.Sscanf(*geometry, "%dx%d", &width, &height)
+	if err != nil || width <= 0 || height <= 0 {
+		log.Fatalf("invalid geometry %q, expected WIDTHxHEIGHT", *geometry)
+	}
+
+	options := internal.Options{
+		Headless:  true,
+		SysfsRoot: *sysfsRoot,
+	}
+
+	if *frozenTime != "" {
+		t, err := time.Parse(time.RFC3339, *frozenTime)
+		if err != nil {
+			log.Fatalf("invalid time %q: %v", *frozenTime, err)
+		}
+
+		options.Clock = barbara.FrozenClock(t)
+	}
+
+	var config internal.Config
+	if *configFile != "" {
+		config, err = internal.LoadConfigFile(*configFile)
+	} else {
+		config, err = internal.LoadConfig()
+	}
+
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	windowConfig := config.Primary
+	if *secondary {
+		windowConfig = config.Secondary
+	}
+
+	resolver := internal.NewResolver(config, options)
+	app := resolver.ResolveApplication()
+
+	window := app.RenderWindow(windowConfig, barbara.NewVirtualScreen("screenshot", 0, 0, width, height))
+	defer window.Destroy()
+
+	// Let Qt lay out and paint the window before grabbing it.
+	core.QCoreApplication_ProcessEvents(core.QEventLoop__AllEvents)
+
+	if !window.Grab().Save(*output, "", -1) {
+		log.Fatalf("failed to save screenshot to %q", *output)
+	}
+
+	log.Printf("Saved screenshot to %q\n", *output)
+}
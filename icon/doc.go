@@ -0,0 +1,8 @@
+// Package icon finds icons by name in freedesktop.org icon themes, implementing the XDG Icon Theme
+// Specification. Themes are read from their index.theme files, and icons are looked up in the
+// configured theme, then in the themes it inherits from, then in the hicolor theme, which every
+// icon theme is meant to fall back on.
+//
+// Lookup does the searching, and only deals with file names, while Loader wraps a Lookup to load
+// icons for use in Qt widgets. Lookups are cached, as searching themes means a lot of stat calls.
+package icon
@@ -0,0 +1,69 @@
+package icon
+
+import (
+	"math"
+
+	"github.com/therecipe/qt/gui"
+)
+
+// Loader loads icons for use in Qt widgets, finding them using a Lookup. Loaded icons are cached,
+// so asking for the same icon repeatedly (e.g. every time a module updates) is cheap. Loader must
+// only be used on the main thread.
+type Loader struct {
+	lookup           *Lookup
+	devicePixelRatio float64
+	icons            map[lookupKey]*gui.QIcon
+}
+
+// NewLoader returns a new Loader instance, that loads icons for screens with the given device pixel
+// ratio, e.g. the QApplication's, which is the highest ratio of any screen. Icons are looked up at
+// the ratio rounded up to a whole scale, as themes only provide icons for whole scales, and
+// scaling icons down looks better than scaling them up.
+func NewLoader(lookup *Lookup, devicePixelRatio float64) *Loader {
+	if devicePixelRatio < 1 {
+		devicePixelRatio = 1
+	}
+
+	return &Loader{
+		lookup:           lookup,
+		devicePixelRatio: devicePixelRatio,
+		icons:            make(map[lookupKey]*gui.QIcon),
+	}
+}
+
+// Icon returns the first of the icons with the given names that can be found, best matching the
+// given size. If none of the icons can be found, an empty icon is returned, which draws nothing.
+func (l *Loader) Icon(size int, names ...string) *gui.QIcon {
+	scale := int(math.Ceil(l.devicePixelRatio))
+
+	for _, name := range names {
+		key := lookupKey{name: name, size: size, scale: scale}
+		if icon, ok := l.icons[key]; ok {
+			return icon
+		}
+
+		fileName, ok := l.lookup.Find(name, size, scale)
+		if !ok {
+			continue
+		}
+
+		icon := gui.NewQIcon5(fileName)
+		l.icons[key] = icon
+
+		return icon
+	}
+
+	return gui.NewQIcon()
+}
+
+// Pixmap returns the first of the icons with the given names that can be found, as a pixmap of the
+// given size, e.g. for showing in a label. The pixmap has the Loader's device pixel ratio, so it's
+// drawn at the given size, but isn't blurry on high DPI screens.
+func (l *Loader) Pixmap(size int, names ...string) *gui.QPixmap {
+	deviceSize := int(math.Ceil(float64(size) * l.devicePixelRatio))
+
+	pixmap := l.Icon(size, names...).Pixmap2(deviceSize, deviceSize, gui.QIcon__Normal, gui.QIcon__On)
+	pixmap.SetDevicePixelRatio(l.devicePixelRatio)
+
+	return pixmap
+}
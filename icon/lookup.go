@@ -0,0 +1,254 @@
+package icon
+
+import (
+	"math"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+const (
+	// FallbackTheme is the theme that every icon theme falls back on.
+	FallbackTheme = "hicolor"
+	// indexFileName is the name of the file describing an icon theme.
+	indexFileName = "index.theme"
+)
+
+// extensions are the icon file extensions supported by the spec, in order of preference.
+var extensions = []string{".png", ".svg", ".xpm"}
+
+// lookupKey identifies a lookup in a Lookup's cache.
+type lookupKey struct {
+	name  string
+	size  int
+	scale int
+}
+
+// Lookup finds icons in an icon theme. Themes are loaded as they're needed, and the results of
+// lookups are cached, including icons that weren't found. This type is safe for concurrent use.
+type Lookup struct {
+	sync.Mutex
+
+	theme    string
+	baseDirs []string
+
+	themes map[string]*Theme
+	cache  map[lookupKey]string
+}
+
+// NewLookup returns a new Lookup instance, that finds icons in the theme with the given name, in
+// the given base directories, in order of preference. If baseDirs is nil, DefaultBaseDirs is used.
+func NewLookup(theme string, baseDirs []string) *Lookup {
+	if baseDirs == nil {
+		baseDirs = DefaultBaseDirs()
+	}
+
+	return &Lookup{
+		theme:    theme,
+		baseDirs: baseDirs,
+		themes:   make(map[string]*Theme),
+		cache:    make(map[lookupKey]string),
+	}
+}
+
+// DefaultBaseDirs returns the directories that icon themes are found in, according to the spec;
+// $HOME/.icons, the icons directory in $XDG_DATA_HOME and each of $XDG_DATA_DIRS, and finally
+// /usr/share/pixmaps.
+func DefaultBaseDirs() []string {
+	var dirs []string
+
+	if home := os.Getenv("HOME"); home != "" {
+		dirs = append(dirs, filepath.Join(home, ".icons"))
+	}
+
+	dataHome := os.Getenv("XDG_DATA_HOME")
+	if dataHome == "" && os.Getenv("HOME") != "" {
+		dataHome = filepath.Join(os.Getenv("HOME"), ".local", "share")
+	}
+
+	if dataHome != "" {
+		dirs = append(dirs, filepath.Join(dataHome, "icons"))
+	}
+
+	dataDirs := os.Getenv("XDG_DATA_DIRS")
+	if dataDirs == "" {
+		dataDirs = "/usr/local/share:/usr/share"
+	}
+
+	for _, dir := range filepath.SplitList(dataDirs) {
+		dirs = append(dirs, filepath.Join(dir, "icons"))
+	}
+
+	return append(dirs, "/usr/share/pixmaps")
+}
+
+// Find returns the file name of the icon with the given name that best matches the given size and
+// scale. If the icon can't be found, false is returned. The name may also be an absolute path to
+// an icon file, which is returned as-is if it exists.
+func (l *Lookup) Find(name string, size, scale int) (string, bool) {
+	if filepath.IsAbs(name) {
+		return name, exists(name)
+	}
+
+	l.Lock()
+	defer l.Unlock()
+
+	key := lookupKey{name: name, size: size, scale: scale}
+	if fileName, ok := l.cache[key]; ok {
+		return fileName, fileName != ""
+	}
+
+	fileName := l.findIcon(name, size, scale)
+	l.cache[key] = fileName
+
+	return fileName, fileName != ""
+}
+
+// FindFirst returns the file name of the first of the given icons that can be found, e.g. so that
+// more specific icons can be tried before more generic ones.
+func (l *Lookup) FindFirst(names []string, size, scale int) (string, bool) {
+	for _, name := range names {
+		if fileName, ok := l.Find(name, size, scale); ok {
+			return fileName, true
+		}
+	}
+
+	return "", false
+}
+
+// findIcon implements the spec's FindIcon algorithm.
+func (l *Lookup) findIcon(name string, size, scale int) string {
+	visited := make(map[string]bool)
+
+	if fileName := l.findIconHelper(name, size, scale, l.theme, visited); fileName != "" {
+		return fileName
+	}
+
+	if fileName := l.findIconHelper(name, size, scale, FallbackTheme, visited); fileName != "" {
+		return fileName
+	}
+
+	return l.lookupFallbackIcon(name)
+}
+
+// findIconHelper looks for the given icon in the given theme, then in the themes it inherits from.
+// Themes are only searched once, as themes may (indirectly) inherit from each other.
+func (l *Lookup) findIconHelper(name string, size, scale int, themeName string, visited map[string]bool) string {
+	if visited[themeName] {
+		return ""
+	}
+
+	visited[themeName] = true
+
+	theme := l.loadTheme(themeName)
+	if theme == nil {
+		return ""
+	}
+
+	if fileName := l.lookupIcon(name, size, scale, theme); fileName != "" {
+		return fileName
+	}
+
+	for _, parent := range theme.Inherits {
+		if fileName := l.findIconHelper(name, size, scale, parent, visited); fileName != "" {
+			return fileName
+		}
+	}
+
+	return ""
+}
+
+// lookupIcon looks for the given icon in the given theme only, preferring icons that match the
+// given size exactly, then icons closest to the given size.
+func (l *Lookup) lookupIcon(name string, size, scale int, theme *Theme) string {
+	for _, dir := range theme.Directories {
+		if !dir.MatchesSize(size, scale) {
+			continue
+		}
+
+		if fileName := l.findInDirectory(name, theme, dir); fileName != "" {
+			return fileName
+		}
+	}
+
+	var closest string
+
+	minDistance := math.MaxInt32
+	for _, dir := range theme.Directories {
+		distance := dir.SizeDistance(size, scale)
+		if distance >= minDistance {
+			continue
+		}
+
+		if fileName := l.findInDirectory(name, theme, dir); fileName != "" {
+			closest = fileName
+			minDistance = distance
+		}
+	}
+
+	return closest
+}
+
+// findInDirectory returns the file name of the given icon in the given theme directory, checking
+// each base directory, or an empty string if it's not there.
+func (l *Lookup) findInDirectory(name string, theme *Theme, dir Directory) string {
+	for _, baseDir := range l.baseDirs {
+		for _, ext := range extensions {
+			fileName := filepath.Join(baseDir, theme.Name, dir.Path, name+ext)
+			if exists(fileName) {
+				return fileName
+			}
+		}
+	}
+
+	return ""
+}
+
+// lookupFallbackIcon looks for the given icon directly in the base directories, which is where
+// icons that aren't in any theme are found (e.g. in /usr/share/pixmaps).
+func (l *Lookup) lookupFallbackIcon(name string) string {
+	for _, baseDir := range l.baseDirs {
+		for _, ext := range extensions {
+			fileName := filepath.Join(baseDir, name+ext)
+			if exists(fileName) {
+				return fileName
+			}
+		}
+	}
+
+	return ""
+}
+
+// loadTheme returns the theme with the given name, reading it's index.theme from the first base
+// directory that has one. If the theme can't be found, nil is returned. Themes are only read once.
+func (l *Lookup) loadTheme(name string) *Theme {
+	if theme, ok := l.themes[name]; ok {
+		return theme
+	}
+
+	var theme *Theme
+
+	for _, baseDir := range l.baseDirs {
+		file, err := os.Open(filepath.Join(baseDir, name, indexFileName))
+		if err != nil {
+			continue
+		}
+
+		theme, err = ParseTheme(name, file)
+		file.Close()
+
+		if err == nil {
+			break
+		}
+	}
+
+	l.themes[name] = theme
+
+	return theme
+}
+
+// exists returns true if a regular file with the given name exists.
+func exists(fileName string) bool {
+	info, err := os.Stat(fileName)
+	return err == nil && !info.IsDir()
+}
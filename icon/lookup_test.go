@@ -0,0 +1,113 @@
+package icon
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+// testBaseDirs are the base directories of the fake icon themes in testdata. The custom theme
+// inherits from the parent theme, which inherits from the custom theme again, and both fall back on
+// the hicolor theme. Icons that aren't in any theme are in the pixmaps directory.
+var testBaseDirs = []string{"testdata/icons", "testdata/pixmaps"}
+
+func TestLookup_Find(t *testing.T) {
+	lookup := NewLookup("custom", testBaseDirs)
+
+	absolute, err := filepath.Abs("testdata/pixmaps/pixmap.png")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		icon     string
+		size     int
+		scale    int
+		expected string
+	}{
+		{"fixed", "app", 16, 1, "testdata/icons/custom/16x16/apps/app.png"},
+		{"scaled", "app", 16, 2, "testdata/icons/custom/16x16@2/apps/app.png"},
+		{"threshold", "app", 30, 1, "testdata/icons/custom/32x32/apps/app.png"},
+		{"scalable", "app", 128, 1, "testdata/icons/custom/scalable/apps/app.svg"},
+		{"closest", "app", 40, 1, "testdata/icons/custom/32x32/apps/app.png"},
+		{"closest other size", "small", 48, 1, "testdata/icons/custom/16x16/apps/small.png"},
+		{"preferred extension", "vector", 16, 1, "testdata/icons/custom/16x16/apps/vector.png"},
+		{"inherited", "inherited", 16, 1, "testdata/icons/parent/16x16/apps/inherited.png"},
+		{"overridden", "shared", 16, 1, "testdata/icons/custom/16x16/apps/shared.png"},
+		{"hicolor", "fallback", 16, 1, "testdata/icons/hicolor/48x48/apps/fallback.png"},
+		{"pixmap", "pixmap", 16, 1, "testdata/pixmaps/pixmap.png"},
+		{"absolute", absolute, 16, 1, absolute},
+		{"missing", "missing", 16, 1, ""},
+		{"missing absolute", "/missing.png", 16, 1, ""},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			fileName, ok := lookup.Find(test.icon, test.size, test.scale)
+			if ok != (test.expected != "") {
+				t.Fatalf("expected found to be %v, got %v", test.expected != "", ok)
+			}
+
+			if ok && fileName != test.expected {
+				t.Errorf("expected %q, got %q", test.expected, fileName)
+			}
+		})
+	}
+}
+
+func TestLookup_Find_Theme(t *testing.T) {
+	tests := []struct {
+		name     string
+		theme    string
+		icon     string
+		expected string
+	}{
+		// The parent theme inherits from the custom theme, so it finds the custom theme's icons.
+		{"inherited", "parent", "app", "testdata/icons/custom/16x16/apps/app.png"},
+		{"overridden", "parent", "shared", "testdata/icons/parent/16x16/apps/shared.png"},
+		{"hicolor", "hicolor", "shared", "testdata/icons/hicolor/48x48/apps/shared.png"},
+		{"missing theme", "missing", "fallback", "testdata/icons/hicolor/48x48/apps/fallback.png"},
+		{"missing theme pixmap", "missing", "pixmap", "testdata/pixmaps/pixmap.png"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			fileName, ok := NewLookup(test.theme, testBaseDirs).Find(test.icon, 16, 1)
+			if !ok {
+				t.Fatal("expected the icon to be found")
+			}
+
+			if fileName != test.expected {
+				t.Errorf("expected %q, got %q", test.expected, fileName)
+			}
+		})
+	}
+}
+
+func TestLookup_FindFirst(t *testing.T) {
+	lookup := NewLookup("custom", testBaseDirs)
+
+	tests := []struct {
+		name     string
+		icons    []string
+		expected string
+	}{
+		{"first", []string{"small", "app"}, "testdata/icons/custom/16x16/apps/small.png"},
+		{"second", []string{"missing", "app"}, "testdata/icons/custom/16x16/apps/app.png"},
+		{"none", []string{"missing", "also-missing"}, ""},
+		{"empty", nil, ""},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			fileName, ok := lookup.FindFirst(test.icons, 16, 1)
+			if ok != (test.expected != "") {
+				t.Fatalf("expected found to be %v, got %v", test.expected != "", ok)
+			}
+
+			if fileName != test.expected {
+				t.Errorf("expected %q, got %q", test.expected, fileName)
+			}
+		})
+	}
+}
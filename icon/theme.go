@@ -0,0 +1,179 @@
+package icon
+
+import (
+	"bufio"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// Directory types, as found in the Type key of a theme directory's section in index.theme.
+const (
+	DirectoryTypeFixed     = "Fixed"
+	DirectoryTypeScalable  = "Scalable"
+	DirectoryTypeThreshold = "Threshold"
+)
+
+// Theme is an icon theme, as described by it's index.theme file.
+type Theme struct {
+	Name        string
+	Inherits    []string
+	Directories []Directory
+}
+
+// Directory is a directory in an icon theme, containing icons of a certain size.
+type Directory struct {
+	// Path is the path of the directory, relative to the theme's directory.
+	Path      string
+	Size      int
+	Scale     int
+	MinSize   int
+	MaxSize   int
+	Threshold int
+	Type      string
+}
+
+// MatchesSize returns true if icons in this Directory are suitable for the given size and scale
+// without being resized.
+func (d Directory) MatchesSize(size, scale int) bool {
+	if d.Scale != scale {
+		return false
+	}
+
+	switch d.Type {
+	case DirectoryTypeFixed:
+		return d.Size == size
+	case DirectoryTypeScalable:
+		return d.MinSize <= size && size <= d.MaxSize
+	default:
+		return d.Size-d.Threshold <= size && size <= d.Size+d.Threshold
+	}
+}
+
+// SizeDistance returns how far icons in this Directory are from the given size and scale, used to
+// find the closest icon when no icon matches exactly.
+func (d Directory) SizeDistance(size, scale int) int {
+	scaled := size * scale
+
+	switch d.Type {
+	case DirectoryTypeFixed:
+		return abs(d.Size*d.Scale - scaled)
+	case DirectoryTypeScalable:
+		return outside(scaled, d.MinSize*d.Scale, d.MaxSize*d.Scale)
+	default:
+		return outside(scaled, (d.Size-d.Threshold)*d.Scale, (d.Size+d.Threshold)*d.Scale)
+	}
+}
+
+// ParseTheme parses an index.theme file, read from the given reader, returning the theme it
+// describes. The theme is given the name of it's directory, as that's what inheriting themes
+// refer to it by, rather than the Name in it's index.theme.
+func ParseTheme(name string, reader io.Reader) (*Theme, error) {
+	sections := make(map[string]map[string]string)
+
+	var section map[string]string
+
+	scanner := bufio.NewScanner(reader)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+
+		switch {
+		case line == "" || strings.HasPrefix(line, "#"):
+			continue
+		case strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]"):
+			section = make(map[string]string)
+			sections[line[1:len(line)-1]] = section
+		case section != nil:
+			parts := strings.SplitN(line, "=", 2)
+			if len(parts) == 2 {
+				section[strings.TrimSpace(parts[0])] = strings.TrimSpace(parts[1])
+			}
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	theme := &Theme{
+		Name: name,
+	}
+
+	header := sections["Icon Theme"]
+
+	theme.Inherits = splitList(header["Inherits"])
+
+	// ScaledDirectories was added later in the spec, and is kept separate so that older
+	// implementations don't see directories they don't understand.
+	paths := append(splitList(header["Directories"]), splitList(header["ScaledDirectories"])...)
+
+	for _, path := range paths {
+		keys, ok := sections[path]
+		if !ok {
+			// The spec says directories without a section should be ignored.
+			continue
+		}
+
+		dir := Directory{
+			Path:      path,
+			Size:      atoi(keys["Size"], 0),
+			Scale:     atoi(keys["Scale"], 1),
+			Threshold: atoi(keys["Threshold"], 2),
+			Type:      keys["Type"],
+		}
+
+		dir.MinSize = atoi(keys["MinSize"], dir.Size)
+		dir.MaxSize = atoi(keys["MaxSize"], dir.Size)
+
+		if dir.Type == "" {
+			dir.Type = DirectoryTypeThreshold
+		}
+
+		theme.Directories = append(theme.Directories, dir)
+	}
+
+	return theme, nil
+}
+
+// splitList splits a comma-separated list from an index.theme file.
+func splitList(value string) []string {
+	var list []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+
+	return list
+}
+
+// atoi parses the given integer, returning def if it's missing or invalid.
+func atoi(value string, def int) int {
+	i, err := strconv.Atoi(value)
+	if err != nil {
+		return def
+	}
+
+	return i
+}
+
+// abs returns the absolute value of the given integer.
+func abs(i int) int {
+	if i < 0 {
+		return -i
+	}
+
+	return i
+}
+
+// outside returns how far the given value is outside of the given range, or 0 if it's inside.
+func outside(value, min, max int) int {
+	switch {
+	case value < min:
+		return min - value
+	case value > max:
+		return value - max
+	}
+
+	return 0
+}
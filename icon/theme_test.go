@@ -0,0 +1,211 @@
+package icon
+
+import (
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseTheme(t *testing.T) {
+	tests := []struct {
+		name     string
+		index    string
+		expected *Theme
+	}{
+		{
+			name:     "empty",
+			index:    "",
+			expected: &Theme{Name: "test"},
+		},
+		{
+			name: "directories",
+			index: strings.Join([]string{
+				"# Comments and blank lines are ignored.",
+				"",
+				"[Icon Theme]",
+				"Name = Something Else ",
+				"Inherits= parent , ,grandparent",
+				"Directories=fixed,threshold,scalable",
+				"",
+				"[fixed]",
+				"Size=16",
+				"Type=Fixed",
+				"",
+				"[threshold]",
+				"Size=32",
+				"Threshold=4",
+				"Unknown=ignored",
+				"",
+				"[scalable]",
+				"Size=64",
+				"MinSize=16",
+				"MaxSize=256",
+				"Type=Scalable",
+			}, "\n"),
+			expected: &Theme{
+				Name:     "test",
+				Inherits: []string{"parent", "grandparent"},
+				Directories: []Directory{
+					{Path: "fixed", Size: 16, Scale: 1, MinSize: 16, MaxSize: 16, Threshold: 2, Type: DirectoryTypeFixed},
+					{Path: "threshold", Size: 32, Scale: 1, MinSize: 32, MaxSize: 32, Threshold: 4, Type: DirectoryTypeThreshold},
+					{Path: "scalable", Size: 64, Scale: 1, MinSize: 16, MaxSize: 256, Threshold: 2, Type: DirectoryTypeScalable},
+				},
+			},
+		},
+		{
+			name: "scaled directories",
+			index: strings.Join([]string{
+				"[Icon Theme]",
+				"Directories=16x16",
+				"ScaledDirectories=16x16@2",
+				"[16x16]",
+				"Size=16",
+				"[16x16@2]",
+				"Size=16",
+				"Scale=2",
+			}, "\n"),
+			expected: &Theme{
+				Name: "test",
+				Directories: []Directory{
+					{Path: "16x16", Size: 16, Scale: 1, MinSize: 16, MaxSize: 16, Threshold: 2, Type: DirectoryTypeThreshold},
+					{Path: "16x16@2", Size: 16, Scale: 2, MinSize: 16, MaxSize: 16, Threshold: 2, Type: DirectoryTypeThreshold},
+				},
+			},
+		},
+		{
+			name: "invalid values",
+			index: strings.Join([]string{
+				"[Icon Theme]",
+				"Directories=missing,invalid",
+				"[invalid]",
+				"Size=large",
+				"Scale=",
+				"Threshold=x",
+			}, "\n"),
+			expected: &Theme{
+				Name: "test",
+				Directories: []Directory{
+					{Path: "invalid", Size: 0, Scale: 1, MinSize: 0, MaxSize: 0, Threshold: 2, Type: DirectoryTypeThreshold},
+				},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			theme, err := ParseTheme("test", strings.NewReader(test.index))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !reflect.DeepEqual(theme, test.expected) {
+				t.Errorf("expected %+v, got %+v", test.expected, theme)
+			}
+		})
+	}
+}
+
+func TestParseTheme_File(t *testing.T) {
+	file, err := os.Open("testdata/icons/custom/index.theme")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer file.Close()
+
+	theme, err := ParseTheme("custom", file)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(theme.Inherits, []string{"parent"}) {
+		t.Errorf("expected to inherit from %v, got %v", []string{"parent"}, theme.Inherits)
+	}
+
+	// The missing directory has no section, so it's ignored, and scaled directories come last.
+	var paths []string
+	for _, dir := range theme.Directories {
+		paths = append(paths, dir.Path)
+	}
+
+	expected := []string{"16x16/apps", "32x32/apps", "48x48/apps", "scalable/apps", "16x16@2/apps"}
+	if !reflect.DeepEqual(paths, expected) {
+		t.Errorf("expected directories %v, got %v", expected, paths)
+	}
+}
+
+func TestDirectory_MatchesSize(t *testing.T) {
+	fixed := Directory{Size: 16, Scale: 1, Type: DirectoryTypeFixed}
+	fixed2 := Directory{Size: 16, Scale: 2, Type: DirectoryTypeFixed}
+	scalable := Directory{Size: 64, Scale: 1, MinSize: 32, MaxSize: 256, Type: DirectoryTypeScalable}
+	threshold := Directory{Size: 32, Scale: 1, Threshold: 2, Type: DirectoryTypeThreshold}
+
+	tests := []struct {
+		name     string
+		dir      Directory
+		size     int
+		scale    int
+		expected bool
+	}{
+		{"fixed", fixed, 16, 1, true},
+		{"fixed smaller", fixed, 15, 1, false},
+		{"fixed larger", fixed, 17, 1, false},
+		{"fixed other scale", fixed, 16, 2, false},
+		{"fixed scaled", fixed2, 16, 2, true},
+		{"fixed scaled at scale 1", fixed2, 16, 1, false},
+		{"scalable min", scalable, 32, 1, true},
+		{"scalable max", scalable, 256, 1, true},
+		{"scalable below min", scalable, 31, 1, false},
+		{"scalable above max", scalable, 257, 1, false},
+		{"threshold", threshold, 32, 1, true},
+		{"threshold lower", threshold, 30, 1, true},
+		{"threshold upper", threshold, 34, 1, true},
+		{"threshold below", threshold, 29, 1, false},
+		{"threshold above", threshold, 35, 1, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if matches := test.dir.MatchesSize(test.size, test.scale); matches != test.expected {
+				t.Errorf("expected %v, got %v", test.expected, matches)
+			}
+		})
+	}
+}
+
+func TestDirectory_SizeDistance(t *testing.T) {
+	fixed := Directory{Size: 16, Scale: 1, Type: DirectoryTypeFixed}
+	fixed2 := Directory{Size: 16, Scale: 2, Type: DirectoryTypeFixed}
+	scalable := Directory{Size: 64, Scale: 1, MinSize: 32, MaxSize: 256, Type: DirectoryTypeScalable}
+	threshold := Directory{Size: 32, Scale: 1, Threshold: 2, Type: DirectoryTypeThreshold}
+
+	tests := []struct {
+		name     string
+		dir      Directory
+		size     int
+		scale    int
+		expected int
+	}{
+		{"fixed", fixed, 16, 1, 0},
+		{"fixed smaller", fixed, 12, 1, 4},
+		{"fixed larger", fixed, 24, 1, 8},
+		// Distances are in device pixels, so a 16px icon at scale 2 is as good as a 32px icon.
+		{"fixed scaled", fixed2, 32, 1, 0},
+		{"fixed at scale 2", fixed, 16, 2, 16},
+		{"scalable inside", scalable, 128, 1, 0},
+		{"scalable below", scalable, 16, 1, 16},
+		{"scalable above", scalable, 300, 1, 44},
+		{"threshold inside", threshold, 33, 1, 0},
+		{"threshold below", threshold, 24, 1, 6},
+		{"threshold above", threshold, 40, 1, 6},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if distance := test.dir.SizeDistance(test.size, test.scale); distance != test.expected {
+				t.Errorf("expected %d, got %d", test.expected, distance)
+			}
+		})
+	}
+}
@@ -2,6 +2,7 @@ package internal
 
 import (
 	"fmt"
+	"io"
 	"io/ioutil"
 	"os"
 	"os/user"
@@ -14,6 +15,9 @@ import (
 type Config struct {
 	Primary   barbara.WindowConfig `json:"primary"`
 	Secondary barbara.WindowConfig `json:"secondary"`
+	// IconTheme is the name of the icon theme that modules find icons in, e.g. "Papirus". If it's
+	// not set, the desktop's icon theme is used.
+	IconTheme string `json:"icon_theme"`
 }
 
 // LoadConfig returns Barbara's configuration. It will either default to a directory under the
@@ -41,7 +45,29 @@ func LoadConfig() (Config, error) {
 		return config, err
 	}
 
-	confBytes, err := ioutil.ReadAll(confFile)
+	defer confFile.Close()
+
+	return readConfig(confFile)
+}
+
+// LoadConfigFile returns Barbara's configuration, read from the file with the given name. Unlike
+// LoadConfig, the file must already exist.
+func LoadConfigFile(fileName string) (Config, error) {
+	confFile, err := os.Open(fileName)
+	if err != nil {
+		return Config{}, err
+	}
+
+	defer confFile.Close()
+
+	return readConfig(confFile)
+}
+
+// readConfig reads YAML configuration from the given reader.
+func readConfig(reader io.Reader) (Config, error) {
+	var config Config
+
+	confBytes, err := ioutil.ReadAll(reader)
 	if err != nil {
 		return config, err
 	}
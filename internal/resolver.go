@@ -2,35 +2,71 @@ package internal
 
 import (
 	"fmt"
+	"log"
+	"os"
+	"path/filepath"
 
 	"github.com/BurntSushi/xgb"
 	"github.com/BurntSushi/xgb/randr"
 	"github.com/BurntSushi/xgb/xproto"
+	"github.com/godbus/dbus"
 	"github.com/seeruk/barbara/barbara"
 	"github.com/seeruk/barbara/event"
+	"github.com/seeruk/barbara/icon"
 	"github.com/seeruk/barbara/modules/battery"
 	"github.com/seeruk/barbara/modules/clock"
+	"github.com/seeruk/barbara/modules/exec"
+	"github.com/seeruk/barbara/modules/i3bar"
+	"github.com/seeruk/barbara/modules/i3blocks"
 	"github.com/seeruk/barbara/modules/menu"
+	"github.com/seeruk/barbara/modules/peripherals"
+	"github.com/seeruk/barbara/modules/plugin"
+	"github.com/seeruk/barbara/modules/script"
+	"github.com/seeruk/barbara/notify"
 	"github.com/seeruk/barbara/wm/x11"
+	"github.com/therecipe/qt/gui"
+	"github.com/therecipe/qt/widgets"
 )
 
+// Options holds runtime options that don't come from Barbara's configuration file, e.g. options
+// that are passed on the command-line.
+type Options struct {
+	// Headless runs Barbara without a display server, using Qt's offscreen platform plugin. No X
+	// connection or D-Bus connections are made when running headless, and kernel uevents aren't
+	// listened to.
+	Headless bool
+	// Clock is the clock given to modules. If nil, the system clock is used.
+	Clock barbara.Clock
+	// SysfsRoot is where system information (e.g. battery information) is read from. If empty,
+	// the real sysfs mount is used.
+	SysfsRoot string
+}
+
 // Resolver is a type that resolves Barbara's runtime dependencies. It handles wiring up types in
 // the application, using plain Go.
 type Resolver struct {
-	config Config
+	config  Config
+	options Options
 
 	// Core services.
 	app        *barbara.Application
 	dispatcher *event.Dispatcher
+	icons      *icon.Loader
+	notifier   *notify.Notifier
+	qapp       *widgets.QApplication
+	services   *barbara.ServiceRegistry
+	sessionBus *dbus.Conn
+	systemBus  *dbus.Conn
 	xc         *xgb.Conn
-
-	// Module services.
-	batteryInfoNotifierFactory *battery.InfoNotifierFactory
 }
 
 // NewResolver returns a new instance of Resolver.
-func NewResolver(config Config) *Resolver {
-	resolver := &Resolver{config: config}
+func NewResolver(config Config, options Options) *Resolver {
+	resolver := &Resolver{
+		config:  config,
+		options: options,
+	}
+
 	resolver.resolveEager()
 
 	return resolver
@@ -40,7 +76,10 @@ func NewResolver(config Config) *Resolver {
 func (r *Resolver) ResolveApplication() *barbara.Application {
 	if r.app == nil {
 		r.app = barbara.NewApplication(
+			r.ResolveQApplication(),
+			r.ResolveClock(),
 			r.ResolveModuleFactory(),
+			r.ResolveServiceRegistry(),
 			r.config.Primary,
 			r.config.Secondary,
 		)
@@ -55,14 +94,13 @@ func (r *Resolver) ResolveApplication() *barbara.Application {
 	return r.app
 }
 
-// ResolveBatteryInfoNotifierFactory resolves the application's battery InfoNotifierFactory
-// instance.
-func (r *Resolver) ResolveBatteryInfoNotifierFactory() *battery.InfoNotifierFactory {
-	if r.batteryInfoNotifierFactory == nil {
-		r.batteryInfoNotifierFactory = battery.NewInfoNotifierFactory()
+// ResolveClock resolves the clock given to modules.
+func (r *Resolver) ResolveClock() barbara.Clock {
+	if r.options.Clock == nil {
+		return barbara.SystemClock{}
 	}
 
-	return r.batteryInfoNotifierFactory
+	return r.options.Clock
 }
 
 // ResolveEventDispatcher resolves the application's event dispatcher.
@@ -74,6 +112,29 @@ func (r *Resolver) ResolveEventDispatcher() *event.Dispatcher {
 	return r.dispatcher
 }
 
+// ResolveIconLoader resolves the icon loader that modules use to find icons in the configured icon
+// theme, or the desktop's icon theme if one isn't configured.
+func (r *Resolver) ResolveIconLoader() *icon.Loader {
+	if r.icons == nil {
+		// Qt works out the desktop's icon theme, and the screens' device pixel ratio, but only once
+		// the QApplication exists.
+		qapp := r.ResolveQApplication()
+
+		theme := r.config.IconTheme
+		if theme == "" {
+			theme = gui.QIcon_ThemeName()
+		}
+
+		if theme == "" {
+			theme = icon.FallbackTheme
+		}
+
+		r.icons = icon.NewLoader(icon.NewLookup(theme, nil), qapp.DevicePixelRatio())
+	}
+
+	return r.icons
+}
+
 // ResolveModuleFactory resolves a new barbara.ModuleFactory instance, with available modules
 // already registered with it.
 func (r *Resolver) ResolveModuleFactory() *barbara.ModuleFactory {
@@ -81,13 +142,129 @@ func (r *Resolver) ResolveModuleFactory() *barbara.ModuleFactory {
 	// needs to be taken over an approach similar to sql.DB drivers. Modules may have dependencies
 	// on shared services (e.g. some kind of API client, for example).
 	mbf := barbara.NewModuleFactory()
-	mbf.RegisterConstructor("battery", battery.NewModule(r.ResolveBatteryInfoNotifierFactory()))
+	mbf.RegisterConstructor("battery", battery.NewModuleConstructor(r.ResolveIconLoader()))
 	mbf.RegisterConstructor("clock", clock.NewModule)
-	mbf.RegisterConstructor("menu", menu.NewModule)
+	mbf.RegisterConstructor("exec", exec.NewModule)
+	mbf.RegisterConstructor("i3bar", i3bar.NewModule)
+	mbf.RegisterConstructor("i3blocks", i3blocks.NewModule)
+	mbf.RegisterConstructor("menu", menu.NewModuleConstructor(r.ResolveIconLoader()))
+	mbf.RegisterConstructor("peripherals", peripherals.NewModuleConstructor(r.ResolveIconLoader()))
+	mbf.RegisterConstructor("plugin", plugin.NewModuleConstructor(r.ResolveIconLoader()))
+	mbf.RegisterConstructor("script", script.NewModuleConstructor(r.ResolveIconLoader()))
 
 	return mbf
 }
 
+// ResolveNotifier resolves the desktop notification sender. If there's no session bus connection,
+// or Barbara is running headless, nil is returned, and modules shouldn't send notifications.
+func (r *Resolver) ResolveNotifier() *notify.Notifier {
+	if r.notifier == nil && !r.options.Headless {
+		sessionBus := r.ResolveSessionBus()
+		if sessionBus == nil {
+			return nil
+		}
+
+		r.notifier = notify.NewNotifier(sessionBus)
+	}
+
+	return r.notifier
+}
+
+// ResolveQApplication resolves the QApplication that Barbara runs in.
+func (r *Resolver) ResolveQApplication() *widgets.QApplication {
+	if r.qapp == nil {
+		var platform string
+		if r.options.Headless {
+			platform = "offscreen"
+		}
+
+		r.qapp = barbara.NewQApplication(os.Args, platform)
+	}
+
+	return r.qapp
+}
+
+// ResolveServiceRegistry resolves the application's barbara.ServiceRegistry, with available services
+// already registered with it. Modules acquire shared services from it as they're rendered.
+func (r *Resolver) ResolveServiceRegistry() *barbara.ServiceRegistry {
+	if r.services == nil {
+		sysfsRoot := r.options.SysfsRoot
+		if sysfsRoot == "" {
+			sysfsRoot = battery.DefaultSysfsRoot
+		}
+
+		// System and peripheral batteries are read the same way, they just discover different
+		// power supplies. Running headless, the kernel's uevents aren't listened to, and battery
+		// information is polled instead.
+		reader := battery.NewInfoReader(sysfsRoot)
+
+		var listener battery.UeventListener
+		if !r.options.Headless {
+			listener = battery.NewNetlinkUeventListener()
+		}
+
+		sysfsBackend := battery.NewSysfsBackend(reader, listener)
+		peripheralsBackend := peripherals.NewBackend(reader, listener)
+
+		// History is only recorded for real batteries, running headless shouldn't leave files in
+		// the user's state directory. Each backend records to it's own files, as the same battery
+		// may be shown using both, and a history file can only be written to by one History.
+		var historyDir, upowerHistoryDir string
+		if !r.options.Headless {
+			historyDir = battery.DefaultHistoryDir()
+			upowerHistoryDir = filepath.Join(historyDir, battery.BackendUPower)
+		}
+
+		r.services = barbara.NewServiceRegistry()
+
+		r.services.RegisterConstructor(battery.ServiceKind, battery.NewInfoNotifierConstructor(sysfsBackend, historyDir))
+		r.services.RegisterConstructor(battery.UPowerServiceKind, battery.NewInfoNotifierConstructor(
+			battery.NewUPowerBackend(r.ResolveSystemBus()),
+			upowerHistoryDir,
+		))
+		r.services.RegisterConstructor(battery.AlerterServiceKind, battery.NewAlerterConstructor(
+			r.ResolveNotifier(),
+			r.ResolveSystemBus(),
+		))
+		r.services.RegisterConstructor(peripherals.ServiceKind, battery.NewInfoNotifierConstructor(peripheralsBackend, ""))
+		r.services.RegisterConstructor(peripherals.AlerterServiceKind, peripherals.NewAlerterConstructor(r.ResolveNotifier()))
+	}
+
+	return r.services
+}
+
+// ResolveSessionBus resolves the shared D-Bus session bus connection. Not having a session bus
+// isn't fatal, so if the connection fails, or Barbara is running headless, nil is returned.
+func (r *Resolver) ResolveSessionBus() *dbus.Conn {
+	if r.sessionBus == nil && !r.options.Headless {
+		conn, err := dbus.SessionBus()
+		if err != nil {
+			log.Printf("failed to connect to session bus: %v\n", err)
+			return nil
+		}
+
+		r.sessionBus = conn
+	}
+
+	return r.sessionBus
+}
+
+// ResolveSystemBus resolves the shared D-Bus system bus connection. Not having a system bus isn't
+// fatal, so if the connection fails, or Barbara is running headless, nil is returned.
+func (r *Resolver) ResolveSystemBus() *dbus.Conn {
+	if r.systemBus == nil && !r.options.Headless {
+		conn, err := dbus.SystemBus()
+		if err != nil {
+			log.Printf("failed to connect to system bus: %v\n", err)
+			return nil
+		}
+
+		r.systemBus = conn
+	}
+
+	return r.systemBus
+}
+
 // ResolveXConnection resolves the application's X connection, setting up extensions, etc.
 func (r *Resolver) ResolveXConnection() *xgb.Conn {
 	if r.xc == nil {
@@ -133,5 +310,8 @@ func (r *Resolver) ResolveX11RandrEventWatcher() *x11.RandrEventWatcher {
 // listeners in the event dispatcher.
 func (r *Resolver) resolveEager() {
 	r.ResolveApplication()
-	r.ResolveXConnection()
+
+	if !r.options.Headless {
+		r.ResolveXConnection()
+	}
 }
@@ -0,0 +1,460 @@
+package battery
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os/exec"
+	"sync"
+	"time"
+
+	"github.com/godbus/dbus"
+	"github.com/seeruk/barbara/barbara"
+	"github.com/seeruk/barbara/notify"
+)
+
+// AlerterServiceKind is the kind of the battery Alerter service in the service registry. Alerters
+// are named after the power supply they alert about.
+const AlerterServiceKind = "battery-alerter"
+
+const (
+	// actionCancel is the key of the notification action used to cancel the critical action.
+	actionCancel = "cancel"
+	// notificationIcon is the icon shown on battery notifications.
+	notificationIcon = "battery-caution"
+)
+
+// Level is how urgently a battery needs to be charged.
+type Level int
+
+const (
+	// LevelNormal means that the battery doesn't need to be charged.
+	LevelNormal Level = iota
+	// LevelWarning means that the battery is low.
+	LevelWarning
+	// LevelCritical means that the battery is critically low.
+	LevelCritical
+)
+
+// alert is a change in level that an Alerter has been asked to handle.
+type alert struct {
+	level  Level
+	info   Info
+	config Config
+}
+
+// alerterState is the state of the alerts for a power supply. It outlives each Alerter, as the
+// Alerter is stopped and created again whenever the bars are (e.g. when a screen is added), and the
+// user shouldn't be notified again, or have a critical action they cancelled started again.
+type alerterState struct {
+	sync.Mutex
+
+	// level is the level that was last checked.
+	level Level
+	// id is the ID of the notification that's currently shown, or 0 if there isn't one.
+	id uint32
+	// action is the critical action that's waiting to be run at actionAt, or nil if there isn't one.
+	// It's cleared once it's been run, or cancelled.
+	action   *CriticalActionConfig
+	actionAt time.Time
+}
+
+// Alerter is a service that sends desktop notifications when a battery becomes low, and runs the
+// critical action when a battery becomes critical. An Alerter is shared by every module showing the
+// same power supply, so that notifications aren't sent once per bar. Notifications are only sent
+// when the level changes, not every time the battery information is updated.
+type Alerter struct {
+	sync.Mutex
+
+	notifier  *notify.Notifier
+	systemBus *dbus.Conn
+
+	ctx     context.Context
+	cfn     context.CancelFunc
+	alertCh chan alert
+
+	config     Config
+	configured bool
+	state      *alerterState
+}
+
+// NewAlerter returns a new Alerter instance. If notifier is nil, no notifications are sent, and if
+// systemBus is nil, logind critical actions can't be used.
+func NewAlerter(notifier *notify.Notifier, systemBus *dbus.Conn) *Alerter {
+	return newAlerter(notifier, systemBus, &alerterState{})
+}
+
+// newAlerter returns a new Alerter instance that carries on from the given state.
+func newAlerter(notifier *notify.Notifier, systemBus *dbus.Conn, state *alerterState) *Alerter {
+	return &Alerter{
+		notifier:  notifier,
+		systemBus: systemBus,
+		alertCh:   make(chan alert, 8),
+		state:     state,
+	}
+}
+
+// Start begins handling level changes in the background. If a critical action was waiting to be
+// run when the last Alerter for the same power supply was stopped, it's resumed.
+func (a *Alerter) Start() error {
+	a.ctx, a.cfn = context.WithCancel(context.Background())
+
+	go a.handleAlerts(a.ctx)
+
+	return nil
+}
+
+// Configure sets the thresholds, and critical action that this Alerter uses. Every module showing
+// the same power supply shares an Alerter, so only the first configuration is used, otherwise the
+// level would change depending on which module checked it last. This method is safe for concurrent
+// use.
+func (a *Alerter) Configure(config Config) {
+	a.Lock()
+	defer a.Unlock()
+
+	if !a.configured {
+		a.config = config
+		a.configured = true
+		return
+	}
+
+	if !sameAlerts(a.config, config) {
+		log.Println("battery: modules showing the same power supply have different alert " +
+			"thresholds or critical actions, using the first module's")
+	}
+}
+
+// Stop stops handling level changes, cancelling any pending critical action.
+func (a *Alerter) Stop() error {
+	if a.cfn != nil {
+		a.cfn()
+	}
+
+	return nil
+}
+
+// Check compares the level of the given battery with the last level that was checked, and if it
+// has changed, sends a notification (or closes the last one), and starts or cancels the critical
+// action in the background. The level is found using the thresholds given to Configure, if it
+// hasn't been called, nothing is checked. This method doesn't block, and is safe for concurrent
+// use.
+func (a *Alerter) Check(info Info) {
+	a.Lock()
+	defer a.Unlock()
+
+	if !a.configured {
+		return
+	}
+
+	level := a.config.level(info)
+
+	a.state.Lock()
+	defer a.state.Unlock()
+
+	if level == a.state.level {
+		return
+	}
+
+	a.state.level = level
+
+	select {
+	case a.alertCh <- alert{level: level, info: info, config: a.config}:
+	default:
+		log.Println("battery: dropped alert, too many pending alerts")
+	}
+}
+
+// handleAlerts handles level changes one at a time, until the given context is cancelled.
+func (a *Alerter) handleAlerts(ctx context.Context) {
+	var cancelAction context.CancelFunc
+
+	a.state.Lock()
+	id, action, actionAt := a.state.id, a.state.action, a.state.actionAt
+	a.state.Unlock()
+
+	if action != nil {
+		var actionCtx context.Context
+
+		// The notification has already been shown, so any cancel action that was invoked while
+		// there was no Alerter has been missed, but there's nothing else to miss by subscribing now.
+		actionCtx, cancelAction = context.WithCancel(ctx)
+		go a.countdown(actionCtx, a.subscribe(), id, *action, actionAt)
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			// The critical action is left in the state, so that if this Alerter is being
+			// replaced, the next one carries on waiting to run it.
+			if cancelAction != nil {
+				cancelAction()
+			}
+
+			return
+		case alert := <-a.alertCh:
+			// Whatever the new level is, the critical action isn't needed anymore; if we're still
+			// critical somehow, it's started again.
+			if cancelAction != nil {
+				cancelAction()
+				cancelAction = nil
+			}
+
+			a.state.Lock()
+			a.state.action = nil
+			a.state.actionAt = time.Time{}
+			id := a.state.id
+			a.state.Unlock()
+
+			if alert.level == LevelNormal {
+				a.close(id)
+				a.setNotificationID(0)
+				continue
+			}
+
+			notification := getNotification(alert)
+			notification.ReplacesID = id
+
+			if alert.level != LevelCritical || alert.config.CriticalAction == nil {
+				a.setNotificationID(a.notify(notification))
+				continue
+			}
+
+			// Listen for the cancel action before the notification is shown, otherwise it could be
+			// clicked before we're listening.
+			sub := a.subscribe()
+
+			id = a.notify(notification)
+			a.setNotificationID(id)
+
+			action := *alert.config.CriticalAction
+			actionAt := time.Now().Add(action.Delay.Duration())
+
+			a.state.Lock()
+			a.state.action = &action
+			a.state.actionAt = actionAt
+			a.state.Unlock()
+
+			var actionCtx context.Context
+
+			actionCtx, cancelAction = context.WithCancel(ctx)
+			go a.countdown(actionCtx, sub, id, action, actionAt)
+		}
+	}
+}
+
+// setNotificationID records the ID of the notification that's currently shown.
+func (a *Alerter) setNotificationID(id uint32) {
+	a.state.Lock()
+	defer a.state.Unlock()
+
+	a.state.id = id
+}
+
+// countdown runs the given critical action at the given time, unless the given context is
+// cancelled, or the user cancels it using the notification with the given ID, which is waited for
+// using the given Subscription, if there is one. The Subscription is closed once it's done with.
+// Once the action has been run, or cancelled by the user, it's cleared from the state.
+func (a *Alerter) countdown(ctx context.Context, sub *notify.Subscription, id uint32, action CriticalActionConfig, actionAt time.Time) {
+	waitCtx, cfn := context.WithCancel(ctx)
+	defer cfn()
+
+	cancelCh := make(chan struct{})
+
+	switch {
+	case sub != nil && id != 0:
+		go func() {
+			defer sub.Close()
+
+			// The notification may be closed without being cancelled (e.g. it's dismissed), in
+			// which case the action still runs.
+			key, err := sub.WaitAction(waitCtx, id)
+			if err == nil && key == actionCancel {
+				close(cancelCh)
+			}
+		}()
+	case sub != nil:
+		// The notification couldn't be shown, so it can't be cancelled.
+		sub.Close()
+	}
+
+	timer := time.NewTimer(time.Until(actionAt))
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return
+	case <-cancelCh:
+		log.Println("battery: critical action cancelled")
+		a.clearAction(actionAt)
+		return
+	case <-timer.C:
+	}
+
+	a.clearAction(actionAt)
+
+	err := a.runAction(action)
+	if err != nil {
+		log.Printf("battery: critical action failed: %v\n", err)
+	}
+}
+
+// clearAction clears the critical action from the state, so that it isn't resumed by the next
+// Alerter, unless it's been replaced by an action that's due at a different time.
+func (a *Alerter) clearAction(actionAt time.Time) {
+	a.state.Lock()
+	defer a.state.Unlock()
+
+	if a.state.actionAt.Equal(actionAt) {
+		a.state.action = nil
+		a.state.actionAt = time.Time{}
+	}
+}
+
+// runAction runs the given critical action.
+func (a *Alerter) runAction(action CriticalActionConfig) error {
+	if action.Exec != "" {
+		return exec.Command("sh", "-c", action.Exec).Run()
+	}
+
+	if a.systemBus == nil {
+		return fmt.Errorf("no system bus connection to call logind with")
+	}
+
+	return a.systemBus.
+		Object("org.freedesktop.login1", "/org/freedesktop/login1").
+		Call("org.freedesktop.login1.Manager."+action.Logind, 0, false).
+		Err
+}
+
+// subscribe starts listening for notification actions, returning nil if notifications aren't
+// being sent, or if they can't be listened for.
+func (a *Alerter) subscribe() *notify.Subscription {
+	if a.notifier == nil {
+		return nil
+	}
+
+	sub, err := a.notifier.Subscribe()
+	if err != nil {
+		log.Printf("battery: %v\n", err)
+		return nil
+	}
+
+	return sub
+}
+
+// notify sends the given notification, returning it's ID, or 0 if it couldn't be sent.
+func (a *Alerter) notify(notification notify.Notification) uint32 {
+	if a.notifier == nil {
+		log.Printf("battery: %s: %s\n", notification.Summary, notification.Body)
+		return 0
+	}
+
+	id, err := a.notifier.Notify(notification)
+	if err != nil {
+		log.Printf("battery: %v\n", err)
+	}
+
+	return id
+}
+
+// close closes the notification with the given ID, if there is one.
+func (a *Alerter) close(id uint32) {
+	if a.notifier == nil || id == 0 {
+		return
+	}
+
+	err := a.notifier.Close(id)
+	if err != nil {
+		log.Printf("battery: %v\n", err)
+	}
+}
+
+// NewAlerterConstructor returns a barbara.ServiceConstructorFunc that creates Alerter instances.
+// The state of each power supply's alerts is kept between Alerter instances, so that creating the
+// Alerter again doesn't send notifications again, or forget about a critical action.
+func NewAlerterConstructor(notifier *notify.Notifier, systemBus *dbus.Conn) barbara.ServiceConstructorFunc {
+	var mu sync.Mutex
+	states := make(map[string]*alerterState)
+
+	return func(powerSupply string) (barbara.Service, error) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		state, ok := states[powerSupply]
+		if !ok {
+			state = &alerterState{}
+			states[powerSupply] = state
+		}
+
+		return newAlerter(notifier, systemBus, state), nil
+	}
+}
+
+// sameAlerts returns true if the given Configs would send the same alerts.
+func sameAlerts(a, b Config) bool {
+	if a.Warning != b.Warning || a.Critical != b.Critical {
+		return false
+	}
+
+	if a.CriticalAction == nil || b.CriticalAction == nil {
+		return a.CriticalAction == b.CriticalAction
+	}
+
+	return *a.CriticalAction == *b.CriticalAction
+}
+
+// level returns the level of the given battery, according to this Config's thresholds. Batteries
+// that aren't discharging are never low.
+func (c Config) level(info Info) Level {
+	if info.Status != StatusDischarging {
+		return LevelNormal
+	}
+
+	switch {
+	case c.Critical > 0 && info.Capacity <= c.Critical:
+		return LevelCritical
+	case c.Warning > 0 && info.Capacity <= c.Warning:
+		return LevelWarning
+	}
+
+	return LevelNormal
+}
+
+// getNotification returns the notification to send for the given alert.
+func getNotification(alert alert) notify.Notification {
+	body := fmt.Sprintf("%.0f%% remaining", alert.info.Capacity)
+	if alert.info.Estimate.Confident {
+		body = fmt.Sprintf("%s (%s)", body, formatDuration(alert.info.Estimate.Remaining))
+	}
+
+	if alert.level == LevelWarning {
+		return notify.Notification{
+			Icon:    notificationIcon,
+			Summary: "Battery low",
+			Body:    body + ".",
+			Urgency: notify.UrgencyNormal,
+		}
+	}
+
+	notification := notify.Notification{
+		Icon:    notificationIcon,
+		Summary: "Battery critical",
+		Body:    body + ".",
+		Urgency: notify.UrgencyCritical,
+		Timeout: -1,
+	}
+
+	if action := alert.config.CriticalAction; action != nil {
+		notification.Body = fmt.Sprintf("%s. %s in %v unless cancelled.",
+			body,
+			action.description(),
+			action.Delay.Duration(),
+		)
+
+		notification.Actions = []notify.Action{
+			{Key: actionCancel, Label: "Cancel"},
+		}
+	}
+
+	return notification
+}
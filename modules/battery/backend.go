@@ -0,0 +1,119 @@
+package battery
+
+import (
+	"context"
+	"errors"
+	"log"
+)
+
+const (
+	// BackendSysfs reads battery information directly from sysfs.
+	BackendSysfs = "sysfs"
+	// BackendUPower reads battery information from UPower, over D-Bus.
+	BackendUPower = "upower"
+
+	// ueventSubsystem is the subsystem of uevents that may affect battery information.
+	ueventSubsystem = "power_supply"
+)
+
+// Backend is a source of battery information, used by an InfoNotifier.
+type Backend interface {
+	// Read reads the battery information for the power supply with the given name, or for every
+	// battery if the name is PowerSupplyAuto.
+	Read(powerSupply string) (Update, error)
+	// Watch returns a channel that receives a value whenever battery information may have changed,
+	// until the given context is done, at which point the channel is closed. If changes can't be
+	// watched, an error is returned, and battery information will be polled instead.
+	Watch(ctx context.Context) (<-chan struct{}, error)
+}
+
+// SysfsBackend is a Backend that reads battery information from sysfs, watching for changes using
+// power supply uevents.
+type SysfsBackend struct {
+	reader   *InfoReader
+	listener UeventListener
+}
+
+// NewSysfsBackend returns a new SysfsBackend instance, that reads battery information using the
+// given InfoReader, and watches for changes using the given UeventListener. If the listener is nil,
+// changes aren't watched, and battery information is polled instead.
+func NewSysfsBackend(reader *InfoReader, listener UeventListener) *SysfsBackend {
+	return &SysfsBackend{
+		reader:   reader,
+		listener: listener,
+	}
+}
+
+// Read reads the battery information for the given power supply from sysfs. When reading every
+// battery, the batteries are discovered each time, so that batteries that are added or removed are
+// noticed straight away.
+func (b *SysfsBackend) Read(powerSupply string) (Update, error) {
+	var update Update
+
+	names := []string{powerSupply}
+	if powerSupply == PowerSupplyAuto {
+		var err error
+
+		names, err = b.reader.Discover()
+		if err != nil {
+			return update, err
+		}
+	}
+
+	for _, name := range names {
+		info, err := b.reader.Read(name)
+		if err != nil && powerSupply != PowerSupplyAuto {
+			return update, err
+		}
+
+		if err != nil {
+			// The battery may have just been removed, skip it and show the others.
+			log.Println(err)
+			continue
+		}
+
+		update.Batteries = append(update.Batteries, info)
+	}
+
+	update.Total = Aggregate(update.Batteries)
+
+	return update, nil
+}
+
+// Watch listens for power supply uevents. Any power supply changing may change the battery
+// information, e.g. a charger being plugged in changes the status of the battery, not the charger.
+//
+// sysfs attributes can't be watched using inotify, which is why uevents are used instead.
+func (b *SysfsBackend) Watch(ctx context.Context) (<-chan struct{}, error) {
+	if b.listener == nil {
+		return nil, errors.New("battery: no uevent listener to watch power supplies with")
+	}
+
+	events, err := b.listener.Listen(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	changes := make(chan struct{}, 1)
+
+	go func() {
+		defer close(changes)
+
+		for event := range events {
+			if event.Action == UeventActionDropped || event.Env["SUBSYSTEM"] == ueventSubsystem {
+				notifyChange(changes)
+			}
+		}
+	}()
+
+	return changes, nil
+}
+
+// notifyChange signals a change on the given channel, unless a change is already waiting to be
+// received, as one is enough to cause the battery information to be read again.
+func notifyChange(changes chan<- struct{}) {
+	select {
+	case changes <- struct{}{}:
+	default:
+	}
+}
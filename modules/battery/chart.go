@@ -0,0 +1,97 @@
+package battery
+
+import (
+	"math"
+	"time"
+)
+
+const (
+	// chartWidth is the width of the history chart, in pixels. Each pixel is five minutes.
+	chartWidth = 288
+	// chartHeight is the height of the history chart, in pixels.
+	chartHeight = 80
+	// chartPeriod is how far back the history chart goes.
+	chartPeriod = 24 * time.Hour
+	// chartGridInterval is how far apart the vertical grid lines on the history chart are.
+	chartGridInterval = 6 * time.Hour
+	// chartMaxGap is the longest gap between samples that's drawn as a continuous line. Longer gaps
+	// are left empty, e.g. while suspended, so that the drop in charge across them stands out.
+	chartMaxGap = 10 * time.Minute
+)
+
+// chartLineKind is what a line on the history chart represents, used to pick it's colour.
+type chartLineKind int
+
+const (
+	chartLineGrid chartLineKind = iota
+	chartLineCapacity
+	chartLineCharging
+	chartLineDischarging
+)
+
+// chartLine is a line on the history chart.
+type chartLine struct {
+	kind   chartLineKind
+	x1, y1 int
+	x2, y2 int
+}
+
+// getChartLines returns the lines to draw for a chart of the given samples, of the given size,
+// ending at the given time. The battery's capacity is drawn as a line across the whole chart, and
+// the rate it was being charged or discharged at is drawn as bars along the bottom half.
+func getChartLines(samples []HistorySample, now time.Time, width, height int) []chartLine {
+	var lines []chartLine
+
+	bottom := height - 1
+
+	x := func(t time.Time) int {
+		return int(float64(width-1) * (1 - float64(now.Sub(t))/float64(chartPeriod)))
+	}
+
+	for ago := chartGridInterval; ago < chartPeriod; ago += chartGridInterval {
+		gx := x(now.Add(-ago))
+		lines = append(lines, chartLine{kind: chartLineGrid, x1: gx, y1: 0, x2: gx, y2: bottom})
+	}
+
+	var maxWatts float64
+	for _, sample := range samples {
+		maxWatts = math.Max(maxWatts, math.Abs(sample.Watts))
+	}
+
+	if maxWatts > 0 {
+		for _, sample := range samples {
+			kind := chartLineDischarging
+			if sample.Status == StatusCharging {
+				kind = chartLineCharging
+			}
+
+			sx := x(sample.Time)
+			barHeight := int(math.Abs(sample.Watts) / maxWatts * float64(height/2))
+
+			if barHeight > 0 {
+				lines = append(lines, chartLine{kind: kind, x1: sx, y1: bottom, x2: sx, y2: bottom - barHeight})
+			}
+		}
+	}
+
+	y := func(capacity float64) int {
+		return bottom - int(math.Min(math.Max(capacity, 0), 100)/100*float64(bottom))
+	}
+
+	for i := 1; i < len(samples); i++ {
+		prev, cur := samples[i-1], samples[i]
+		if cur.Time.Sub(prev.Time) > chartMaxGap {
+			continue
+		}
+
+		lines = append(lines, chartLine{
+			kind: chartLineCapacity,
+			x1:   x(prev.Time),
+			y1:   y(prev.Capacity),
+			x2:   x(cur.Time),
+			y2:   y(cur.Capacity),
+		})
+	}
+
+	return lines
+}
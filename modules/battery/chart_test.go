@@ -0,0 +1,97 @@
+package battery
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestGetChartLines(t *testing.T) {
+	// With a width of 257 pixels, each pixel is 1/256th of the chart's period, so the samples below
+	// all land exactly on a pixel. Two pixels apart is further apart than chartMaxGap.
+	width, height := 257, 101
+	step := chartPeriod / 256
+
+	now := time.Date(2026, time.March, 14, 12, 0, 0, 0, time.UTC)
+	ago := func(steps int) time.Time {
+		return now.Add(-time.Duration(steps) * step)
+	}
+
+	grid := []chartLine{
+		{kind: chartLineGrid, x1: 192, y1: 0, x2: 192, y2: 100},
+		{kind: chartLineGrid, x1: 128, y1: 0, x2: 128, y2: 100},
+		{kind: chartLineGrid, x1: 64, y1: 0, x2: 64, y2: 100},
+	}
+
+	tests := []struct {
+		name     string
+		samples  []HistorySample
+		expected []chartLine
+	}{
+		{
+			name:     "no samples",
+			samples:  nil,
+			expected: grid,
+		},
+		{
+			name: "placement",
+			samples: []HistorySample{
+				{Time: ago(2), Capacity: 50, Watts: 10, Status: StatusDischarging},
+				{Time: ago(1), Capacity: 25, Watts: 5, Status: StatusDischarging},
+				{Time: ago(0), Capacity: 100, Watts: 20, Status: StatusCharging},
+			},
+			expected: append(append([]chartLine(nil), grid...),
+				// Rate bars are scaled so that the highest rate is half the chart's height.
+				chartLine{kind: chartLineDischarging, x1: 254, y1: 100, x2: 254, y2: 75},
+				chartLine{kind: chartLineDischarging, x1: 255, y1: 100, x2: 255, y2: 88},
+				chartLine{kind: chartLineCharging, x1: 256, y1: 100, x2: 256, y2: 50},
+				chartLine{kind: chartLineCapacity, x1: 254, y1: 50, x2: 255, y2: 75},
+				chartLine{kind: chartLineCapacity, x1: 255, y1: 75, x2: 256, y2: 0},
+			),
+		},
+		{
+			name: "out of range",
+			samples: []HistorySample{
+				{Time: ago(256), Capacity: 120, Status: StatusFull},
+				{Time: ago(256), Capacity: -5, Status: StatusDischarging},
+			},
+			expected: append(append([]chartLine(nil), grid...),
+				chartLine{kind: chartLineCapacity, x1: 0, y1: 0, x2: 0, y2: 100},
+			),
+		},
+		{
+			name: "gap",
+			samples: []HistorySample{
+				{Time: ago(4), Capacity: 80, Watts: 10, Status: StatusDischarging},
+				{Time: ago(2), Capacity: 70, Watts: 10, Status: StatusDischarging},
+				{Time: ago(1), Capacity: 60, Watts: 10, Status: StatusDischarging},
+			},
+			expected: append(append([]chartLine(nil), grid...),
+				chartLine{kind: chartLineDischarging, x1: 252, y1: 100, x2: 252, y2: 50},
+				chartLine{kind: chartLineDischarging, x1: 254, y1: 100, x2: 254, y2: 50},
+				chartLine{kind: chartLineDischarging, x1: 255, y1: 100, x2: 255, y2: 50},
+				chartLine{kind: chartLineCapacity, x1: 254, y1: 30, x2: 255, y2: 40},
+			),
+		},
+		{
+			// Without any power draw, there are no rate bars, rather than bars of NaN height.
+			name: "no power draw",
+			samples: []HistorySample{
+				{Time: ago(1), Capacity: 100, Status: StatusFull},
+				{Time: ago(0), Capacity: 100, Status: StatusFull},
+			},
+			expected: append(append([]chartLine(nil), grid...),
+				chartLine{kind: chartLineCapacity, x1: 255, y1: 0, x2: 256, y2: 0},
+			),
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			lines := getChartLines(test.samples, now, width, height)
+			if !reflect.DeepEqual(lines, test.expected) {
+				t.Errorf("expected %+v, got %+v", test.expected, lines)
+			}
+		})
+	}
+}
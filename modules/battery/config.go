@@ -1,9 +1,188 @@
 package battery
 
+import (
+	"fmt"
+	"time"
+
+	"github.com/seeruk/barbara/barbara"
+)
+
+const (
+	// PowerSupplyAuto is the power supply name used to show every battery in the system.
+	PowerSupplyAuto = "auto"
+
+	// ModeAggregate shows all batteries combined, as if they were one battery.
+	ModeAggregate = "aggregate"
+	// ModePerBattery shows each battery separately.
+	ModePerBattery = "per-battery"
+
+	// DefaultWarning is the default percentage at or below which a low battery warning is shown.
+	DefaultWarning = 20
+	// DefaultCritical is the default percentage at or below which the battery is critical.
+	DefaultCritical = 10
+	// DefaultCriticalActionDelay is how long to wait before running the critical action, giving
+	// the user a chance to cancel it, or plug in their charger.
+	DefaultCriticalActionDelay = time.Minute
+)
+
+// logindActions are the logind Manager methods that may be used as a critical action, along with a
+// description of what they do, used in notifications.
+var logindActions = map[string]string{
+	"Suspend":     "Suspending",
+	"Hibernate":   "Hibernating",
+	"HybridSleep": "Suspending",
+	"PowerOff":    "Powering off",
+}
+
 // Config holds all battery module configuration.
 type Config struct {
 	// PowerSupply is the name of the power supply found in /sys/class/power_supply, e.g. BAT0. The
-	// power supply must actually be a battery.
+	// power supply must actually be a battery. If PowerSupply is "auto", every battery is shown,
+	// including batteries that are added or removed while Barbara is running.
 	PowerSupply string `json:"power_supply"`
+	// Mode specifies how multiple batteries are shown, either "aggregate" (the default), or
+	// "per-battery".
+	Mode string `json:"mode"`
+	// Format is the format of the text shown next to the battery icon, for each state ("charging",
+	// "discharging", "full", and "unknown"), as a text/template. Every Info field can be used, as
+	// well as .Percentage, .TimeRemaining, .Remaining, .Watts, and .Health, and the "duration" and
+	// "round" functions. States that aren't given use the default format, and an empty format shows
+	// only the icon.
+	Format map[string]string `json:"format"`
+	// Icons configures which icon is shown for the battery.
+	Icons IconsConfig `json:"icons"`
+	// ChargeThresholds configures the charge threshold presets shown in the popup, for batteries
+	// that support limiting how much they're charged.
+	ChargeThresholds ChargeThresholdsConfig `json:"charge_thresholds"`
+	// Backend is where battery information is read from, either "sysfs" (the default), or
+	// "upower". With UPower, PowerSupply is still the battery's name in sysfs, e.g. BAT0.
+	Backend string `json:"backend"`
+	// Warning is the percentage at or below which a discharging battery is low, sending a
+	// notification, and marking the module with the warning style class. Defaults to 20, negative
+	// values disable the warning.
+	Warning float64 `json:"warning"`
+	// Critical is the percentage at or below which a discharging battery is critical, sending a
+	// notification, marking the module with the urgent style class, and running the CriticalAction
+	// if there is one. Defaults to 10, negative values disable it.
+	Critical float64 `json:"critical"`
+	// CriticalAction is run when the battery becomes critical, after a delay.
+	//
+	// Notifications and the critical action are shared by every module showing the same power
+	// supply, so if their Warning, Critical, or CriticalAction differ, the first module's are used.
+	CriticalAction *CriticalActionConfig `json:"critical_action"`
 	// TODO(elliot): Specifying defaults would be useful for things like refresh interval...
 }
+
+// IconsConfig holds configuration for the battery icon. Icon names may be templates, executed with
+// the same data as the label format, along with .Level, which is the battery's percentage rounded
+// down to the nearest 10.
+type IconsConfig struct {
+	// Type is either "image" (the default), where icons are names in the icon theme, or "glyph",
+	// where icons are text, e.g. characters in an icon font.
+	Type string `json:"type"`
+	// Font is the font family that glyphs are shown in, e.g. "Font Awesome 5 Free".
+	Font string `json:"font"`
+	// Size is the size of the icon, in pixels. Defaults to 24.
+	Size int `json:"size"`
+	// Levels maps battery percentages to icons. The icon used is the one with the highest minimum
+	// percentage that the battery is at or above.
+	Levels []IconLevelConfig `json:"levels"`
+	// Full is the icon shown when the battery is full, instead of the icon for it's level.
+	Full string `json:"full"`
+	// Critical is the icon shown when the battery is critical, instead of the icon for it's level.
+	Critical string `json:"critical"`
+}
+
+// IconLevelConfig maps a minimum battery percentage to an icon.
+type IconLevelConfig struct {
+	Min  float64 `json:"min"`
+	Icon string  `json:"icon"`
+	// Charging is the icon shown if the battery is charging, defaulting to Icon.
+	Charging string `json:"charging"`
+}
+
+// validate checks that the IconsConfig is usable, applying defaults.
+func (c *IconsConfig) validate() error {
+	switch c.Type {
+	case "":
+		c.Type = IconTypeImage
+	case IconTypeImage, IconTypeGlyph:
+	default:
+		return fmt.Errorf("battery: invalid icon type %q", c.Type)
+	}
+
+	if c.Size <= 0 {
+		c.Size = DefaultIconSize
+	}
+
+	if len(c.Levels) == 0 {
+		c.Levels = append([]IconLevelConfig(nil), defaultIconLevels...)
+	}
+
+	for _, level := range c.Levels {
+		if level.Icon == "" {
+			return fmt.Errorf("battery: icon level %v has no icon", level.Min)
+		}
+	}
+
+	return nil
+}
+
+// ChargeThresholdsConfig holds configuration for setting battery charge thresholds.
+type ChargeThresholdsConfig struct {
+	// Command is run using "sh -c" to set a battery's charge thresholds. The battery's name, and
+	// the start and end thresholds are passed as $1, $2, and $3, and as $BATTERY, $START, and $END.
+	// If the battery only has an end threshold (as many do), the start threshold is empty.
+	// Writing the thresholds needs root, so the default command uses pkexec, which asks for
+	// permission using polkit.
+	Command string `json:"command"`
+	// Presets are the thresholds that can be picked from in the popup. Defaults to "Conserve
+	// (60–80%)", and "Full charge".
+	Presets []ChargeThresholdPresetConfig `json:"presets"`
+}
+
+// ChargeThresholdPresetConfig is a named pair of charge thresholds.
+type ChargeThresholdPresetConfig struct {
+	Name  string  `json:"name"`
+	Start float64 `json:"start"`
+	End   float64 `json:"end"`
+}
+
+// CriticalActionConfig holds configuration for the action that is run when the battery becomes
+// critical. Only one of Exec or Logind may be set.
+type CriticalActionConfig struct {
+	// Exec is a command that's run using "sh -c", e.g. "systemctl suspend".
+	Exec string `json:"exec"`
+	// Logind is the name of a logind Manager method that's called over D-Bus, one of "Suspend",
+	// "Hibernate", "HybridSleep", or "PowerOff".
+	Logind string `json:"logind"`
+	// Delay is how long to wait before running the action, during which it can be cancelled from
+	// the notification. Defaults to one minute.
+	Delay barbara.Duration `json:"delay"`
+}
+
+// validate checks that the CriticalActionConfig is usable, applying defaults.
+func (c *CriticalActionConfig) validate() error {
+	if (c.Exec == "") == (c.Logind == "") {
+		return fmt.Errorf("battery: critical_action must have one of exec or logind")
+	}
+
+	if _, ok := logindActions[c.Logind]; c.Logind != "" && !ok {
+		return fmt.Errorf("battery: invalid critical_action logind method %q", c.Logind)
+	}
+
+	if c.Delay <= 0 {
+		c.Delay = barbara.Duration(DefaultCriticalActionDelay)
+	}
+
+	return nil
+}
+
+// description returns a description of what the action does, to be shown in notifications.
+func (c *CriticalActionConfig) description() string {
+	if c.Logind != "" {
+		return logindActions[c.Logind]
+	}
+
+	return fmt.Sprintf("Running %q", c.Exec)
+}
@@ -1,7 +1,3 @@
-// Package battery ...
-//
-// TODO:
-// * Show icon indicating charge, maybe use Paper-Mono-Dark theme?
-// * Should time remaining show on click or something? Maybe we can show loads of battery info on
-//   a QMenu instead?
+// Package battery provides a module that shows battery information, read from sysfs or from
+// UPower, along with the shared services it uses to read battery information and send alerts.
 package battery
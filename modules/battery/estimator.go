@@ -0,0 +1,131 @@
+package battery
+
+import "time"
+
+const (
+	// estimateWindow is how far back samples are used to estimate the rate a battery is being used
+	// at. Longer windows are more stable, but slower to react to changes in usage.
+	estimateWindow = 10 * time.Minute
+	// estimateMinSpan is how far apart the oldest and newest samples must be for an estimate to be
+	// made at all.
+	estimateMinSpan = 2 * time.Minute
+	// estimateMinSamples is how many samples there must be for an estimate to be made at all.
+	estimateMinSamples = 3
+	// estimateMinConfidence is how well the samples must fit a straight line (as the coefficient of
+	// determination, between 0 and 1) for an estimate to be shown.
+	estimateMinConfidence = 0.6
+)
+
+// Estimate is an estimate of the time until a battery is empty, or until it's full if it's
+// charging, made from recent samples of the battery's level rather than from it's current rate,
+// which can be very noisy.
+type Estimate struct {
+	// Remaining is the estimated time remaining. It's only meaningful if Confident is true.
+	Remaining time.Duration
+	// Ready is true if enough samples have been collected to try to make an estimate.
+	Ready bool
+	// Confident is true if the samples are consistent enough for the estimate to be useful.
+	Confident bool
+}
+
+// sample is a battery's level at a point in time.
+type sample struct {
+	time  time.Time
+	level float64
+}
+
+// estimator estimates the time remaining for a battery, using linear regression over a sliding
+// window of samples. The window is reset whenever the battery's status changes, as a battery that
+// has just started charging says nothing about how fast it will discharge.
+type estimator struct {
+	samples []sample
+	status  string
+}
+
+// add adds a sample of the given battery information, taken at the given time, and returns a new
+// estimate of the time remaining.
+func (e *estimator) add(now time.Time, info Info) Estimate {
+	if info.Status != e.status {
+		e.samples = e.samples[:0]
+		e.status = info.Status
+	}
+
+	// Drop samples that have slid out of the window.
+	var i int
+	for i < len(e.samples) && now.Sub(e.samples[i].time) > estimateWindow {
+		i++
+	}
+
+	e.samples = append(e.samples[i:], sample{time: now, level: getLevel(info)})
+
+	if info.Status != StatusCharging && info.Status != StatusDischarging {
+		return Estimate{}
+	}
+
+	first, last := e.samples[0], e.samples[len(e.samples)-1]
+	if len(e.samples) < estimateMinSamples || last.time.Sub(first.time) < estimateMinSpan {
+		return Estimate{}
+	}
+
+	slope, confidence := regress(e.samples)
+
+	// The level must be moving in the right direction, otherwise the estimate would be infinite,
+	// or negative.
+	remaining := last.level / -slope
+	if info.Status == StatusCharging {
+		remaining = (1 - last.level) / slope
+	}
+
+	if remaining < 0 || confidence < estimateMinConfidence {
+		return Estimate{Ready: true}
+	}
+
+	return Estimate{
+		Remaining: time.Duration(remaining * float64(time.Hour)),
+		Ready:     true,
+		Confident: true,
+	}
+}
+
+// getLevel returns how full the given battery is, between 0 and 1. Charge or energy is used where
+// possible, as capacity is usually rounded to a whole percentage.
+func getLevel(info Info) float64 {
+	now, full, _ := info.levels()
+	if full <= 0 {
+		return info.Capacity / 100
+	}
+
+	return now / full
+}
+
+// regress fits a straight line to the given samples using least squares, returning it's slope, in
+// level per hour, and the coefficient of determination, i.e. how well the line fits the samples.
+func regress(samples []sample) (slope float64, confidence float64) {
+	n := float64(len(samples))
+	start := samples[0].time
+
+	var sumX, sumY float64
+	for _, s := range samples {
+		sumX += s.time.Sub(start).Hours()
+		sumY += s.level
+	}
+
+	meanX, meanY := sumX/n, sumY/n
+
+	var covXY, varX, varY float64
+	for _, s := range samples {
+		dx := s.time.Sub(start).Hours() - meanX
+		dy := s.level - meanY
+
+		covXY += dx * dy
+		varX += dx * dx
+		varY += dy * dy
+	}
+
+	if varX == 0 || varY == 0 {
+		// Either every sample was taken at the same time, or the level hasn't changed at all.
+		return 0, 0
+	}
+
+	return covXY / varX, (covXY * covXY) / (varX * varY)
+}
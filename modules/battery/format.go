@@ -0,0 +1,159 @@
+package battery
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"text/template"
+	"time"
+)
+
+// States that the label text can be formatted differently in, used as keys in the format config.
+const (
+	StateCharging    = "charging"
+	StateDischarging = "discharging"
+	StateFull        = "full"
+	StateUnknown     = "unknown"
+)
+
+// defaultFormats are the formats used for states that aren't configured.
+var defaultFormats = map[string]string{
+	StateCharging:    "{{round .Percentage 0}}% ({{.TimeRemaining}})",
+	StateDischarging: "{{round .Percentage 0}}% ({{.TimeRemaining}})",
+	StateFull:        "{{round .Percentage 0}}%",
+	StateUnknown:     "{{round .Percentage 0}}%",
+}
+
+// formatFuncs are the helper functions available in format templates.
+var formatFuncs = template.FuncMap{
+	"duration": formatDuration,
+	"round":    round,
+}
+
+// formatData is the data that format templates are executed with. Every Info field is available,
+// along with values derived from them.
+type formatData struct {
+	Info
+
+	// Percentage is how full the battery is, the same as Capacity.
+	Percentage float64
+	// TimeRemaining is the formatted estimate of the time remaining, e.g. "02:38", "estimating…",
+	// or "—" if the estimate isn't confident.
+	TimeRemaining string
+	// Remaining is the estimated time remaining, or 0 if the estimate isn't confident.
+	Remaining time.Duration
+	// Watts is the rate the battery is being charged or discharged at, in watts.
+	Watts float64
+	// Health is the battery's full charge as a percentage of it's design charge, or 0 if unknown.
+	Health float64
+}
+
+// formatter renders the text shown on the bar for a battery, using the format configured for the
+// battery's state.
+type formatter struct {
+	templates map[string]*template.Template
+}
+
+// newFormatter returns a new formatter instance, parsing the given formats, keyed by state. States
+// without a format use the default format. A format may be empty, in which case no text is shown.
+func newFormatter(formats map[string]string) (*formatter, error) {
+	f := &formatter{
+		templates: make(map[string]*template.Template),
+	}
+
+	for state := range formats {
+		if _, ok := defaultFormats[state]; !ok {
+			return nil, fmt.Errorf("battery: invalid format state %q", state)
+		}
+	}
+
+	for state, def := range defaultFormats {
+		format, ok := formats[state]
+		if !ok {
+			format = def
+		}
+
+		tmpl, err := template.New(state).Funcs(formatFuncs).Parse(format)
+		if err != nil {
+			return nil, fmt.Errorf("battery: invalid %s format: %v", state, err)
+		}
+
+		f.templates[state] = tmpl
+	}
+
+	return f, nil
+}
+
+// format returns the text to show on the bar for the given battery information.
+func (f *formatter) format(info Info) (string, error) {
+	var buf bytes.Buffer
+
+	err := f.templates[getState(info)].Execute(&buf, newFormatData(info))
+	if err != nil {
+		return "", err
+	}
+
+	return buf.String(), nil
+}
+
+// newFormatData returns the data that format templates are executed with for the given battery.
+func newFormatData(info Info) formatData {
+	data := formatData{
+		Info:          info,
+		Percentage:    info.Capacity,
+		TimeRemaining: formatEstimate(info.Estimate),
+		Watts:         info.Watts(),
+	}
+
+	if info.Estimate.Confident {
+		data.Remaining = info.Estimate.Remaining
+	}
+
+	if health, ok := info.Health(); ok {
+		data.Health = health
+	}
+
+	return data
+}
+
+// getState returns the state of the given battery, used to pick which format to use. A battery
+// that's full is always in the full state, even if it claims to still be charging.
+func getState(info Info) string {
+	switch {
+	case info.IsFull():
+		return StateFull
+	case info.Status == StatusCharging:
+		return StateCharging
+	case info.Status == StatusDischarging:
+		return StateDischarging
+	}
+
+	return StateUnknown
+}
+
+// formatEstimate formats the given estimate of the time remaining. Estimates that aren't confident
+// aren't shown, as a wildly wrong estimate is worse than none at all.
+func formatEstimate(estimate Estimate) string {
+	switch {
+	case !estimate.Ready:
+		// Not enough samples have been collected yet, which is common just after plugging in.
+		return "estimating…"
+	case !estimate.Confident:
+		return "—"
+	}
+
+	return formatDuration(estimate.Remaining)
+}
+
+// formatDuration formats the given duration as hours and minutes.
+func formatDuration(duration time.Duration) string {
+	minutes := int(duration / time.Minute)
+
+	return fmt.Sprintf("%02d:%02d", minutes/60, minutes%60)
+}
+
+// round rounds the given value to the given number of decimal places.
+func round(value float64, places int) float64 {
+	pow := math.Pow(10, float64(places))
+	return math.Round(value*pow) / pow
+}
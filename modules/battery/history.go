@@ -0,0 +1,286 @@
+package battery
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+const (
+	// HistoryInterval is how often samples are recorded in a battery's History.
+	HistoryInterval = time.Minute
+	// HistorySize is how many samples a battery's History holds, enough for two days at the
+	// default interval, so that a whole day can always be shown.
+	HistorySize = 2880
+
+	// historyMagic identifies a history file, and the version of it's format.
+	historyMagic = "BBH1"
+	// historyHeaderSize is the size of the header at the start of a history file.
+	historyHeaderSize = 16
+	// historyRecordSize is the size of each sample in a history file.
+	historyRecordSize = 20
+	// historyTolerance is how much earlier than HistoryInterval a sample may be recorded. Battery
+	// information is read on an interval that's the same as HistoryInterval, so reads don't land
+	// exactly HistoryInterval apart, and without some tolerance, every other sample could be
+	// skipped.
+	historyTolerance = HistoryInterval / 10
+)
+
+// historyStatuses maps statuses to the codes stored in history files, and back.
+var historyStatuses = []string{
+	StatusUnknown,
+	StatusCharging,
+	StatusDischarging,
+	StatusFull,
+	StatusNotCharging,
+}
+
+// HistorySample is a sample of a battery's state, recorded in a History.
+type HistorySample struct {
+	Time     time.Time
+	Capacity float64
+	Watts    float64
+	Status   string
+}
+
+// historyHeader is the header at the start of a history file.
+type historyHeader struct {
+	Magic [4]byte
+	Size  uint32
+	Next  uint32
+	Count uint32
+}
+
+// historyRecord is a sample, as it's stored in a history file.
+type historyRecord struct {
+	Time     int64
+	Capacity float32
+	Watts    float32
+	Status   uint8
+	_        [3]byte
+}
+
+// History records samples of a battery's state to a file, so that they survive restarts (and
+// suspends). The file is a fixed-size ring buffer, so once it's full, the oldest samples are
+// overwritten. This type is safe for concurrent use, but each file must only be used by one
+// History.
+type History struct {
+	sync.Mutex
+
+	fileName string
+	last     time.Time
+}
+
+// NewHistory returns a new History instance, recording samples to the file with the given name.
+// The file, and the directory it's in, are created when the first sample is recorded.
+func NewHistory(fileName string) *History {
+	return &History{
+		fileName: fileName,
+	}
+}
+
+// DefaultHistoryDir returns the directory that history files are stored in by default, which is
+// $XDG_STATE_HOME/barbara, or ~/.local/state/barbara if XDG_STATE_HOME isn't set.
+func DefaultHistoryDir() string {
+	stateHome := os.Getenv("XDG_STATE_HOME")
+	if stateHome == "" {
+		stateHome = filepath.Join(os.Getenv("HOME"), ".local", "state")
+	}
+
+	return filepath.Join(stateHome, "barbara")
+}
+
+// Record records a sample of the given battery information, taken at the given time, unless a
+// sample was recorded less than HistoryInterval ago (give or take a few seconds).
+func (h *History) Record(now time.Time, info Info) error {
+	h.Lock()
+	defer h.Unlock()
+
+	if now.Sub(h.last) < HistoryInterval-historyTolerance {
+		return nil
+	}
+
+	h.last = now
+
+	err := os.MkdirAll(filepath.Dir(h.fileName), 0755)
+	if err != nil {
+		return fmt.Errorf("battery: failed to create history directory: %v", err)
+	}
+
+	file, err := os.OpenFile(h.fileName, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return fmt.Errorf("battery: failed to open history: %v", err)
+	}
+
+	defer file.Close()
+
+	header, err := readHistoryHeader(file)
+	if err != nil {
+		return err
+	}
+
+	record := historyRecord{
+		Time:     now.Unix(),
+		Capacity: float32(info.Capacity),
+		Watts:    float32(info.Watts()),
+		Status:   historyStatus(info.Status),
+	}
+
+	var buf bytes.Buffer
+	binary.Write(&buf, binary.LittleEndian, record)
+
+	_, err = file.WriteAt(buf.Bytes(), historyHeaderSize+int64(header.Next)*historyRecordSize)
+	if err != nil {
+		return fmt.Errorf("battery: failed to write history: %v", err)
+	}
+
+	header.Next = (header.Next + 1) % header.Size
+	if header.Count < header.Size {
+		header.Count++
+	}
+
+	return writeHistoryHeader(file, header)
+}
+
+// Since returns every sample recorded at or after the given time, oldest first. If nothing has
+// been recorded yet, no samples are returned.
+func (h *History) Since(since time.Time) ([]HistorySample, error) {
+	h.Lock()
+	defer h.Unlock()
+
+	file, err := os.Open(h.fileName)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("battery: failed to open history: %v", err)
+	}
+
+	defer file.Close()
+
+	header, err := readHistoryHeader(file)
+	if err != nil {
+		return nil, err
+	}
+
+	records := make([]historyRecord, header.Size)
+
+	_, err = file.Seek(historyHeaderSize, io.SeekStart)
+	if err == nil {
+		err = binary.Read(file, binary.LittleEndian, records[:header.Count])
+	}
+
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		// The file has been truncated since it's header was read. It'll be reset when the next
+		// sample is recorded.
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("battery: failed to read history: %v", err)
+	}
+
+	// The oldest record is the next one to be overwritten, unless the file isn't full yet.
+	start := uint32(0)
+	if header.Count == header.Size {
+		start = header.Next
+	}
+
+	var samples []HistorySample
+	for i := uint32(0); i < header.Count; i++ {
+		record := records[(start+i)%header.Size]
+
+		t := time.Unix(record.Time, 0)
+		if t.Before(since) {
+			continue
+		}
+
+		status := StatusUnknown
+		if int(record.Status) < len(historyStatuses) {
+			status = historyStatuses[record.Status]
+		}
+
+		samples = append(samples, HistorySample{
+			Time:     t,
+			Capacity: float64(record.Capacity),
+			Watts:    float64(record.Watts),
+			Status:   status,
+		})
+	}
+
+	return samples, nil
+}
+
+// readHistoryHeader reads the header of the given history file. If the file is empty, or isn't a
+// valid history file (e.g. because it's from an older version, it's been truncated, or it's
+// corrupt), a header for an empty file is returned, so that it's overwritten.
+func readHistoryHeader(file *os.File) (historyHeader, error) {
+	empty := historyHeader{Size: HistorySize}
+	copy(empty.Magic[:], historyMagic)
+
+	buf := make([]byte, historyHeaderSize)
+
+	_, err := file.ReadAt(buf, 0)
+	if err == io.EOF {
+		return empty, nil
+	}
+
+	if err != nil {
+		return empty, fmt.Errorf("battery: failed to read history: %v", err)
+	}
+
+	var header historyHeader
+
+	err = binary.Read(bytes.NewReader(buf), binary.LittleEndian, &header)
+	switch {
+	case err != nil, string(header.Magic[:]) != historyMagic:
+		return empty, nil
+	case header.Size != HistorySize, header.Next >= header.Size, header.Count > header.Size:
+		// The size is fixed, so a file with any other size has been corrupted, and trusting it
+		// could mean allocating any amount of memory.
+		return empty, nil
+	}
+
+	stat, err := file.Stat()
+	if err != nil {
+		return empty, fmt.Errorf("battery: failed to read history: %v", err)
+	}
+
+	// Every record that the header says has been written must be in the file. If they aren't, the
+	// file was cut short (e.g. the disk filled up), so the records can't be trusted.
+	if stat.Size() < historyHeaderSize+int64(header.Count)*historyRecordSize {
+		return empty, nil
+	}
+
+	return header, nil
+}
+
+// writeHistoryHeader writes the given header to the given history file.
+func writeHistoryHeader(file *os.File, header historyHeader) error {
+	var buf bytes.Buffer
+	binary.Write(&buf, binary.LittleEndian, header)
+
+	_, err := file.WriteAt(buf.Bytes(), 0)
+	if err != nil {
+		return fmt.Errorf("battery: failed to write history: %v", err)
+	}
+
+	return nil
+}
+
+// historyStatus returns the code stored in history files for the given status.
+func historyStatus(status string) uint8 {
+	for i, s := range historyStatuses {
+		if s == status {
+			return uint8(i)
+		}
+	}
+
+	return 0
+}
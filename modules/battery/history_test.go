@@ -0,0 +1,181 @@
+package battery
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestHistory_Record(t *testing.T) {
+	dir, err := ioutil.TempDir("", "barbara-history")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.RemoveAll(dir)
+
+	history := NewHistory(filepath.Join(dir, "battery-BAT0.history"))
+
+	start := time.Unix(1527843600, 0)
+
+	// Battery information is read every minute, give or take.
+	times := []time.Duration{
+		0,
+		59 * time.Second,
+		90 * time.Second,
+		2 * time.Minute,
+		3*time.Minute - time.Second,
+		4 * time.Minute,
+	}
+
+	for i, offset := range times {
+		info := Info{Capacity: float64(90 - i), Status: StatusDischarging, PowerNow: 10e6}
+
+		err := history.Record(start.Add(offset), info)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	samples, err := history.Since(start)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Only the sample 90 seconds in is too soon after the one before it.
+	expected := []float64{90, 89, 87, 86, 85}
+	if len(samples) != len(expected) {
+		t.Fatalf("expected %d samples, got %d: %+v", len(expected), len(samples), samples)
+	}
+
+	for i, sample := range samples {
+		if sample.Capacity != expected[i] {
+			t.Errorf("expected sample %d to have capacity %v, got %v", i, expected[i], sample.Capacity)
+		}
+
+		if sample.Status != StatusDischarging || sample.Watts != 10 {
+			t.Errorf("expected sample %d to be discharging at 10W, got %+v", i, sample)
+		}
+	}
+
+	samples, err = history.Since(start.Add(3 * time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(samples) != 1 || !samples[0].Time.Equal(start.Add(4*time.Minute)) {
+		t.Errorf("expected only the last sample, got %+v", samples)
+	}
+}
+
+func TestHistory_Truncated(t *testing.T) {
+	dir, err := ioutil.TempDir("", "barbara-history")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.RemoveAll(dir)
+
+	fileName := filepath.Join(dir, "battery-BAT0.history")
+	history := NewHistory(fileName)
+
+	start := time.Unix(1527843600, 0)
+
+	for i := 0; i < 3; i++ {
+		err := history.Record(start.Add(time.Duration(i)*HistoryInterval), Info{Capacity: 50})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Cut the last record short, as if the disk filled up while it was being written.
+	err = os.Truncate(fileName, historyHeaderSize+3*historyRecordSize-1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	samples, err := history.Since(start)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(samples) != 0 {
+		t.Errorf("expected no samples from a truncated file, got %+v", samples)
+	}
+
+	// The file is reset when the next sample is recorded.
+	err = history.Record(start.Add(3*HistoryInterval), Info{Capacity: 49})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	samples, err = history.Since(start)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(samples) != 1 || samples[0].Capacity != 49 {
+		t.Errorf("expected only the new sample, got %+v", samples)
+	}
+}
+
+func TestHistory_Corrupt(t *testing.T) {
+	dir, err := ioutil.TempDir("", "barbara-history")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.RemoveAll(dir)
+
+	fileName := filepath.Join(dir, "battery-BAT0.history")
+	history := NewHistory(fileName)
+
+	start := time.Unix(1527843600, 0)
+
+	err = history.Record(start, Info{Capacity: 50})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A header claiming a huge size must not be trusted, or reading it would use all the memory.
+	header := historyHeader{Size: 0x7fffffff, Next: 1, Count: 1}
+	copy(header.Magic[:], historyMagic)
+
+	file, err := os.OpenFile(fileName, os.O_RDWR, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = writeHistoryHeader(file, header)
+	file.Close()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	samples, err := history.Since(start)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(samples) != 0 {
+		t.Errorf("expected no samples from a corrupt file, got %+v", samples)
+	}
+
+	// The file is reset when the next sample is recorded.
+	err = history.Record(start.Add(HistoryInterval), Info{Capacity: 49})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	samples, err = history.Since(start)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(samples) != 1 || samples[0].Capacity != 49 {
+		t.Errorf("expected only the new sample, got %+v", samples)
+	}
+}
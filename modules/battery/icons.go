@@ -0,0 +1,124 @@
+package battery
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"sort"
+	"text/template"
+)
+
+const (
+	// IconTypeImage shows icons from the icon theme.
+	IconTypeImage = "image"
+	// IconTypeGlyph shows icons as text, e.g. using an icon font.
+	IconTypeGlyph = "glyph"
+
+	// DefaultIconSize is the default size of the battery icon, in pixels.
+	DefaultIconSize = 24
+)
+
+// defaultIconLevels are the icons used if none are configured, named as in most icon themes.
+var defaultIconLevels = []IconLevelConfig{
+	{Min: 100, Icon: "battery-full", Charging: "battery-full-charging"},
+	{Min: 66, Icon: "battery-good", Charging: "battery-good-charging"},
+	{Min: 33, Icon: "battery-medium", Charging: "battery-medium-charging"},
+	{Min: 1, Icon: "battery-low", Charging: "battery-low-charging"},
+	{Min: 0, Icon: "battery-empty", Charging: "battery-empty-charging"},
+}
+
+// iconData is the data that icon name templates are executed with. It's the same as the data given
+// to format templates, with the addition of the battery's level rounded down to the nearest 10, as
+// that's how themes like Adwaita name their icons, e.g. "battery-level-40-charging-symbolic".
+type iconData struct {
+	formatData
+
+	Level int
+}
+
+// iconPicker picks which icon to show for a battery, using the configured icon mapping.
+type iconPicker struct {
+	config    IconsConfig
+	templates map[string]*template.Template
+}
+
+// newIconPicker returns a new iconPicker instance, parsing the icon names in the given config,
+// which may be templates.
+func newIconPicker(config IconsConfig) (*iconPicker, error) {
+	p := &iconPicker{
+		config:    config,
+		templates: make(map[string]*template.Template),
+	}
+
+	names := []string{config.Full, config.Critical}
+	for _, level := range config.Levels {
+		names = append(names, level.Icon, level.Charging)
+	}
+
+	for _, name := range names {
+		if _, ok := p.templates[name]; ok || name == "" {
+			continue
+		}
+
+		tmpl, err := template.New(name).Funcs(formatFuncs).Parse(name)
+		if err != nil {
+			return nil, fmt.Errorf("battery: invalid icon %q: %v", name, err)
+		}
+
+		p.templates[name] = tmpl
+	}
+
+	// Levels are checked from the highest to the lowest, so the order they're configured in doesn't
+	// matter.
+	sort.SliceStable(p.config.Levels, func(i, j int) bool {
+		return p.config.Levels[i].Min > p.config.Levels[j].Min
+	})
+
+	return p, nil
+}
+
+// pick returns the icons to show for the given battery, at the given level, in order of preference.
+// Themes don't always have every variant of an icon, so the plain icon for the battery's level is
+// returned after any charging, full, or critical variant.
+func (p *iconPicker) pick(info Info, level Level) ([]string, error) {
+	var names []string
+
+	switch {
+	case info.IsFull() && p.config.Full != "":
+		names = append(names, p.config.Full)
+	case level == LevelCritical && p.config.Critical != "":
+		names = append(names, p.config.Critical)
+	}
+
+	for _, iconLevel := range p.config.Levels {
+		if info.Capacity < iconLevel.Min {
+			continue
+		}
+
+		if info.IsCharging() && iconLevel.Charging != "" {
+			names = append(names, iconLevel.Charging)
+		}
+
+		names = append(names, iconLevel.Icon)
+		break
+	}
+
+	data := iconData{
+		formatData: newFormatData(info),
+		Level:      int(math.Floor(info.Capacity/10)) * 10,
+	}
+
+	icons := make([]string, 0, len(names))
+	for _, name := range names {
+		var buf bytes.Buffer
+
+		err := p.templates[name].Execute(&buf, data)
+		if err != nil {
+			return nil, err
+		}
+
+		icons = append(icons, buf.String())
+	}
+
+	return icons, nil
+}
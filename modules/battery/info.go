@@ -1,18 +1,272 @@
 package battery
 
-// powerSupplyPath is the base path on a Linux system where battery information can be found.
-const powerSupplyPath = "/sys/class/power_supply"
+const (
+	// ServiceKind is the kind of service that InfoNotifier instances using the sysfs Backend are
+	// registered as.
+	ServiceKind = "battery"
+	// UPowerServiceKind is the kind of service that InfoNotifier instances using the UPower Backend
+	// are registered as.
+	UPowerServiceKind = "battery-upower"
+
+	// DefaultSysfsRoot is where sysfs is mounted on a Linux system.
+	DefaultSysfsRoot = "/sys"
+
+	// powerSupplyPath is the path, relative to the sysfs root, where battery information can be
+	// found.
+	powerSupplyPath = "class/power_supply"
+)
+
+// Battery statuses, as found in a power supply's status attribute.
+const (
+	StatusCharging    = "Charging"
+	StatusDischarging = "Discharging"
+	StatusFull        = "Full"
+	StatusNotCharging = "Not charging"
+	StatusUnknown     = "Unknown"
+)
 
 // Info contains all information that we need in the battery module. Some of this information is
 // shown on the menu popup.
+//
+// Batteries report their levels either as charge (in µAh, with the rate in µA), or as energy (in
+// µWh, with the rate in µW). Only one of the two families is usually available, so the methods on
+// Info should be used instead of reading either family directly.
 type Info struct {
-	Capacity         float64 // capacity
-	ChargeFull       float64 // charge_full
-	ChargeFullDesign float64 // charge_full_design
-	ChargeNow        float64 // charge_now
-	CurrentNow       float64 // current_now
-	Manufacturer     string  // manufacturer
-	ModelName        string  // model_name
-	Status           string  // status
-	Technology       string  // technology
+	Name                 string  // The name of the power supply, e.g. BAT0.
+	Capacity             float64 // capacity
+	CapacityLevel        string  // capacity_level
+	ChargeEndThreshold   float64 // charge_control_end_threshold
+	ChargeStartThreshold float64 // charge_control_start_threshold
+	ChargeFull           float64 // charge_full
+	ChargeFullDesign     float64 // charge_full_design
+	ChargeNow            float64 // charge_now
+	CurrentNow           float64 // current_now
+	CycleCount           float64 // cycle_count
+	EnergyFull           float64 // energy_full
+	EnergyFullDesign     float64 // energy_full_design
+	EnergyNow            float64 // energy_now
+	PowerNow             float64 // power_now
+	VoltageMinDesign     float64 // voltage_min_design
+	VoltageNow           float64 // voltage_now
+	Manufacturer         string  // manufacturer
+	ModelName            string  // model_name
+	Status               string  // status
+	Technology           string  // technology
+
+	// HasChargeStartThreshold is true if the battery has a start threshold, as well as an end
+	// threshold. Many drivers only support an end threshold, in which case the battery starts
+	// charging whenever it's below the end threshold.
+	HasChargeStartThreshold bool
+
+	// HasCapacity is true if the capacity is known. Peripherals that only report a capacity level
+	// may report it as "Unknown" (e.g. while they're connecting), in which case Capacity is 0, but
+	// shouldn't be taken to mean that the battery is empty.
+	HasCapacity bool
+
+	// Estimate is the estimated time remaining, calculated from recent samples by the InfoNotifier,
+	// rather than read from the battery.
+	Estimate Estimate
+}
+
+// IsCharging returns true if the battery is charging.
+func (i Info) IsCharging() bool {
+	return i.Status == StatusCharging
+}
+
+// IsFull returns true if the battery is full, or is at 100% and not being used.
+func (i Info) IsFull() bool {
+	return i.Status == StatusFull || (i.Capacity >= 100 && i.Status != StatusDischarging)
+}
+
+// Health returns the battery's full charge as a percentage of it's design charge, i.e. how much of
+// it's original capacity it has left. If the battery doesn't report it's design charge, false is
+// returned.
+func (i Info) Health() (float64, bool) {
+	full, design := i.ChargeFull, i.ChargeFullDesign
+	if i.EnergyFull > 0 {
+		full, design = i.EnergyFull, i.EnergyFullDesign
+	}
+
+	if full <= 0 || design <= 0 {
+		return 0, false
+	}
+
+	return full / design * 100, true
+}
+
+// HasChargeThresholds returns true if the battery supports limiting how much it's charged. Not
+// every battery that does also has a start threshold, see HasChargeStartThreshold.
+func (i Info) HasChargeThresholds() bool {
+	return i.ChargeEndThreshold > 0
+}
+
+// Watts returns the rate that the battery is charging or discharging at, in watts. If the rate is
+// unknown, zero is returned.
+func (i Info) Watts() float64 {
+	if i.PowerNow > 0 {
+		return i.PowerNow / 1e6
+	}
+
+	// µA * µV = pW.
+	return i.CurrentNow * i.voltage() / 1e12
+}
+
+// levels returns the current level, full level, and rate of the battery, all in the same family of
+// units, so that they can be compared. Energy is preferred, as it's what's left that matters.
+func (i Info) levels() (now, full, rate float64) {
+	if i.EnergyFull > 0 {
+		rate = i.PowerNow
+		if rate <= 0 && i.voltage() > 0 {
+			// Some batteries report energy, but only report the current.
+			rate = i.CurrentNow * i.voltage() / 1e6
+		}
+
+		return i.EnergyNow, i.EnergyFull, rate
+	}
+
+	rate = i.CurrentNow
+	if rate <= 0 && i.voltage() > 0 {
+		// Some batteries report charge, but only report the power.
+		rate = i.PowerNow / i.voltage() * 1e6
+	}
+
+	return i.ChargeNow, i.ChargeFull, rate
+}
+
+// energy returns the battery's levels and rate as energy (µWh, and µW), converting from charge
+// using the battery's voltage if necessary. If the battery only reports charge, and doesn't report
+// it's voltage, false is returned.
+func (i Info) energy() (now, full, design, power float64, ok bool) {
+	if i.EnergyFull > 0 {
+		_, _, power = i.levels()
+		return i.EnergyNow, i.EnergyFull, i.EnergyFullDesign, power, true
+	}
+
+	voltage := i.voltage()
+	if voltage <= 0 {
+		return 0, 0, 0, 0, false
+	}
+
+	// µAh * µV / 1e6 = µWh.
+	_, _, current := i.levels()
+
+	return i.ChargeNow * voltage / 1e6,
+		i.ChargeFull * voltage / 1e6,
+		i.ChargeFullDesign * voltage / 1e6,
+		current * voltage / 1e6,
+		true
+}
+
+// voltage returns the voltage of the battery, in µV, preferring the design voltage, as that's what
+// the kernel uses to convert between charge and energy.
+func (i Info) voltage() float64 {
+	if i.VoltageMinDesign > 0 {
+		return i.VoltageMinDesign
+	}
+
+	return i.VoltageNow
+}
+
+// Update is sent by an InfoNotifier when battery information has been read.
+type Update struct {
+	// Batteries holds the Info for each battery, sorted by name.
+	Batteries []Info
+	// Total is all of the batteries combined, as if they were one battery.
+	Total Info
+}
+
+// Aggregate combines the given battery information, as if it were all one battery. Charge or energy
+// values are summed, and the capacity is calculated from the summed values, so that larger
+// batteries count for more. If any battery is charging, the combined battery is charging.
+func Aggregate(infos []Info) Info {
+	if len(infos) == 1 {
+		return infos[0]
+	}
+
+	total := Info{
+		Name:   "total",
+		Status: StatusUnknown,
+	}
+
+	if len(infos) == 0 {
+		return total
+	}
+
+	var capacitySum float64
+	var full, charging, discharging int
+
+	for _, info := range infos {
+		capacitySum += info.Capacity
+		total.HasCapacity = total.HasCapacity || info.HasCapacity
+
+		switch info.Status {
+		case StatusCharging:
+			charging++
+		case StatusDischarging:
+			discharging++
+		case StatusFull:
+			full++
+		}
+	}
+
+	total.Capacity = capacitySum / float64(len(infos))
+
+	if allCharge(infos) {
+		for _, info := range infos {
+			_, _, current := info.levels()
+
+			total.ChargeFull += info.ChargeFull
+			total.ChargeFullDesign += info.ChargeFullDesign
+			total.ChargeNow += info.ChargeNow
+			total.CurrentNow += current
+			total.PowerNow += info.Watts() * 1e6
+		}
+
+		if total.ChargeFull > 0 {
+			total.Capacity = total.ChargeNow / total.ChargeFull * 100
+		}
+	} else {
+		// Batteries using different units, or that use energy, are combined as energy, as it's
+		// the only way to compare batteries with different voltages.
+		for _, info := range infos {
+			energyNow, energyFull, energyFullDesign, powerNow, ok := info.energy()
+			if !ok {
+				continue
+			}
+
+			total.EnergyFull += energyFull
+			total.EnergyFullDesign += energyFullDesign
+			total.EnergyNow += energyNow
+			total.PowerNow += powerNow
+		}
+
+		if total.EnergyFull > 0 {
+			total.Capacity = total.EnergyNow / total.EnergyFull * 100
+		}
+	}
+
+	switch {
+	case charging > 0:
+		total.Status = StatusCharging
+	case discharging > 0:
+		total.Status = StatusDischarging
+	case full == len(infos):
+		total.Status = StatusFull
+	default:
+		// Some batteries may be sitting idle, not charging, which is still useful to show.
+		total.Status = infos[0].Status
+	}
+
+	return total
+}
+
+// allCharge returns true if all of the given batteries report their levels as charge.
+func allCharge(infos []Info) bool {
+	for _, info := range infos {
+		if info.EnergyFull > 0 || info.ChargeFull <= 0 {
+			return false
+		}
+	}
+
+	return true
 }
@@ -2,112 +2,261 @@ package battery
 
 import (
 	"context"
+	"log"
+	"path/filepath"
 	"sync"
 	"time"
+
+	"github.com/seeruk/barbara/barbara"
+)
+
+const (
+	// pollInterval is how often battery information is read when changes can't be watched.
+	pollInterval = 5 * time.Second
+	// fallbackPollInterval is how often battery information is read when changes are watched. Not
+	// every change is signalled (e.g. capacity slowly dropping), so we still poll.
+	fallbackPollInterval = time.Minute
+	// startReadTimeout is how long Start waits for battery information to be read the first time.
+	// Modules are usually rendered on the main thread straight after starting the InfoNotifier, so
+	// a slow Backend (e.g. UPower not responding) mustn't hold them up for long.
+	startReadTimeout = 250 * time.Millisecond
 )
 
 // InfoNotifier is a type used to propagate battery information to types that want to be notified of
-// new battery status information.
-// TODO(elliot): Use file notification, e.g. inotify, instead of time intervals - of course!
+// new battery status information. Information is read from a Backend whenever it signals a change
+// (e.g. when a charger is plugged in or unplugged), and on an interval.
 type InfoNotifier struct {
 	// TODO(elliot): Logger.
-	// TODO(elliot): Do we share a filesystem watcher too? Maybe not.
-	reader *InfoReader
+	backend Backend
 
-	ctx context.Context
-	cfn context.CancelFunc
+	ctx       context.Context
+	cfn       context.CancelFunc
+	refreshCh chan struct{}
 
-	cs   []chan<- Info
+	cs   []chan<- Update
 	csMu *sync.Mutex
+	last *Update
 	ps   string
+
+	// history records the combined battery's information over time, if enabled.
+	history *History
+
+	// Estimators are kept for each battery by name, and for the combined battery, so that each has
+	// it's own window of samples.
+	estimators     map[string]*estimator
+	totalEstimator *estimator
 }
 
-// NewInfoNotifier returns a new InfoNotifier instance.
-func NewInfoNotifier(powerSupply string) *InfoNotifier {
+// NewInfoNotifier returns a new InfoNotifier instance, for the power supply with the given name (or
+// every battery, if the name is PowerSupplyAuto), read using the given Backend. If a History is
+// given, the combined battery's information is recorded to it.
+func NewInfoNotifier(backend Backend, powerSupply string, history *History) *InfoNotifier {
 	return &InfoNotifier{
-		csMu: &sync.Mutex{},
-		ps:   powerSupplyPath + "/" + powerSupply,
+		backend:        backend,
+		history:        history,
+		refreshCh:      make(chan struct{}, 1),
+		csMu:           &sync.Mutex{},
+		ps:             powerSupply,
+		estimators:     make(map[string]*estimator),
+		totalEstimator: &estimator{},
 	}
 }
 
 // Notify adds another channel that should be notified when new battery information is available. It
-// will be given the updated Info.
-func (n *InfoNotifier) Notify(c chan<- Info) {
+// will be given an Update. If battery information has already been read, the channel is
+// given it straight away. Channels should be buffered; if a channel isn't ready to receive, the
+// update is skipped for that channel, rather than holding up everything else.
+func (n *InfoNotifier) Notify(c chan<- Update) {
 	n.csMu.Lock()
 	defer n.csMu.Unlock()
 
 	n.cs = append(n.cs, c)
+
+	if n.last != nil {
+		send(c, *n.last)
+	}
 }
 
-// Start begins a background process
-func (n *InfoNotifier) Start() {
+// Last returns the battery information that was read most recently. If battery information hasn't
+// been read yet, false is returned.
+func (n *InfoNotifier) Last() (Update, bool) {
+	n.csMu.Lock()
+	defer n.csMu.Unlock()
+
+	if n.last == nil {
+		return Update{}, false
+	}
+
+	return *n.last, true
+}
+
+// Unnotify removes a channel previously passed to Notify, so that it's no longer notified.
+func (n *InfoNotifier) Unnotify(c chan<- Update) {
+	n.csMu.Lock()
+	defer n.csMu.Unlock()
+
+	for i, ch := range n.cs {
+		if ch == c {
+			n.cs = append(n.cs[:i], n.cs[i+1:]...)
+			return
+		}
+	}
+}
+
+// Start begins a background process that reads battery information when the Backend signals a
+// change, and on an interval, notifying all listening channels each time. Battery information is
+// read once straight away, and Start waits a short time for it, so that it's usually available
+// from Last as soon as Start returns. If the Backend can't watch for changes, the interval is
+// shortened.
+func (n *InfoNotifier) Start() error {
 	n.ctx, n.cfn = context.WithCancel(context.Background())
 
-	// TODO(elliot): Configurable interval.
-	ticker := time.NewTicker(10 * time.Second)
+	read := make(chan struct{})
+
+	go func(ctx context.Context) {
+		n.doNotify()
+		close(read)
+
+		interval := fallbackPollInterval
+
+		changes, err := n.backend.Watch(ctx)
+		if err != nil {
+			log.Printf("battery: falling back to polling: %v\n", err)
+			interval = pollInterval
+		}
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
 
-	go func() {
 		for {
-			// TODO(elliot): Case for status update from fs notifications.
 			select {
-			case <-n.ctx.Done():
-				// TODO(elliot): Probably log here.
+			case <-ctx.Done():
 				return
+			case _, ok := <-changes:
+				if !ok {
+					// The Backend has stopped watching, stop receiving from it. Nil channels
+					// block forever, leaving only the ticker.
+					changes = nil
+					continue
+				}
+
+				n.doNotify()
+			case <-n.refreshCh:
+				n.doNotify()
 			case <-ticker.C:
 				n.doNotify()
 			}
 		}
-	}()
+	}(n.ctx)
+
+	select {
+	case <-read:
+	case <-time.After(startReadTimeout):
+		log.Println("battery: reading battery information is slow, continuing in the background")
+	}
+
+	return nil
+}
+
+// Refresh reads the battery information again as soon as possible, instead of waiting for a change,
+// e.g. after changing a battery's settings. This method doesn't block.
+func (n *InfoNotifier) Refresh() {
+	notifyChange(n.refreshCh)
+}
+
+// History returns the History that this InfoNotifier records battery information to, or nil if
+// battery information isn't being recorded.
+func (n *InfoNotifier) History() *History {
+	return n.history
 }
 
 // Stop attempts to stop the background processes started by this InfoNotifier.
-func (n *InfoNotifier) Stop() {
+func (n *InfoNotifier) Stop() error {
 	if n.ctx == nil || n.cfn == nil {
-		return
+		return nil
 	}
 
 	n.cfn()
 	n.ctx = nil
 	n.cfn = nil
+
+	return nil
 }
 
-// doNotify actually propagates the battery information to "listener" channels.
+// doNotify reads the battery information, and propagates it to "listener" channels.
 func (n *InfoNotifier) doNotify() {
+	update, err := n.backend.Read(n.ps)
+	if err != nil {
+		log.Println(err)
+		return
+	}
+
+	now := time.Now()
+
+	n.estimate(&update, now)
+
+	if n.history != nil {
+		if err := n.history.Record(now, update.Total); err != nil {
+			log.Println(err)
+		}
+	}
+
 	n.csMu.Lock()
 	defer n.csMu.Unlock()
 
-	// TODO(elliot): Read info...
-	info := Info{}
+	n.last = &update
 
 	// Notify all listening channels.
 	for _, c := range n.cs {
-		c <- info
+		send(c, update)
 	}
 }
 
-// InfoNotifierFactory is a type that keeps track of the instantiated battery InfoNotifier types. If
-// the something wants to be notified about battery info for a power supply that's already had an
-// InfoNotifier created for it, then we will re-use that existing notifier as it's more efficient.
-type InfoNotifierFactory struct {
-	infoNotifiers map[string]*InfoNotifier
-}
+// estimate adds the given Update to each battery's window of samples, taken at the given time, and
+// sets each battery's estimated time remaining. Batteries that have been removed are forgotten.
+func (n *InfoNotifier) estimate(update *Update, now time.Time) {
+	seen := make(map[string]bool, len(update.Batteries))
+
+	for i, info := range update.Batteries {
+		e, ok := n.estimators[info.Name]
+		if !ok {
+			e = &estimator{}
+			n.estimators[info.Name] = e
+		}
+
+		update.Batteries[i].Estimate = e.add(now, info)
+		seen[info.Name] = true
+	}
 
-// NewInfoNotifierFactory returns a new InfoNotifierFactory instance.
-func NewInfoNotifierFactory() *InfoNotifierFactory {
-	return &InfoNotifierFactory{
-		infoNotifiers: make(map[string]*InfoNotifier),
+	for name := range n.estimators {
+		if !seen[name] {
+			delete(n.estimators, name)
+		}
 	}
+
+	update.Total.Estimate = n.totalEstimator.add(now, update.Total)
 }
 
-// Build will create or re-use InfoNotifier instances. New ones will be created if the power supply
-// passed in has not already had an InfoNotifier created for it before.
-//
-// TODO(elliot): How do we destroy these if they're no longer used? Maybe we can hook into events to
-// wipe out the map, and stop background processes in the Notifiers? This is a pretty critical one.
-func (f *InfoNotifierFactory) Build(powerSupply string) *InfoNotifier {
-	if _, ok := f.infoNotifiers[powerSupply]; !ok {
-		f.infoNotifiers[powerSupply] = NewInfoNotifier(powerSupply)
+// send sends the given Update to the given channel, unless the channel isn't ready to receive.
+func send(c chan<- Update, update Update) {
+	select {
+	case c <- update:
+	default:
 	}
+}
 
-	return f.infoNotifiers[powerSupply]
+// NewInfoNotifierConstructor returns a barbara.ServiceConstructorFunc that creates InfoNotifier
+// instances that read battery information from the given Backend. The InfoNotifier services are
+// named after the power supply they watch. If a history directory is given, each InfoNotifier
+// records battery information to a file in it, named after the power supply. Constructors for
+// different backends must be given different history directories.
+func NewInfoNotifierConstructor(backend Backend, historyDir string) barbara.ServiceConstructorFunc {
+	return func(powerSupply string) (barbara.Service, error) {
+		var history *History
+		if historyDir != "" {
+			history = NewHistory(filepath.Join(historyDir, "battery-"+powerSupply+".history"))
+		}
+
+		return NewInfoNotifier(backend, powerSupply, history), nil
+	}
 }
@@ -1,3 +1,220 @@
 package battery
 
-type InfoReader struct{}
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// InfoReader reads battery information from sysfs.
+type InfoReader struct {
+	sysfsRoot string
+}
+
+// NewInfoReader returns a new InfoReader instance, reading power supplies found under the given
+// sysfs root, which is usually DefaultSysfsRoot.
+func NewInfoReader(sysfsRoot string) *InfoReader {
+	return &InfoReader{
+		sysfsRoot: sysfsRoot,
+	}
+}
+
+// capacityLevels maps the coarse capacity levels that some power supplies report instead of a
+// capacity to an approximate percentage.
+var capacityLevels = map[string]float64{
+	"Full":     100,
+	"High":     80,
+	"Normal":   50,
+	"Low":      20,
+	"Critical": 5,
+}
+
+// Read reads all information about the power supply with the given name. Every attribute is read,
+// even if some fail, so the returned Info may be partially filled in alongside an error. Attributes
+// that a battery doesn't have are left empty, unless they're required.
+func (r *InfoReader) Read(powerSupply string) (Info, error) {
+	return r.read(powerSupply, false)
+}
+
+// ReadDevice reads all information about the peripheral power supply with the given name, in the
+// same way as Read. Peripherals often only report a capacity level (e.g. "Low"), in which case the
+// capacity is approximated from it. If the level is "Unknown", Info.HasCapacity is false.
+func (r *InfoReader) ReadDevice(powerSupply string) (Info, error) {
+	return r.read(powerSupply, true)
+}
+
+// read reads all information about the power supply with the given name. The capacity is only
+// required if the power supply isn't a peripheral.
+func (r *InfoReader) read(powerSupply string, device bool) (Info, error) {
+	info := Info{Name: powerSupply}
+
+	dir := filepath.Join(r.sysfsRoot, powerSupplyPath, powerSupply)
+
+	floats := []struct {
+		attribute string
+		required  bool
+		value     *float64
+	}{
+		{"capacity", !device, &info.Capacity},
+		{"charge_control_end_threshold", false, &info.ChargeEndThreshold},
+		{"charge_control_start_threshold", false, &info.ChargeStartThreshold},
+		{"charge_full", false, &info.ChargeFull},
+		{"charge_full_design", false, &info.ChargeFullDesign},
+		{"charge_now", false, &info.ChargeNow},
+		{"current_now", false, &info.CurrentNow},
+		{"cycle_count", false, &info.CycleCount},
+		{"energy_full", false, &info.EnergyFull},
+		{"energy_full_design", false, &info.EnergyFullDesign},
+		{"energy_now", false, &info.EnergyNow},
+		{"power_now", false, &info.PowerNow},
+		{"voltage_min_design", false, &info.VoltageMinDesign},
+		{"voltage_now", false, &info.VoltageNow},
+	}
+
+	strs := []struct {
+		attribute string
+		required  bool
+		value     *string
+	}{
+		{"capacity_level", false, &info.CapacityLevel},
+		{"manufacturer", false, &info.Manufacturer},
+		{"model_name", false, &info.ModelName},
+		{"status", true, &info.Status},
+		{"technology", false, &info.Technology},
+	}
+
+	readErr := &ReadError{PowerSupply: powerSupply}
+
+	for _, attr := range floats {
+		value, err := readFloatAttribute(dir, attr.attribute, attr.required)
+		if err != nil {
+			readErr.Errs = append(readErr.Errs, err)
+		}
+
+		*attr.value = value
+	}
+
+	for _, attr := range strs {
+		value, err := readAttribute(dir, attr.attribute, attr.required)
+		if err != nil {
+			readErr.Errs = append(readErr.Errs, err)
+		}
+
+		*attr.value = value
+	}
+
+	// A capacity of 0 is valid, so whether the capacity is known depends on the attribute existing.
+	_, err := os.Stat(filepath.Join(dir, "capacity"))
+	info.HasCapacity = err == nil
+
+	// Likewise, a start threshold of 0 is valid, and some drivers only have an end threshold.
+	_, err = os.Stat(filepath.Join(dir, "charge_control_start_threshold"))
+	info.HasChargeStartThreshold = err == nil && info.HasChargeThresholds()
+
+	if level, ok := capacityLevels[info.CapacityLevel]; ok && !info.HasCapacity {
+		info.Capacity = level
+		info.HasCapacity = true
+	}
+
+	if len(readErr.Errs) > 0 {
+		return info, readErr
+	}
+
+	return info, nil
+}
+
+// Discover returns the names of all of the batteries in the system, sorted by name. Batteries in
+// peripherals (e.g. wireless mice) aren't included, only batteries that power the system itself.
+func (r *InfoReader) Discover() ([]string, error) {
+	return r.discover(false)
+}
+
+// DiscoverDevices returns the names of all of the batteries in peripherals (e.g. wireless mice,
+// keyboards, and headsets), sorted by name.
+func (r *InfoReader) DiscoverDevices() ([]string, error) {
+	return r.discover(true)
+}
+
+// discover returns the names of either all of the system batteries, or all of the peripheral
+// batteries, sorted by name.
+func (r *InfoReader) discover(devices bool) ([]string, error) {
+	dir := filepath.Join(r.sysfsRoot, powerSupplyPath)
+
+	file, err := os.Open(dir)
+	if err != nil {
+		return nil, fmt.Errorf("battery: failed to discover batteries: %v", err)
+	}
+
+	defer file.Close()
+
+	names, err := file.Readdirnames(-1)
+	if err != nil {
+		return nil, fmt.Errorf("battery: failed to discover batteries: %v", err)
+	}
+
+	var batteries []string
+	for _, name := range names {
+		// Errors are ignored here, a power supply we can't read isn't one we can show anyway.
+		supplyType, _ := readAttribute(filepath.Join(dir, name), "type", false)
+		scope, _ := readAttribute(filepath.Join(dir, name), "scope", false)
+
+		if supplyType == "Battery" && (scope == "Device") == devices {
+			batteries = append(batteries, name)
+		}
+	}
+
+	sort.Strings(batteries)
+
+	return batteries, nil
+}
+
+// ReadError is returned when one or more attributes of a power supply couldn't be read.
+type ReadError struct {
+	PowerSupply string
+	Errs        []error
+}
+
+// Error returns a string representation of this ReadError.
+func (e *ReadError) Error() string {
+	msgs := make([]string, 0, len(e.Errs))
+	for _, err := range e.Errs {
+		msgs = append(msgs, err.Error())
+	}
+
+	return fmt.Sprintf("battery: failed to read power supply %q: %s", e.PowerSupply, strings.Join(msgs, "; "))
+}
+
+// readAttribute reads the value of the sysfs attribute with the given name in the given directory.
+// If the attribute doesn't exist, and isn't required, an empty string is returned.
+func readAttribute(dir, attribute string, required bool) (string, error) {
+	bs, err := ioutil.ReadFile(filepath.Join(dir, attribute))
+	if os.IsNotExist(err) && !required {
+		return "", nil
+	}
+
+	if err != nil {
+		return "", fmt.Errorf("%s: %v", attribute, err)
+	}
+
+	return strings.TrimSpace(string(bs)), nil
+}
+
+// readFloatAttribute reads the value of the sysfs attribute with the given name in the given
+// directory as a float. If the attribute doesn't exist, and isn't required, zero is returned.
+func readFloatAttribute(dir, attribute string, required bool) (float64, error) {
+	str, err := readAttribute(dir, attribute, required)
+	if err != nil || str == "" {
+		return 0, err
+	}
+
+	flt, err := strconv.ParseFloat(str, 64)
+	if err != nil {
+		return 0, fmt.Errorf("%s: invalid value %q", attribute, str)
+	}
+
+	return flt, nil
+}
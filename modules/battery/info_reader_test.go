@@ -0,0 +1,201 @@
+package battery
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestInfoReader_Read(t *testing.T) {
+	reader := NewInfoReader(testSysfsRoot)
+
+	tests := []struct {
+		name        string
+		powerSupply string
+		expected    Info
+	}{
+		{
+			name:        "charge",
+			powerSupply: "BAT0",
+			expected: Info{
+				Name:                 "BAT0",
+				Capacity:             72,
+				HasCapacity:          true,
+				ChargeEndThreshold:   80,
+				ChargeStartThreshold: 60,
+				ChargeFull:           3950000,
+				ChargeFullDesign:     4400000,
+				ChargeNow:            2844000,
+				CurrentNow:           1080000,
+				CycleCount:           187,
+				VoltageMinDesign:     11400000,
+				VoltageNow:           12100000,
+				Manufacturer:         "SMP",
+				ModelName:            "01AV430",
+				Status:               StatusDischarging,
+				Technology:           "Li-poly",
+
+				HasChargeStartThreshold: true,
+			},
+		},
+		{
+			// BAT1 only has an end threshold, like many laptops.
+			name:        "energy",
+			powerSupply: "BAT1",
+			expected: Info{
+				Name:               "BAT1",
+				Capacity:           95,
+				HasCapacity:        true,
+				ChargeEndThreshold: 80,
+				EnergyFull:         21660000,
+				EnergyFullDesign:   22800000,
+				EnergyNow:          20577000,
+				VoltageMinDesign:   11400000,
+				Manufacturer:       "SMP",
+				ModelName:          "01AV421",
+				Status:             StatusDischarging,
+				Technology:         "Li-ion",
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			info, err := reader.Read(test.powerSupply)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !reflect.DeepEqual(info, test.expected) {
+				t.Errorf("expected %+v, got %+v", test.expected, info)
+			}
+		})
+	}
+}
+
+func TestInfoReader_Read_CapacityRequired(t *testing.T) {
+	reader := NewInfoReader(testSysfsRoot)
+
+	// The mouse only reports a capacity level, which is fine for a peripheral, but not a battery.
+	_, err := reader.Read("hidpp_battery_0")
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+
+	if !strings.Contains(err.Error(), "capacity: ") {
+		t.Errorf("expected the missing capacity to be reported, got %q", err)
+	}
+}
+
+func TestInfoReader_Read_Errors(t *testing.T) {
+	reader := NewInfoReader(testSysfsRoot)
+
+	info, err := reader.Read("broken")
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+
+	readErr, ok := err.(*ReadError)
+	if !ok {
+		t.Fatalf("expected a *ReadError, got %T", err)
+	}
+
+	if readErr.PowerSupply != "broken" {
+		t.Errorf("expected power supply %q, got %q", "broken", readErr.PowerSupply)
+	}
+
+	// Both the invalid capacity, and the missing status should be reported, not just the first.
+	if len(readErr.Errs) != 2 {
+		t.Fatalf("expected 2 errors, got %d: %v", len(readErr.Errs), readErr.Errs)
+	}
+
+	for i, prefix := range []string{"capacity: invalid value", "status: "} {
+		if !strings.HasPrefix(readErr.Errs[i].Error(), prefix) {
+			t.Errorf("expected error %d to start with %q, got %q", i, prefix, readErr.Errs[i])
+		}
+	}
+
+	// Attributes that could be read are still returned.
+	if info.ChargeFull != 3950000 {
+		t.Errorf("expected charge full %v, got %v", 3950000, info.ChargeFull)
+	}
+}
+
+func TestInfoReader_ReadDevice(t *testing.T) {
+	reader := NewInfoReader(testSysfsRoot)
+
+	tests := []struct {
+		name        string
+		powerSupply string
+		expected    Info
+	}{
+		{
+			name:        "capacity level",
+			powerSupply: "hidpp_battery_0",
+			expected: Info{
+				Name:          "hidpp_battery_0",
+				Capacity:      capacityLevels["Normal"],
+				HasCapacity:   true,
+				CapacityLevel: "Normal",
+				Manufacturer:  "Logitech",
+				ModelName:     "MX Master 3",
+				Status:        StatusDischarging,
+			},
+		},
+		{
+			name:        "unknown capacity level",
+			powerSupply: "hidpp_battery_1",
+			expected: Info{
+				Name:          "hidpp_battery_1",
+				CapacityLevel: "Unknown",
+				Manufacturer:  "Logitech",
+				ModelName:     "K380",
+				Status:        StatusDischarging,
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			info, err := reader.ReadDevice(test.powerSupply)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !reflect.DeepEqual(info, test.expected) {
+				t.Errorf("expected %+v, got %+v", test.expected, info)
+			}
+		})
+	}
+}
+
+func TestInfoReader_Discover(t *testing.T) {
+	tests := []struct {
+		name     string
+		discover func(*InfoReader) ([]string, error)
+		expected []string
+	}{
+		{"batteries", (*InfoReader).Discover, []string{"BAT0", "BAT1"}},
+		{"devices", (*InfoReader).DiscoverDevices, []string{"hidpp_battery_0", "hidpp_battery_1"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			names, err := test.discover(NewInfoReader(testSysfsRoot))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !reflect.DeepEqual(names, test.expected) {
+				t.Errorf("expected %v, got %v", test.expected, names)
+			}
+		})
+	}
+}
+
+func TestInfoReader_Discover_MissingRoot(t *testing.T) {
+	_, err := NewInfoReader("testdata/missing").Discover()
+	if err == nil {
+		t.Error("expected an error")
+	}
+}
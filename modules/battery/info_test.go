@@ -0,0 +1,141 @@
+package battery
+
+import (
+	"math"
+	"testing"
+)
+
+func TestAggregate(t *testing.T) {
+	reader := NewInfoReader(testSysfsRoot)
+
+	bat0, err := reader.Read("BAT0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	bat1, err := reader.Read("BAT1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	charging := bat0
+	charging.Name = "BAT2"
+	charging.Status = StatusCharging
+
+	full := Info{Name: "BAT3", Capacity: 100, ChargeNow: 1000000, ChargeFull: 1000000, Status: StatusFull, HasCapacity: true}
+
+	tests := []struct {
+		name     string
+		infos    []Info
+		expected Info
+	}{
+		{
+			name:     "none",
+			infos:    nil,
+			expected: Info{Name: "total", Status: StatusUnknown},
+		},
+		{
+			name:     "one",
+			infos:    []Info{bat0},
+			expected: bat0,
+		},
+		{
+			// Both batteries report charge, so they're summed as charge.
+			name:  "charge",
+			infos: []Info{bat0, full},
+			expected: Info{
+				Name:             "total",
+				Capacity:         3844000.0 / 4950000.0 * 100,
+				HasCapacity:      true,
+				ChargeFull:       4950000,
+				ChargeFullDesign: 4400000,
+				ChargeNow:        3844000,
+				CurrentNow:       1080000,
+				PowerNow:         1080000 * 11.4,
+				Status:           StatusDischarging,
+			},
+		},
+		{
+			// BAT1 reports energy, so BAT0's charge is converted using it's design voltage.
+			name:  "energy",
+			infos: []Info{bat0, bat1},
+			expected: Info{
+				Name:             "total",
+				Capacity:         (2844000*11.4 + 20577000) / (3950000*11.4 + 21660000) * 100,
+				HasCapacity:      true,
+				EnergyFull:       3950000*11.4 + 21660000,
+				EnergyFullDesign: 4400000*11.4 + 22800000,
+				EnergyNow:        2844000*11.4 + 20577000,
+				PowerNow:         1080000 * 11.4,
+				Status:           StatusDischarging,
+			},
+		},
+		{
+			name:  "charging",
+			infos: []Info{bat1, charging},
+			expected: Info{
+				Name:             "total",
+				Capacity:         (2844000*11.4 + 20577000) / (3950000*11.4 + 21660000) * 100,
+				HasCapacity:      true,
+				EnergyFull:       3950000*11.4 + 21660000,
+				EnergyFullDesign: 4400000*11.4 + 22800000,
+				EnergyNow:        2844000*11.4 + 20577000,
+				PowerNow:         1080000 * 11.4,
+				Status:           StatusCharging,
+			},
+		},
+		{
+			name:  "full",
+			infos: []Info{full, full},
+			expected: Info{
+				Name:        "total",
+				Capacity:    100,
+				HasCapacity: true,
+				ChargeFull:  2000000,
+				ChargeNow:   2000000,
+				Status:      StatusFull,
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			total := Aggregate(test.infos)
+
+			if total.Name != test.expected.Name {
+				t.Errorf("expected name %q, got %q", test.expected.Name, total.Name)
+			}
+
+			if total.Status != test.expected.Status {
+				t.Errorf("expected status %q, got %q", test.expected.Status, total.Status)
+			}
+
+			if total.HasCapacity != test.expected.HasCapacity {
+				t.Errorf("expected has capacity %v, got %v", test.expected.HasCapacity, total.HasCapacity)
+			}
+
+			values := []struct {
+				name     string
+				actual   float64
+				expected float64
+			}{
+				{"capacity", total.Capacity, test.expected.Capacity},
+				{"charge full", total.ChargeFull, test.expected.ChargeFull},
+				{"charge full design", total.ChargeFullDesign, test.expected.ChargeFullDesign},
+				{"charge now", total.ChargeNow, test.expected.ChargeNow},
+				{"current now", total.CurrentNow, test.expected.CurrentNow},
+				{"energy full", total.EnergyFull, test.expected.EnergyFull},
+				{"energy full design", total.EnergyFullDesign, test.expected.EnergyFullDesign},
+				{"energy now", total.EnergyNow, test.expected.EnergyNow},
+				{"power now", total.PowerNow, test.expected.PowerNow},
+			}
+
+			for _, value := range values {
+				// Charge is converted to energy with floating point maths, so it won't be exact.
+				if math.Abs(value.actual-value.expected) > 1e-6*math.Max(1, math.Abs(value.expected)) {
+					t.Errorf("expected %s %v, got %v", value.name, value.expected, value.actual)
+				}
+			}
+		})
+	}
+}
@@ -4,247 +4,414 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
-	"io/ioutil"
-	"math"
-	"os"
-	"strconv"
+	"log"
 	"strings"
-	"time"
 
 	"github.com/seeruk/barbara/barbara"
+	"github.com/seeruk/barbara/icon"
 	"github.com/therecipe/qt/core"
 	"github.com/therecipe/qt/gui"
 	"github.com/therecipe/qt/widgets"
 )
 
-// Module ...
+// Module is a Barbara Module that shows battery information. It's just the UI component; the
+// battery information itself comes from a shared InfoNotifier service.
 type Module struct {
 	ctx context.Context
 	cfn context.CancelFunc
 
-	config    Config
-	layout    *widgets.QHBoxLayout
+	config      Config
+	serviceKind string
+	alignment   barbara.ModuleAlignment
+	position    barbara.WindowPosition
+	clock       barbara.Clock
+	services    *barbara.ServiceRegistry
+	icons       *icon.Loader
+	formatter   *formatter
+	iconPicker  *iconPicker
+	notifier    *InfoNotifier
+	alerter     *Alerter
+	updateCh    chan Update
+	update      Update
+	layout      *widgets.QHBoxLayout
+	items       []*batteryItem
+	popup       *popup
+}
+
+// batteryItem holds the widgets used to show a single battery.
+type batteryItem struct {
+	icons     *icon.Loader
+	config    IconsConfig
 	iconLabel *widgets.QLabel
 	label     *widgets.QLabel
 }
 
-// NewModule returns a new battery Module instance.
-// TODO(elliot): This is a mess. Let's make a service for battery information, then just use this as
-// the UI component for it, moving all of the actual logic out of here.
-// TODO(elliot): If we're at 100%, probably no need to show a time remaining.
-func NewModule(notifierFactory *InfoNotifierFactory) barbara.ModuleConstructorFunc {
+// NewModuleConstructor returns a barbara.ModuleConstructorFunc that creates battery modules that
+// find their icons using the given icon.Loader.
+func NewModuleConstructor(icons *icon.Loader) barbara.ModuleConstructorFunc {
 	return func(mctx barbara.ModuleContext) (barbara.Module, error) {
-		var config Config
+		return NewModule(mctx, icons)
+	}
+}
+
+// NewModule returns a new battery Module instance.
+func NewModule(mctx barbara.ModuleContext, icons *icon.Loader) (barbara.Module, error) {
+	var config Config
+
+	err := json.Unmarshal(mctx.Config, &config)
+	if err != nil {
+		// TODO(elliot): More context.
+		return nil, err
+	}
+
+	switch config.Mode {
+	case "":
+		config.Mode = ModeAggregate
+	case ModeAggregate, ModePerBattery:
+	default:
+		return nil, fmt.Errorf("battery: invalid mode %q", config.Mode)
+	}
+
+	var serviceKind string
+	switch config.Backend {
+	case "", BackendSysfs:
+		serviceKind = ServiceKind
+	case BackendUPower:
+		serviceKind = UPowerServiceKind
+	default:
+		return nil, fmt.Errorf("battery: invalid backend %q", config.Backend)
+	}
+
+	formatter, err := newFormatter(config.Format)
+	if err != nil {
+		return nil, err
+	}
+
+	err = config.Icons.validate()
+	if err != nil {
+		return nil, err
+	}
+
+	iconPicker, err := newIconPicker(config.Icons)
+	if err != nil {
+		return nil, err
+	}
+
+	if config.Warning == 0 {
+		config.Warning = DefaultWarning
+	}
+
+	if config.Critical == 0 {
+		config.Critical = DefaultCritical
+	}
 
-		err := json.Unmarshal(mctx.Config, &config)
+	err = config.ChargeThresholds.validate()
+	if err != nil {
+		return nil, err
+	}
+
+	if config.CriticalAction != nil {
+		err = config.CriticalAction.validate()
 		if err != nil {
-			// TODO(elliot): More context.
 			return nil, err
 		}
-
-		notifier := notifierFactory.Build(config.PowerSupply)
-		_ = notifier
-
-		return &Module{
-			config: config,
-		}, nil
 	}
+
+	return &Module{
+		config:      config,
+		serviceKind: serviceKind,
+		alignment:   mctx.Alignment,
+		position:    mctx.Window.Position(),
+		clock:       mctx.Clock,
+		services:    mctx.Services,
+		icons:       icons,
+		formatter:   formatter,
+		iconPicker:  iconPicker,
+	}, nil
 }
 
-// Render ...
+// Render acquires the InfoNotifier and Alerter for the configured power supply, and returns a
+// layout showing the battery information it provides, ready to be placed on a bar.
 func (m *Module) Render() (widgets.QLayout_ITF, error) {
-	m.layout = widgets.NewQHBoxLayout()
-	m.iconLabel = widgets.NewQLabel(nil, core.Qt__Widget)
-	m.label = widgets.NewQLabel(nil, core.Qt__Widget)
+	service, err := m.services.Acquire(AlerterServiceKind, m.config.PowerSupply)
+	if err != nil {
+		return nil, err
+	}
 
-	m.ctx, m.cfn = context.WithCancel(context.Background())
-	m.onTick()
+	m.alerter = service.(*Alerter)
+	m.alerter.Configure(m.config)
 
-	statusCh := make(chan struct{}, 1)
+	service, err = m.services.Acquire(m.serviceKind, m.config.PowerSupply)
+	if err != nil {
+		// Don't keep the Alerter running for a module that won't be shown.
+		m.alerter = nil
+		m.services.Release(AlerterServiceKind, m.config.PowerSupply)
 
-	go func() {
-		// TODO(elliot): Config.
-		ticker := time.NewTicker(time.Second)
-		oldStatus := m.getBatteryStatus()
+		return nil, err
+	}
 
-		for {
-			select {
-			case <-m.ctx.Done():
-				ticker.Stop()
-				return
-			case <-ticker.C:
-				status := m.getBatteryStatus()
-				if status != oldStatus {
-					statusCh <- struct{}{}
-				}
+	m.notifier = service.(*InfoNotifier)
 
-				oldStatus = status
-			}
-		}
-	}()
+	m.layout = widgets.NewQHBoxLayout()
+	m.popup = newPopup(m.clock, m.notifier.History(), m.config.ChargeThresholds.Presets, m.onPreset)
 
-	go func() {
-		// TODO(elliot): Config.
-		ticker := time.NewTicker(10 * time.Second)
+	m.ctx, m.cfn = context.WithCancel(context.Background())
+	m.updateCh = make(chan Update, 1)
 
+	go func(ctx context.Context, updateCh <-chan Update) {
 		for {
 			select {
-			case <-m.ctx.Done():
-				ticker.Stop()
+			case <-ctx.Done():
 				return
-			case <-statusCh:
-				fmt.Println("Updating display")
-				m.onTick()
-			case <-ticker.C:
-				m.onTick()
+			case update := <-updateCh:
+				barbara.RunOnMainThread(func() {
+					if ctx.Err() == nil {
+						m.onUpdate(update)
+					}
+				})
 			}
 		}
-	}()
+	}(m.ctx, m.updateCh)
 
-	m.layout.AddWidget(m.iconLabel, 0, core.Qt__AlignJustify)
-	m.layout.AddWidget(m.label, 0, core.Qt__AlignJustify)
+	// Show what's already been read straight away, so the module isn't empty until the first
+	// Update arrives from the background process.
+	if update, ok := m.notifier.Last(); ok {
+		m.onUpdate(update)
+	}
+
+	// Notify after starting to listen, the notifier will send the latest Update straight away.
+	m.notifier.Notify(m.updateCh)
 
 	return m.layout, nil
 }
 
-// Destroy ...
+// Destroy stops background processes, releases the shared services, and frees up resources.
 func (m *Module) Destroy() error {
 	if m.cfn != nil {
 		m.cfn()
 	}
 
-	if m.layout != nil {
-		m.layout.DestroyQHBoxLayout()
+	if m.notifier != nil {
+		m.notifier.Unnotify(m.updateCh)
 	}
 
-	if m.label != nil {
-		m.label.Destroy(true, true)
+	for _, item := range m.items {
+		item.destroy()
 	}
 
-	if m.iconLabel != nil {
-		m.iconLabel.Destroy(true, true)
+	if m.popup != nil {
+		m.popup.destroy()
+	}
+
+	if m.layout != nil {
+		m.layout.DestroyQHBoxLayout()
 	}
 
 	m.ctx = nil
 	m.cfn = nil
+	m.updateCh = nil
+	m.update = Update{}
 	m.layout = nil
-	m.label = nil
-	m.iconLabel = nil
+	m.items = nil
+	m.popup = nil
 
-	return nil
-}
+	var err error
 
-// onTick ...
-func (m *Module) onTick() {
-	status := m.getBatteryStatus()
+	if m.notifier != nil {
+		m.notifier = nil
+		err = m.services.Release(m.serviceKind, m.config.PowerSupply)
+	}
 
-	percentage := m.getBatteryPercentage()
-	labelText := m.getLabelText(percentage, status)
+	if m.alerter != nil {
+		m.alerter = nil
 
-	var iconLevel string
-	switch {
-	case percentage == 100:
-		iconLevel = "full"
-	case percentage >= 66:
-		iconLevel = "good"
-	case percentage >= 33:
-		iconLevel = "medium"
-	case percentage > 0:
-		iconLevel = "low"
-	case percentage == 0:
-		iconLevel = "empty"
-	}
-
-	var iconStatus string
-	if status == "charging" {
-		iconStatus = "-charging"
-	}
-
-	icon := gui.NewQIcon5(fmt.Sprintf(
-		"/usr/share/icons/Paper-Mono-Dark/24x24/panel/battery-%s%s.svg",
-		iconLevel,
-		iconStatus,
-	))
-
-	m.iconLabel.SetPixmap(icon.Pixmap2(24, 24, gui.QIcon__Normal, gui.QIcon__On))
-	m.label.SetText(labelText)
+		alerterErr := m.services.Release(AlerterServiceKind, m.config.PowerSupply)
+		if err == nil {
+			err = alerterErr
+		}
+	}
+
+	return err
 }
 
-// getLabelText ...
-func (m *Module) getLabelText(percentage float64, status string) string {
-	timeRemaining := m.getTimeRemaining(status == "charging")
+// onUpdate updates the UI to show the given battery information, showing either the combined
+// battery, or each battery, depending on the configured mode. It must be called on the main thread.
+func (m *Module) onUpdate(update Update) {
+	m.update = update
+	m.popup.update(update)
 
-	return fmt.Sprintf("%.0f%% (%s)", percentage, timeRemaining)
-}
+	infos := update.Batteries
+	if m.config.Mode == ModeAggregate && len(update.Batteries) > 0 {
+		infos = []Info{update.Total}
+	}
 
-// getBatteryPercentage ...
-func (m *Module) getBatteryPercentage() float64 {
-	return fileToFloat(fmt.Sprintf("%s/%s/capacity", powerSupplyPath, m.config.PowerSupply))
-}
+	// Batteries may have been added or removed, so make sure there's one item for each.
+	for len(m.items) > len(infos) {
+		last := len(m.items) - 1
 
-// getBatteryStatus ...
-func (m *Module) getBatteryStatus() string {
-	status, err := fileToStr(fmt.Sprintf("%s/%s/status", powerSupplyPath, m.config.PowerSupply))
-	if err != nil {
-		return "unknown"
+		m.items[last].destroy()
+		m.items = m.items[:last]
 	}
 
-	return strings.ToLower(status)
-}
+	for len(m.items) < len(infos) {
+		m.items = append(m.items, m.createItem())
+	}
 
-// getTimeRemaining ...
-func (m *Module) getTimeRemaining(isCharging bool) string {
-	ps := m.config.PowerSupply
+	for i, info := range infos {
+		text, err := m.formatter.format(info)
+		if err != nil {
+			log.Printf("battery: failed to format label: %v\n", err)
+			text = "format error"
+		}
 
-	chargeNow := fileToFloat(fmt.Sprintf("%s/%s/charge_now", powerSupplyPath, ps))
-	currentNow := fileToFloat(fmt.Sprintf("%s/%s/current_now", powerSupplyPath, ps))
+		level := m.config.level(info)
 
-	hours := chargeNow / currentNow
+		icons, err := m.iconPicker.pick(info, level)
+		if err != nil {
+			log.Printf("battery: failed to pick icon: %v\n", err)
+		}
 
-	if isCharging {
-		chargeFull := fileToFloat(fmt.Sprintf("%s/%s/charge_full", powerSupplyPath, ps))
+		m.items[i].update(info, level, text, icons)
+	}
 
-		hours = (chargeFull - chargeNow) / currentNow
+	// Alerts are about the system as a whole, so even in per-battery mode, the combined battery
+	// is checked.
+	if len(update.Batteries) > 0 {
+		m.alerter.Check(update.Total)
 	}
+}
+
+// onPreset is the handler for a charge threshold preset being picked in the popup. The thresholds
+// of every battery that supports them are set in the background, as the command may be waiting for
+// the user to authenticate. The popup is then refreshed to show whether it worked.
+func (m *Module) onPreset(preset ChargeThresholdPresetConfig) {
+	var infos []Info
+	for _, info := range m.update.Batteries {
+		if info.HasChargeThresholds() {
+			infos = append(infos, info)
+		}
+	}
+
+	m.popup.setPresetsEnabled(false)
+	m.popup.setStatus("Setting charge thresholds…", "")
+
+	go func(ctx context.Context, notifier *InfoNotifier) {
+		var failed []string
+		var errs []string
+
+		for _, info := range infos {
+			err := setChargeThresholds(m.config.ChargeThresholds.Command, info, preset)
+			if err != nil {
+				log.Println(err)
+
+				failed = append(failed, info.Name)
+				errs = append(errs, err.Error())
+			}
+		}
 
-	minutes := 0.6 * (hours * 100)
-	duration := time.Duration(minutes) * time.Minute
+		notifier.Refresh()
 
-	minutes = duration.Minutes() - (math.Floor(duration.Hours()) * 60)
+		barbara.RunOnMainThread(func() {
+			if ctx.Err() != nil {
+				return
+			}
 
-	return fmt.Sprintf("%02.0f:%02.0f", duration.Hours(), minutes)
+			m.popup.setPresetsEnabled(true)
+
+			if len(failed) > 0 {
+				m.popup.setStatus(
+					fmt.Sprintf("Failed to set charge thresholds of %s", strings.Join(failed, ", ")),
+					strings.Join(errs, "\n"),
+				)
+			} else {
+				m.popup.setStatus("", "")
+			}
+		})
+	}(m.ctx, m.notifier)
 }
 
-// fileToStr ...
-func fileToStr(fileName string) (string, error) {
-	file, err := os.Open(fileName)
-	if err != nil {
-		// TODO(elliot): Context.
-		return "", err
+// createItem creates the widgets used to show a single battery, adding them to the layout.
+func (m *Module) createItem() *batteryItem {
+	item := &batteryItem{
+		icons:     m.icons,
+		config:    m.config.Icons,
+		iconLabel: widgets.NewQLabel(nil, core.Qt__Widget),
+		label:     widgets.NewQLabel(nil, core.Qt__Widget),
 	}
 
-	bs, err := ioutil.ReadAll(file)
-	if err != nil {
-		// TODO(elliot): Context.
-		return "", err
+	if item.config.Type == IconTypeGlyph {
+		font := item.iconLabel.Font()
+		if item.config.Font != "" {
+			font.SetFamily(item.config.Font)
+		}
+
+		font.SetPixelSize(item.config.Size)
+		item.iconLabel.SetFont(font)
 	}
 
-	return strings.TrimSpace(string(bs)), nil
+	item.iconLabel.ConnectMousePressEvent(m.onMousePress(item.iconLabel, item))
+	item.label.ConnectMousePressEvent(m.onMousePress(item.label, item))
+
+	m.layout.AddWidget(item.iconLabel, 0, core.Qt__AlignJustify)
+	m.layout.AddWidget(item.label, 0, core.Qt__AlignJustify)
+
+	return item
+}
+
+// onMousePress returns the mouse press handler for the given label of the given item, used to open
+// the popup when the item is clicked. Other buttons are left alone, so they can still be used for
+// actions.
+func (m *Module) onMousePress(label *widgets.QLabel, item *batteryItem) func(*gui.QMouseEvent) {
+	return func(event *gui.QMouseEvent) {
+		if event.Button() != core.Qt__LeftButton {
+			label.MousePressEventDefault(event)
+			return
+		}
+
+		m.popup.show(item.iconLabel, m.alignment, m.position)
+	}
 }
 
-// fileToFloat ...
-func fileToFloat(fileName string) float64 {
-	// TODO(elliot): Log in here probably?
+// Popup opens the battery details popup, positioned next to the first battery shown.
+func (m *Module) Popup() {
+	if m.popup == nil || len(m.items) == 0 {
+		return
+	}
 
-	str, err := fileToStr(fileName)
-	if err != nil {
-		return 0
+	m.popup.show(m.items[0].iconLabel, m.alignment, m.position)
+}
+
+// update shows the given battery information, styled for the given level, with the first of the
+// given icons that can be found, and the given text next to the icon. If the text is empty, only the
+// icon is shown.
+func (i *batteryItem) update(info Info, level Level, text string, icons []string) {
+	switch {
+	case len(icons) == 0:
+		i.iconLabel.Clear()
+	case i.config.Type == IconTypeGlyph:
+		i.iconLabel.SetText(icons[0])
+	default:
+		i.iconLabel.SetPixmap(i.icons.Pixmap(i.config.Size, icons...))
 	}
 
-	flt, err := strconv.ParseFloat(str, 64)
-	if err != nil {
-		return 0
+	i.label.SetText(text)
+	i.label.SetVisible(text != "")
+	i.label.SetToolTip(info.Name)
+
+	var classes []string
+	switch level {
+	case LevelWarning:
+		classes = append(classes, barbara.ClassWarning)
+	case LevelCritical:
+		classes = append(classes, barbara.ClassUrgent)
 	}
 
-	return flt
+	barbara.SetClass(i.iconLabel, classes...)
+	barbara.SetClass(i.label, classes...)
+}
+
+// destroy frees up the resources used by this batteryItem.
+func (i *batteryItem) destroy() {
+	i.iconLabel.Destroy(true, true)
+	i.label.Destroy(true, true)
 }
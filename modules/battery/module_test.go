@@ -0,0 +1,57 @@
+package battery
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/seeruk/barbara/barbara"
+	"github.com/seeruk/barbara/barbara/barbaratest"
+	"github.com/seeruk/barbara/icon"
+)
+
+// testSysfsRoot is the fake sysfs used in tests, with a system battery that reports charge, one that
+// reports energy, a mains adapter, a mouse, and a keyboard that doesn't know it's capacity. There's
+// also a broken power supply, with an invalid capacity and no status, which isn't discovered as it
+// has no type.
+const testSysfsRoot = "testdata/sysfs"
+
+func TestMain(m *testing.M) {
+	barbaratest.Main(m)
+}
+
+func TestModule_Golden(t *testing.T) {
+	// No icon directories are searched, so the output doesn't depend on the installed icon themes.
+	icons := icon.NewLoader(icon.NewLookup(icon.FallbackTheme, []string{}), 1)
+
+	mbf := barbara.NewModuleFactory()
+	mbf.RegisterConstructor("battery", NewModuleConstructor(icons))
+
+	backend := NewSysfsBackend(NewInfoReader(testSysfsRoot), newFakeUeventListener())
+
+	services := barbara.NewServiceRegistry()
+	services.RegisterConstructor(ServiceKind, NewInfoNotifierConstructor(backend, ""))
+	services.RegisterConstructor(AlerterServiceKind, NewAlerterConstructor(nil, nil))
+
+	harness := barbaratest.NewHarness(mbf, services, barbara.SystemClock{})
+	screen := barbara.NewVirtualScreen("test", 0, 0, 640, 480)
+
+	tests := []struct {
+		name   string
+		config string
+	}{
+		{"battery", `{"kind": "battery", "power_supply": "BAT0"}`},
+		{"battery_aggregate", `{"kind": "battery", "power_supply": "auto"}`},
+		{"battery_per_battery", `{"kind": "battery", "power_supply": "auto", "mode": "per-battery"}`},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			img, err := harness.RenderModule(json.RawMessage(test.config), screen)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			barbaratest.AssertGolden(t, test.name, img)
+		})
+	}
+}
@@ -0,0 +1,326 @@
+package battery
+
+import (
+	"bytes"
+	"fmt"
+	"html"
+	"log"
+
+	"github.com/seeruk/barbara/barbara"
+	"github.com/therecipe/qt/core"
+	"github.com/therecipe/qt/gui"
+	"github.com/therecipe/qt/widgets"
+)
+
+// popup is a menu that shows detailed battery information, e.g. battery health, and the rate the
+// battery is being used at. If the batteries support charge thresholds, the popup also has items
+// for picking a charge threshold preset. If battery history is being recorded, the popup also
+// shows a chart of the last day's charge, and the rate it was charged or discharged at.
+type popup struct {
+	clock  barbara.Clock
+	menu   *widgets.QMenu
+	label  *widgets.QLabel
+	action *widgets.QWidgetAction
+
+	history     *History
+	chart       *widgets.QWidget
+	chartAction *widgets.QWidgetAction
+	chartLines  []chartLine
+
+	presets       []ChargeThresholdPresetConfig
+	presetActions []*widgets.QAction
+	separator     *widgets.QAction
+	status        *widgets.QAction
+}
+
+// newPopup returns a new popup instance, with items for the given charge threshold presets, that
+// call the given function when they're picked. If history is nil, no chart is shown, otherwise the
+// chart ends at the time given by clock. It must be called on the main thread.
+func newPopup(clock barbara.Clock, history *History, presets []ChargeThresholdPresetConfig, onPreset func(ChargeThresholdPresetConfig)) *popup {
+	menu := widgets.NewQMenu(nil)
+
+	label := widgets.NewQLabel(nil, core.Qt__Widget)
+	label.SetTextFormat(core.Qt__RichText)
+	label.SetContentsMargins(8, 4, 8, 4)
+
+	// The label isn't an action that can be triggered, it's just shown in the menu.
+	action := widgets.NewQWidgetAction(menu)
+	action.SetDefaultWidget(label)
+
+	menu.AddActions([]*widgets.QAction{action.QAction_PTR()})
+
+	p := &popup{
+		clock:   clock,
+		menu:    menu,
+		label:   label,
+		action:  action,
+		history: history,
+		presets: presets,
+	}
+
+	if history != nil {
+		p.addChart()
+	}
+
+	p.separator = menu.AddSeparator()
+
+	for _, preset := range presets {
+		preset := preset
+
+		presetAction := menu.AddAction(preset.Name)
+		presetAction.SetCheckable(true)
+		presetAction.ConnectTriggered(func(_ bool) {
+			onPreset(preset)
+		})
+
+		p.presetActions = append(p.presetActions, presetAction)
+	}
+
+	// The status shows whether picking a preset worked. It's hidden until one is picked, and the
+	// full reason for a failure is shown in it's tooltip.
+	p.status = menu.AddAction("")
+	p.status.SetEnabled(false)
+	p.status.SetVisible(false)
+
+	menu.SetToolTipsVisible(true)
+
+	return p
+}
+
+// update shows the given battery information in the popup. The popup may be open while it's
+// updated, in which case it's resized to fit.
+func (p *popup) update(update Update) {
+	p.label.SetText(getPopupText(update))
+	p.label.AdjustSize()
+
+	// Presets are only shown if a battery supports charge thresholds, and they're only checked if
+	// every battery that supports them is using them.
+	var supported []Info
+	for _, info := range update.Batteries {
+		if info.HasChargeThresholds() {
+			supported = append(supported, info)
+		}
+	}
+
+	p.separator.SetVisible(len(supported) > 0)
+
+	for i, preset := range p.presets {
+		checked := len(supported) > 0
+		for _, info := range supported {
+			checked = checked && preset.matches(info)
+		}
+
+		p.presetActions[i].SetVisible(len(supported) > 0)
+		p.presetActions[i].SetChecked(checked)
+	}
+
+	if p.menu.IsVisible() {
+		p.updateChart()
+		p.menu.AdjustSize()
+	}
+}
+
+// addChart adds the history chart to the popup, below the battery information. The chart is drawn
+// from chartLines, which are worked out when the popup is opened or updated.
+func (p *popup) addChart() {
+	p.chart = widgets.NewQWidget(nil, 0)
+	p.chart.SetFixedSize2(chartWidth, chartHeight)
+	p.chart.ConnectPaintEvent(p.onChartPaint)
+
+	caption := widgets.NewQLabel2("Last 24 hours", nil, core.Qt__Widget)
+
+	container := widgets.NewQWidget(nil, 0)
+	container.SetContentsMargins(8, 4, 8, 4)
+
+	layout := widgets.NewQVBoxLayout2(container)
+	layout.SetContentsMargins(0, 0, 0, 0)
+	layout.AddWidget(caption, 0, 0)
+	layout.AddWidget(p.chart, 0, 0)
+
+	p.chartAction = widgets.NewQWidgetAction(p.menu)
+	p.chartAction.SetDefaultWidget(container)
+	p.chartAction.SetVisible(false)
+
+	p.menu.AddActions([]*widgets.QAction{p.chartAction.QAction_PTR()})
+}
+
+// updateChart reads the last day of battery history, and redraws the chart. The chart is hidden
+// until there's at least some history to show.
+func (p *popup) updateChart() {
+	if p.history == nil {
+		return
+	}
+
+	now := p.clock.Now()
+
+	samples, err := p.history.Since(now.Add(-chartPeriod))
+	if err != nil {
+		log.Println(err)
+	}
+
+	p.chartLines = getChartLines(samples, now, chartWidth, chartHeight)
+	p.chartAction.SetVisible(len(samples) > 1)
+	p.chart.Update()
+}
+
+// onChartPaint is the paint handler for the history chart.
+func (p *popup) onChartPaint(event *gui.QPaintEvent) {
+	// Use the popup's palette for everything except the rate bars, so the chart fits in with the
+	// rest of the popup, whatever the theme.
+	palette := p.chart.Palette()
+
+	colours := map[chartLineKind]*gui.QColor{
+		chartLineGrid:        palette.Color2(gui.QPalette__Mid),
+		chartLineCapacity:    palette.Color2(gui.QPalette__WindowText),
+		chartLineCharging:    gui.NewQColor3(76, 175, 80, 160),
+		chartLineDischarging: gui.NewQColor3(244, 67, 54, 160),
+	}
+
+	painter := gui.NewQPainter2(p.chart)
+	defer painter.DestroyQPainter()
+
+	painter.SetRenderHint(gui.QPainter__Antialiasing, true)
+
+	for _, line := range p.chartLines {
+		painter.SetPen(gui.NewQPen3(colours[line.kind]))
+		painter.DrawLine3(line.x1, line.y1, line.x2, line.y2)
+	}
+}
+
+// setPresetsEnabled enables or disables the charge threshold presets, e.g. while thresholds are
+// being set.
+func (p *popup) setPresetsEnabled(enabled bool) {
+	for _, presetAction := range p.presetActions {
+		presetAction.SetEnabled(enabled)
+	}
+}
+
+// setStatus shows the given text below the charge threshold presets, with the given tooltip. If
+// the text is empty, the status is hidden.
+func (p *popup) setStatus(text, tooltip string) {
+	p.status.SetText(text)
+	p.status.SetToolTip(tooltip)
+	p.status.SetVisible(text != "")
+
+	if p.menu.IsVisible() {
+		p.menu.AdjustSize()
+	}
+}
+
+// show opens the popup, positioned next to the given widget, on the side of the bar that's furthest
+// from the edge of the screen.
+func (p *popup) show(anchor widgets.QWidget_ITF, alignment barbara.ModuleAlignment, position barbara.WindowPosition) {
+	// Like the menu module, everything here is calculated when the popup is opened, because the bar
+	// could have moved since it was rendered.
+	widget := anchor.QWidget_PTR()
+
+	p.updateChart()
+
+	ash := widget.SizeHint()
+	psh := p.menu.SizeHint()
+
+	var x int
+	if alignment == barbara.ModuleAlignmentRight {
+		x = ash.Width() - psh.Width()
+	}
+
+	var y int
+	if position == barbara.WindowPositionBottom {
+		y = -psh.Height()
+	} else {
+		y = ash.Height()
+	}
+
+	p.menu.Popup(widget.MapToGlobal(core.NewQPoint2(x, y)), nil)
+}
+
+// destroy frees up the resources used by this popup.
+func (p *popup) destroy() {
+	p.menu.Destroy(true, true)
+}
+
+// getPopupText returns the rich text shown in the popup for the given battery information. Each
+// battery gets a section, and if there's more than one battery, the combined battery is shown first.
+func getPopupText(update Update) string {
+	if len(update.Batteries) == 0 {
+		return "No batteries found"
+	}
+
+	infos := update.Batteries
+	if len(infos) > 1 {
+		infos = append([]Info{update.Total}, infos...)
+	}
+
+	var buf bytes.Buffer
+
+	buf.WriteString("<table cellspacing=\"2\">")
+
+	for i, info := range infos {
+		if i > 0 {
+			// Add some space between each battery's section.
+			buf.WriteString("<tr><td colspan=\"2\"></td></tr>")
+		}
+
+		fmt.Fprintf(&buf, "<tr><th colspan=\"2\" align=\"left\">%s</th></tr>", html.EscapeString(info.Name))
+
+		for _, row := range getPopupRows(info) {
+			fmt.Fprintf(&buf, "<tr><td>%s</td><td>%s</td></tr>",
+				html.EscapeString(row[0]),
+				html.EscapeString(row[1]),
+			)
+		}
+	}
+
+	buf.WriteString("</table>")
+
+	return buf.String()
+}
+
+// getPopupRows returns the label and value of each row shown in the popup for the given battery.
+// Rows are left out if the battery doesn't report the information they need.
+func getPopupRows(info Info) [][2]string {
+	rows := [][2]string{
+		{"Status", info.Status},
+		{"Charge", fmt.Sprintf("%.0f%%", info.Capacity)},
+	}
+
+	if info.Estimate.Confident && !info.IsFull() {
+		until := "empty"
+		if info.IsCharging() {
+			until = "full"
+		}
+
+		rows = append(rows, [2]string{"Time remaining", fmt.Sprintf("%s until %s", formatDuration(info.Estimate.Remaining), until)})
+	}
+
+	if health, ok := info.Health(); ok {
+		rows = append(rows, [2]string{"Health", fmt.Sprintf("%.0f%%", health)})
+	}
+
+	switch {
+	case info.HasChargeStartThreshold:
+		rows = append(rows, [2]string{"Charge thresholds", fmt.Sprintf("%.0f–%.0f%%", info.ChargeStartThreshold, info.ChargeEndThreshold)})
+	case info.HasChargeThresholds():
+		rows = append(rows, [2]string{"Charge threshold", fmt.Sprintf("up to %.0f%%", info.ChargeEndThreshold)})
+	}
+
+	if info.CycleCount > 0 {
+		rows = append(rows, [2]string{"Cycles", fmt.Sprintf("%.0f", info.CycleCount)})
+	}
+
+	if watts := info.Watts(); watts > 0 {
+		rows = append(rows, [2]string{"Power draw", fmt.Sprintf("%.1f W", watts)})
+	}
+
+	for _, row := range [][2]string{
+		{"Vendor", info.Manufacturer},
+		{"Model", info.ModelName},
+		{"Technology", info.Technology},
+	} {
+		if row[1] != "" {
+			rows = append(rows, row)
+		}
+	}
+
+	return rows
+}
@@ -0,0 +1,97 @@
+package battery
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+)
+
+// defaultChargeThresholdsCommand is the command used to set charge thresholds if one isn't
+// configured. The end threshold is written both before and after the start threshold, as drivers
+// may reject a start threshold above the current end threshold, or an end threshold below the
+// current start threshold, depending on which way the thresholds are moving. Batteries without a
+// start threshold are given an empty one, in which case only the end threshold is written.
+const defaultChargeThresholdsCommand = `pkexec sh -c '
+dir="/sys/class/power_supply/$1"
+if [ -n "$2" ]; then
+	echo "$3" > "$dir/charge_control_end_threshold" 2>/dev/null
+	echo "$2" > "$dir/charge_control_start_threshold" || exit
+fi
+echo "$3" > "$dir/charge_control_end_threshold"
+' sh "$1" "$2" "$3"`
+
+// defaultChargeThresholdPresets are the presets shown if none are configured.
+var defaultChargeThresholdPresets = []ChargeThresholdPresetConfig{
+	{Name: "Conserve (60–80%)", Start: 60, End: 80},
+	{Name: "Full charge", Start: 0, End: 100},
+}
+
+// validate checks that the ChargeThresholdsConfig is usable, applying defaults.
+func (c *ChargeThresholdsConfig) validate() error {
+	if c.Command == "" {
+		c.Command = defaultChargeThresholdsCommand
+	}
+
+	if len(c.Presets) == 0 {
+		c.Presets = append([]ChargeThresholdPresetConfig(nil), defaultChargeThresholdPresets...)
+	}
+
+	for _, preset := range c.Presets {
+		if preset.Start < 0 || preset.End > 100 || preset.Start >= preset.End {
+			return fmt.Errorf("battery: invalid charge threshold preset %q", preset.Name)
+		}
+	}
+
+	return nil
+}
+
+// matches returns true if the given battery's thresholds are the same as this preset's. If the
+// battery doesn't have a start threshold, only the end threshold is compared.
+func (p ChargeThresholdPresetConfig) matches(info Info) bool {
+	if info.HasChargeStartThreshold && info.ChargeStartThreshold != p.Start {
+		return false
+	}
+
+	return info.ChargeEndThreshold == p.End
+}
+
+// setChargeThresholds sets the charge thresholds of the given battery to the given preset, using
+// the given command. If the battery doesn't have a start threshold, the command is given an empty
+// one. Output from the command is included in any error, as it's likely to explain what went
+// wrong (e.g. the user dismissing the polkit prompt).
+func setChargeThresholds(command string, info Info, preset ChargeThresholdPresetConfig) error {
+	powerSupply := info.Name
+
+	var start string
+	if info.HasChargeStartThreshold {
+		start = strconv.FormatFloat(preset.Start, 'f', -1, 64)
+	}
+
+	end := strconv.FormatFloat(preset.End, 'f', -1, 64)
+
+	cmd := exec.Command("sh", "-c", command, "sh", powerSupply, start, end)
+	cmd.Env = append(os.Environ(),
+		"BATTERY="+powerSupply,
+		"START="+start,
+		"END="+end,
+	)
+
+	var output bytes.Buffer
+
+	cmd.Stdout = &output
+	cmd.Stderr = &output
+
+	err := cmd.Run()
+	if err != nil {
+		return fmt.Errorf("battery: failed to set charge thresholds of %q: %v: %s",
+			powerSupply,
+			err,
+			strings.TrimSpace(output.String()),
+		)
+	}
+
+	return nil
+}
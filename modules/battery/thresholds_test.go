@@ -0,0 +1,150 @@
+package battery
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestChargeThresholdsConfig_Validate(t *testing.T) {
+	custom := []ChargeThresholdPresetConfig{{Name: "Desk", Start: 40, End: 50}}
+
+	tests := []struct {
+		name     string
+		config   ChargeThresholdsConfig
+		expected ChargeThresholdsConfig
+		valid    bool
+	}{
+		{
+			name:   "defaults",
+			config: ChargeThresholdsConfig{},
+			expected: ChargeThresholdsConfig{
+				Command: defaultChargeThresholdsCommand,
+				Presets: defaultChargeThresholdPresets,
+			},
+			valid: true,
+		},
+		{
+			name:     "custom",
+			config:   ChargeThresholdsConfig{Command: "true", Presets: custom},
+			expected: ChargeThresholdsConfig{Command: "true", Presets: custom},
+			valid:    true,
+		},
+		{
+			name:   "negative start",
+			config: ChargeThresholdsConfig{Presets: []ChargeThresholdPresetConfig{{Name: "Bad", Start: -1, End: 80}}},
+		},
+		{
+			name:   "end above 100",
+			config: ChargeThresholdsConfig{Presets: []ChargeThresholdPresetConfig{{Name: "Bad", Start: 60, End: 101}}},
+		},
+		{
+			name:   "start not below end",
+			config: ChargeThresholdsConfig{Presets: []ChargeThresholdPresetConfig{{Name: "Bad", Start: 80, End: 80}}},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			config := test.config
+
+			err := config.validate()
+			if !test.valid {
+				if err == nil {
+					t.Error("expected an error")
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !reflect.DeepEqual(config, test.expected) {
+				t.Errorf("expected %+v, got %+v", test.expected, config)
+			}
+		})
+	}
+}
+
+func TestChargeThresholdPresetConfig_Matches(t *testing.T) {
+	conserve := ChargeThresholdPresetConfig{Name: "Conserve", Start: 60, End: 80}
+
+	tests := []struct {
+		name     string
+		info     Info
+		expected bool
+	}{
+		{"same", Info{ChargeStartThreshold: 60, ChargeEndThreshold: 80, HasChargeStartThreshold: true}, true},
+		{"different start", Info{ChargeStartThreshold: 0, ChargeEndThreshold: 80, HasChargeStartThreshold: true}, false},
+		{"different end", Info{ChargeStartThreshold: 60, ChargeEndThreshold: 100, HasChargeStartThreshold: true}, false},
+		{"end only", Info{ChargeEndThreshold: 80}, true},
+		{"different end only", Info{ChargeEndThreshold: 100}, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if matches := conserve.matches(test.info); matches != test.expected {
+				t.Errorf("expected %v, got %v", test.expected, matches)
+			}
+		})
+	}
+}
+
+func TestSetChargeThresholds(t *testing.T) {
+	dir, err := ioutil.TempDir("", "barbara-thresholds")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.RemoveAll(dir)
+
+	fileName := filepath.Join(dir, "args")
+
+	// The stub command records what it was given, both as arguments, and in the environment.
+	command := `echo "$1|$2|$3|$BATTERY|$START|$END" > "` + fileName + `"`
+	preset := ChargeThresholdPresetConfig{Name: "Conserve", Start: 60, End: 80.5}
+
+	tests := []struct {
+		name     string
+		info     Info
+		expected string
+	}{
+		{"both", Info{Name: "BAT0", ChargeEndThreshold: 100, HasChargeStartThreshold: true}, "BAT0|60|80.5|BAT0|60|80.5"},
+		{"end only", Info{Name: "BAT1", ChargeEndThreshold: 100}, "BAT1||80.5|BAT1||80.5"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := setChargeThresholds(command, test.info, preset)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			args, err := ioutil.ReadFile(fileName)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if actual := strings.TrimSpace(string(args)); actual != test.expected {
+				t.Errorf("expected %q, got %q", test.expected, actual)
+			}
+		})
+	}
+
+	t.Run("failed", func(t *testing.T) {
+		err := setChargeThresholds(`echo "Request dismissed" >&2; exit 126`, Info{Name: "BAT0"}, preset)
+		if err == nil {
+			t.Fatal("expected an error")
+		}
+
+		// The command's output usually says what went wrong, so it should be in the error.
+		if !strings.Contains(err.Error(), "Request dismissed") {
+			t.Errorf("expected the command's output in the error, got %q", err)
+		}
+	})
+}
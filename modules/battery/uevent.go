@@ -0,0 +1,158 @@
+package battery
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"syscall"
+)
+
+const (
+	// ueventBufferSize is the size of the buffer uevents are read into. Uevents are limited to a
+	// few KiB by the kernel, so this is plenty.
+	ueventBufferSize = 16 * 1024
+	// ueventSocketBufferSize is the size of the uevent socket's receive buffer. Lots of uevents are
+	// sent at once when resuming, or docking, which can overflow the default buffer.
+	ueventSocketBufferSize = 1024 * 1024
+)
+
+// UeventActionDropped is the action of the Uevent sent by NetlinkUeventListener when uevents have
+// been dropped, because they arrived faster than they could be read. Any device may have changed.
+const UeventActionDropped = "dropped"
+
+// Uevent is an event sent by the kernel when a device changes, e.g. when a charger is plugged in.
+type Uevent struct {
+	// Action is what happened to the device, e.g. "change", "add", or "remove".
+	Action string
+	// DevPath is the path of the device in sysfs, relative to the sysfs root.
+	DevPath string
+	// Env holds the properties of the event, e.g. SUBSYSTEM, or POWER_SUPPLY_NAME.
+	Env map[string]string
+}
+
+// ParseUevent parses a uevent as it's sent by the kernel over netlink: a header of the form
+// "action@devpath", followed by KEY=VALUE properties, each terminated by a NUL byte.
+func ParseUevent(msg []byte) (Uevent, error) {
+	fields := bytes.Split(bytes.TrimRight(msg, "\x00"), []byte{0})
+
+	header := strings.SplitN(string(fields[0]), "@", 2)
+	if len(header) != 2 {
+		return Uevent{}, fmt.Errorf("battery: invalid uevent header %q", fields[0])
+	}
+
+	event := Uevent{
+		Action:  header[0],
+		DevPath: header[1],
+		Env:     make(map[string]string, len(fields)-1),
+	}
+
+	for _, field := range fields[1:] {
+		kv := strings.SplitN(string(field), "=", 2)
+		if len(kv) != 2 {
+			continue
+		}
+
+		event.Env[kv[0]] = kv[1]
+	}
+
+	return event, nil
+}
+
+// UeventListener is a type that listens for kernel uevents.
+type UeventListener interface {
+	// Listen starts listening for uevents, sending them to the returned channel until the given
+	// context is done, at which point the channel is closed. If uevents are dropped, a Uevent with
+	// the action UeventActionDropped is sent in their place.
+	Listen(ctx context.Context) (<-chan Uevent, error)
+}
+
+// NetlinkUeventListener is a UeventListener that receives uevents directly from the kernel, using
+// a NETLINK_KOBJECT_UEVENT socket. It doesn't need udev to be running.
+type NetlinkUeventListener struct{}
+
+// NewNetlinkUeventListener returns a new NetlinkUeventListener instance.
+func NewNetlinkUeventListener() *NetlinkUeventListener {
+	return &NetlinkUeventListener{}
+}
+
+// Listen opens a netlink socket, and starts listening for uevents in the background.
+func (l *NetlinkUeventListener) Listen(ctx context.Context) (<-chan Uevent, error) {
+	fd, err := syscall.Socket(
+		syscall.AF_NETLINK,
+		syscall.SOCK_RAW|syscall.SOCK_CLOEXEC,
+		syscall.NETLINK_KOBJECT_UEVENT,
+	)
+
+	if err != nil {
+		return nil, fmt.Errorf("battery: failed to open uevent socket: %v", err)
+	}
+
+	// Group 1 is the kernel's multicast group for uevents.
+	err = syscall.Bind(fd, &syscall.SockaddrNetlink{Family: syscall.AF_NETLINK, Groups: 1})
+	if err != nil {
+		syscall.Close(fd)
+		return nil, fmt.Errorf("battery: failed to bind uevent socket: %v", err)
+	}
+
+	// The kernel drops uevents if the buffer fills up. Forcing a bigger buffer needs
+	// CAP_NET_ADMIN, so it'll usually be capped by the system's limit instead, which is fine.
+	err = syscall.SetsockoptInt(fd, syscall.SOL_SOCKET, syscall.SO_RCVBUFFORCE, ueventSocketBufferSize)
+	if err != nil {
+		syscall.SetsockoptInt(fd, syscall.SOL_SOCKET, syscall.SO_RCVBUF, ueventSocketBufferSize)
+	}
+
+	// Reads time out regularly so that we notice when the context is done, as closing the socket
+	// doesn't interrupt a blocked read.
+	err = syscall.SetsockoptTimeval(fd, syscall.SOL_SOCKET, syscall.SO_RCVTIMEO, &syscall.Timeval{Sec: 1})
+	if err != nil {
+		syscall.Close(fd)
+		return nil, fmt.Errorf("battery: failed to set uevent socket timeout: %v", err)
+	}
+
+	events := make(chan Uevent, 16)
+
+	go func() {
+		defer close(events)
+		defer syscall.Close(fd)
+
+		buf := make([]byte, ueventBufferSize)
+
+		for ctx.Err() == nil {
+			n, _, err := syscall.Recvfrom(fd, buf, 0)
+			if err == syscall.EAGAIN || err == syscall.EINTR {
+				continue
+			}
+
+			if err == syscall.ENOBUFS {
+				// Uevents were dropped, but the socket still works. Whatever was dropped may have
+				// been important, so listeners are told that anything may have changed.
+				select {
+				case events <- Uevent{Action: UeventActionDropped, Env: map[string]string{}}:
+				case <-ctx.Done():
+				}
+
+				continue
+			}
+
+			if err != nil {
+				log.Printf("battery: failed to read uevent: %v\n", err)
+				return
+			}
+
+			event, err := ParseUevent(buf[:n])
+			if err != nil {
+				// Not every message is a uevent we understand, that's fine.
+				continue
+			}
+
+			select {
+			case events <- event:
+			case <-ctx.Done():
+			}
+		}
+	}()
+
+	return events, nil
+}
@@ -0,0 +1,257 @@
+package battery
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// testTimeout is how long tests wait for something to happen in the background before failing.
+const testTimeout = 5 * time.Second
+
+func TestParseUevent(t *testing.T) {
+	tests := []struct {
+		name     string
+		msg      string
+		expected Uevent
+		err      bool
+	}{
+		{
+			name: "power supply",
+			msg: "change@/devices/LNXSYSTM:00/LNXSYBUS:00/PNP0C0A:00/power_supply/BAT0\x00" +
+				"ACTION=change\x00" +
+				"DEVPATH=/devices/LNXSYSTM:00/LNXSYBUS:00/PNP0C0A:00/power_supply/BAT0\x00" +
+				"SUBSYSTEM=power_supply\x00" +
+				"POWER_SUPPLY_NAME=BAT0\x00" +
+				"POWER_SUPPLY_STATUS=Discharging\x00" +
+				"SEQNUM=4213\x00",
+			expected: Uevent{
+				Action:  "change",
+				DevPath: "/devices/LNXSYSTM:00/LNXSYBUS:00/PNP0C0A:00/power_supply/BAT0",
+				Env: map[string]string{
+					"ACTION":              "change",
+					"DEVPATH":             "/devices/LNXSYSTM:00/LNXSYBUS:00/PNP0C0A:00/power_supply/BAT0",
+					"SUBSYSTEM":           "power_supply",
+					"POWER_SUPPLY_NAME":   "BAT0",
+					"POWER_SUPPLY_STATUS": "Discharging",
+					"SEQNUM":              "4213",
+				},
+			},
+		},
+		{
+			name: "missing subsystem",
+			msg:  "add@/devices/virtual/misc/foo\x00ACTION=add\x00SEQNUM=4214\x00",
+			expected: Uevent{
+				Action:  "add",
+				DevPath: "/devices/virtual/misc/foo",
+				Env: map[string]string{
+					"ACTION": "add",
+					"SEQNUM": "4214",
+				},
+			},
+		},
+		{
+			name: "other subsystem",
+			msg:  "remove@/devices/pci0000:00/0000:00:14.0/usb1/1-2\x00ACTION=remove\x00SUBSYSTEM=usb\x00",
+			expected: Uevent{
+				Action:  "remove",
+				DevPath: "/devices/pci0000:00/0000:00:14.0/usb1/1-2",
+				Env: map[string]string{
+					"ACTION":    "remove",
+					"SUBSYSTEM": "usb",
+				},
+			},
+		},
+		{
+			name: "values containing equals signs",
+			msg:  "change@/foo\x00MODALIAS=acpi:PNP0C0A:\x00POWER_SUPPLY_MODEL_NAME=a=b\x00",
+			expected: Uevent{
+				Action:  "change",
+				DevPath: "/foo",
+				Env: map[string]string{
+					"MODALIAS":                "acpi:PNP0C0A:",
+					"POWER_SUPPLY_MODEL_NAME": "a=b",
+				},
+			},
+		},
+		{
+			name: "invalid properties are skipped",
+			msg:  "change@/foo\x00\x00garbage\x00SUBSYSTEM=power_supply\x00",
+			expected: Uevent{
+				Action:  "change",
+				DevPath: "/foo",
+				Env: map[string]string{
+					"SUBSYSTEM": "power_supply",
+				},
+			},
+		},
+		{
+			// udev rebroadcasts uevents with a binary header, which isn't what we're listening for.
+			name: "invalid header",
+			msg:  "libudev\x00\xfe\xed\xca\xfe",
+			err:  true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			event, err := ParseUevent([]byte(test.msg))
+			if test.err {
+				if err == nil {
+					t.Errorf("expected an error, got %+v", event)
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !reflect.DeepEqual(event, test.expected) {
+				t.Errorf("expected %+v, got %+v", test.expected, event)
+			}
+		})
+	}
+}
+
+func TestSysfsBackend_Watch(t *testing.T) {
+	listener := newFakeUeventListener()
+	backend := NewSysfsBackend(NewInfoReader(testSysfsRoot), listener)
+
+	ctx, cfn := context.WithCancel(context.Background())
+	defer cfn()
+
+	changes, err := backend.Watch(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Sending to the listener blocks until the backend has received the previous event, so by the
+	// time the last event is sent, the ones before it have been handled.
+	listener.events <- Uevent{Action: "add", Env: map[string]string{}}
+	listener.events <- Uevent{Action: "change", Env: map[string]string{"SUBSYSTEM": "usb"}}
+	listener.events <- Uevent{Action: "change", Env: map[string]string{"SUBSYSTEM": ueventSubsystem}}
+
+	select {
+	case <-changes:
+	case <-time.After(testTimeout):
+		t.Fatal("expected a change for a power supply uevent")
+	}
+
+	listener.events <- Uevent{Action: "change", Env: map[string]string{"SUBSYSTEM": "usb"}}
+	listener.events <- Uevent{Action: "change", Env: map[string]string{"SUBSYSTEM": "usb"}}
+
+	select {
+	case <-changes:
+		t.Fatal("expected no change for uevents from other subsystems")
+	default:
+	}
+
+	// Dropped uevents may have been about power supplies.
+	listener.events <- Uevent{Action: UeventActionDropped, Env: map[string]string{}}
+
+	select {
+	case <-changes:
+	case <-time.After(testTimeout):
+		t.Fatal("expected a change when uevents are dropped")
+	}
+
+	cfn()
+
+	select {
+	case _, ok := <-changes:
+		if ok {
+			t.Fatal("expected no change after the context is done")
+		}
+	case <-time.After(testTimeout):
+		t.Fatal("expected changes to be closed once the context is done")
+	}
+}
+
+func TestInfoNotifier_Uevents(t *testing.T) {
+	listener := newFakeUeventListener()
+	backend := NewSysfsBackend(NewInfoReader(testSysfsRoot), listener)
+
+	notifier := NewInfoNotifier(backend, PowerSupplyAuto, nil)
+
+	updates := make(chan Update, 1)
+	notifier.Notify(updates)
+
+	err := notifier.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer notifier.Stop()
+
+	// Battery information is read straight away.
+	receiveUpdate(t, updates)
+
+	for _, action := range []string{"add", "remove", "change"} {
+		t.Run(action, func(t *testing.T) {
+			listener.events <- Uevent{
+				Action:  action,
+				DevPath: "/devices/LNXSYSTM:00/LNXSYBUS:00/PNP0C0A:00/power_supply/BAT1",
+				Env:     map[string]string{"SUBSYSTEM": ueventSubsystem},
+			}
+
+			update := receiveUpdate(t, updates)
+			if len(update.Batteries) != 2 {
+				t.Errorf("expected 2 batteries, got %d", len(update.Batteries))
+			}
+		})
+	}
+}
+
+// receiveUpdate returns the next Update sent to the given channel, failing the test if one isn't
+// sent in time.
+func receiveUpdate(t *testing.T, updates <-chan Update) Update {
+	t.Helper()
+
+	select {
+	case update := <-updates:
+		return update
+	case <-time.After(testTimeout):
+		t.Fatal("expected battery information to be read")
+	}
+
+	return Update{}
+}
+
+// fakeUeventListener is a UeventListener that sends uevents given to it by tests.
+type fakeUeventListener struct {
+	events chan Uevent
+}
+
+// newFakeUeventListener returns a new fakeUeventListener instance.
+func newFakeUeventListener() *fakeUeventListener {
+	return &fakeUeventListener{
+		events: make(chan Uevent),
+	}
+}
+
+// Listen forwards uevents sent to l.events until the given context is done.
+func (l *fakeUeventListener) Listen(ctx context.Context) (<-chan Uevent, error) {
+	events := make(chan Uevent)
+
+	go func() {
+		defer close(events)
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case event := <-l.events:
+				select {
+				case events <- event:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+
+	return events, nil
+}
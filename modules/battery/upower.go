@@ -0,0 +1,256 @@
+package battery
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/godbus/dbus"
+)
+
+const (
+	// upowerName is the well-known bus name of UPower.
+	upowerName = "org.freedesktop.UPower"
+	// upowerPath is the path of UPower's main object, and the prefix of all of it's objects.
+	upowerPath = "/org/freedesktop/UPower"
+	// upowerDisplayDevicePath is the path of UPower's display device, which is a composite of all
+	// batteries in the system, i.e. what should be shown in a panel.
+	upowerDisplayDevicePath = "/org/freedesktop/UPower/devices/DisplayDevice"
+	// upowerDeviceInterface is the interface of UPower device objects.
+	upowerDeviceInterface = "org.freedesktop.UPower.Device"
+	// upowerTypeBattery is the UPower device type for batteries.
+	upowerTypeBattery = 2
+)
+
+// upowerStates maps UPower device states to the statuses used in sysfs.
+var upowerStates = map[uint32]string{
+	0: StatusUnknown,
+	1: StatusCharging,
+	2: StatusDischarging,
+	3: StatusNotCharging, // Empty
+	4: StatusFull,
+	5: StatusNotCharging, // Pending charge
+	6: StatusNotCharging, // Pending discharge
+}
+
+// upowerTechnologies maps UPower device technologies to the technologies used in sysfs.
+var upowerTechnologies = map[uint32]string{
+	1: "Li-ion",
+	2: "Li-poly",
+	3: "LiFe",
+	4: "Pb",
+	5: "NiCd",
+	6: "NiMH",
+}
+
+// UPowerBackend is a Backend that reads battery information from UPower, over D-Bus. UPower smooths
+// the rate batteries are used at, and it works in sandboxes where sysfs isn't available.
+type UPowerBackend struct {
+	conn *dbus.Conn
+}
+
+// NewUPowerBackend returns a new UPowerBackend instance, talking to UPower over the given
+// connection. Normally this is a system bus connection, but it can be any bus that UPower (or
+// something pretending to be UPower) is on.
+func NewUPowerBackend(conn *dbus.Conn) *UPowerBackend {
+	return &UPowerBackend{
+		conn: conn,
+	}
+}
+
+// Read reads the battery information for the given power supply from UPower. Power supplies are
+// matched using their native path, which is their name in sysfs. When reading every battery, the
+// combined battery is UPower's display device, rather than being calculated by Aggregate.
+func (b *UPowerBackend) Read(powerSupply string) (Update, error) {
+	var update Update
+
+	if b.conn == nil {
+		return update, errors.New("battery: no system bus connection to read from UPower with")
+	}
+
+	var paths []dbus.ObjectPath
+
+	err := b.conn.Object(upowerName, upowerPath).Call(upowerName+".EnumerateDevices", 0).Store(&paths)
+	if err != nil {
+		return update, fmt.Errorf("battery: failed to enumerate UPower devices: %v", err)
+	}
+
+	for _, path := range paths {
+		props, err := b.getProperties(path)
+		if err != nil {
+			return update, err
+		}
+
+		// Only batteries that power the system are shown, not those in peripherals.
+		if uint32Prop(props, "Type") != upowerTypeBattery || !boolProp(props, "PowerSupply") {
+			continue
+		}
+
+		info := upowerInfo(props)
+		if powerSupply != PowerSupplyAuto && info.Name != powerSupply {
+			continue
+		}
+
+		update.Batteries = append(update.Batteries, info)
+	}
+
+	if powerSupply != PowerSupplyAuto && len(update.Batteries) == 0 {
+		return update, fmt.Errorf("battery: UPower has no battery named %q", powerSupply)
+	}
+
+	update.Total = Aggregate(update.Batteries)
+
+	if powerSupply == PowerSupplyAuto && len(update.Batteries) > 1 {
+		props, err := b.getProperties(upowerDisplayDevicePath)
+		if err != nil {
+			return update, err
+		}
+
+		update.Total = upowerInfo(props)
+		update.Total.Name = "total"
+	}
+
+	return update, nil
+}
+
+// Watch subscribes to UPower's PropertiesChanged signals, and it's signals for devices being added
+// and removed.
+func (b *UPowerBackend) Watch(ctx context.Context) (<-chan struct{}, error) {
+	if b.conn == nil {
+		return nil, errors.New("battery: no system bus connection to watch UPower with")
+	}
+
+	rules := []string{
+		fmt.Sprintf("type='signal',sender='%s',interface='org.freedesktop.DBus.Properties',member='PropertiesChanged'", upowerName),
+		fmt.Sprintf("type='signal',sender='%s',interface='%s'", upowerName, upowerName),
+	}
+
+	for _, rule := range rules {
+		err := b.conn.BusObject().Call("org.freedesktop.DBus.AddMatch", 0, rule).Err
+		if err != nil {
+			return nil, fmt.Errorf("battery: failed to watch UPower: %v", err)
+		}
+	}
+
+	signals := make(chan *dbus.Signal, 16)
+	b.conn.Signal(signals)
+
+	changes := make(chan struct{}, 1)
+
+	go func() {
+		defer close(changes)
+
+		defer func() {
+			b.conn.RemoveSignal(signals)
+
+			for _, rule := range rules {
+				b.conn.BusObject().Call("org.freedesktop.DBus.RemoveMatch", 0, rule)
+			}
+		}()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case signal := <-signals:
+				// The connection is shared, so signals matched by other users may turn up here.
+				if strings.HasPrefix(string(signal.Path), upowerPath) {
+					notifyChange(changes)
+				}
+			}
+		}
+	}()
+
+	return changes, nil
+}
+
+// getProperties returns all of the properties of the UPower device at the given path.
+func (b *UPowerBackend) getProperties(path dbus.ObjectPath) (map[string]dbus.Variant, error) {
+	var props map[string]dbus.Variant
+
+	err := b.conn.Object(upowerName, path).
+		Call("org.freedesktop.DBus.Properties.GetAll", 0, upowerDeviceInterface).
+		Store(&props)
+
+	if err != nil {
+		return nil, fmt.Errorf("battery: failed to get properties of UPower device %q: %v", path, err)
+	}
+
+	return props, nil
+}
+
+// upowerInfo returns the battery information in the given UPower device properties. UPower uses
+// Wh, W, and V, which are converted to the µWh, µW, and µV used in sysfs.
+func upowerInfo(props map[string]dbus.Variant) Info {
+	info := Info{
+		Name:                 stringProp(props, "NativePath"),
+		Capacity:             floatProp(props, "Percentage"),
+		ChargeEndThreshold:   floatProp(props, "ChargeEndThreshold"),
+		ChargeStartThreshold: floatProp(props, "ChargeStartThreshold"),
+		CycleCount:           floatProp(props, "ChargeCycles"),
+		EnergyFull:           floatProp(props, "EnergyFull") * 1e6,
+		EnergyFullDesign:     floatProp(props, "EnergyFullDesign") * 1e6,
+		EnergyNow:            floatProp(props, "Energy") * 1e6,
+		PowerNow:             floatProp(props, "EnergyRate") * 1e6,
+		VoltageNow:           floatProp(props, "Voltage") * 1e6,
+		Manufacturer:         stringProp(props, "Vendor"),
+		ModelName:            stringProp(props, "Model"),
+		Status:               upowerStates[uint32Prop(props, "State")],
+		Technology:           upowerTechnologies[uint32Prop(props, "Technology")],
+		HasCapacity:          true,
+	}
+
+	// Older versions of UPower don't support charge thresholds at all, and newer versions report
+	// thresholds even if the battery doesn't support them. UPower only supports batteries that
+	// have both a start, and an end threshold.
+	if !boolProp(props, "ChargeThresholdSupported") {
+		info.ChargeEndThreshold = 0
+		info.ChargeStartThreshold = 0
+	}
+
+	info.HasChargeStartThreshold = info.HasChargeThresholds()
+
+	// UPower uses -1 for an unknown cycle count.
+	if info.CycleCount < 0 {
+		info.CycleCount = 0
+	}
+
+	return info
+}
+
+// floatProp returns the value of the given numeric property, or 0 if it's missing.
+func floatProp(props map[string]dbus.Variant, name string) float64 {
+	switch value := props[name].Value().(type) {
+	case float64:
+		return value
+	case int32:
+		return float64(value)
+	case int64:
+		return float64(value)
+	case uint32:
+		return float64(value)
+	case uint64:
+		return float64(value)
+	}
+
+	return 0
+}
+
+// uint32Prop returns the value of the given enum property, or 0 (usually "unknown") if it's missing.
+func uint32Prop(props map[string]dbus.Variant, name string) uint32 {
+	value, _ := props[name].Value().(uint32)
+	return value
+}
+
+// boolProp returns the value of the given boolean property, or false if it's missing.
+func boolProp(props map[string]dbus.Variant, name string) bool {
+	value, _ := props[name].Value().(bool)
+	return value
+}
+
+// stringProp returns the value of the given string property, or an empty string if it's missing.
+func stringProp(props map[string]dbus.Variant, name string) string {
+	value, _ := props[name].Value().(string)
+	return value
+}
@@ -0,0 +1,379 @@
+package battery
+
+import (
+	"bufio"
+	"context"
+	"os/exec"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/godbus/dbus"
+	"github.com/godbus/dbus/prop"
+)
+
+// fakeUPowerDevice is a device exported by fakeUPower.
+type fakeUPowerDevice struct {
+	path  dbus.ObjectPath
+	props map[string]interface{}
+}
+
+// testUPowerDevices are the devices exported by fakeUPower in tests: two batteries, a mains
+// adapter, a mouse, and the display device. Values are chosen so that converting them to µWh, µW,
+// and µV is exact.
+var testUPowerDevices = []fakeUPowerDevice{
+	{
+		path: "/org/freedesktop/UPower/devices/battery_BAT0",
+		props: map[string]interface{}{
+			"NativePath":               "BAT0",
+			"Type":                     uint32(upowerTypeBattery),
+			"PowerSupply":              true,
+			"Percentage":               72.0,
+			"Energy":                   32.5,
+			"EnergyFull":               45.25,
+			"EnergyFullDesign":         50.5,
+			"EnergyRate":               12.25,
+			"Voltage":                  12.125,
+			"State":                    uint32(2),
+			"Technology":               uint32(2),
+			"Vendor":                   "SMP",
+			"Model":                    "01AV430",
+			"ChargeCycles":             int32(187),
+			"ChargeStartThreshold":     uint32(60),
+			"ChargeEndThreshold":       uint32(80),
+			"ChargeThresholdSupported": true,
+		},
+	},
+	{
+		path: "/org/freedesktop/UPower/devices/battery_BAT1",
+		props: map[string]interface{}{
+			"NativePath":       "BAT1",
+			"Type":             uint32(upowerTypeBattery),
+			"PowerSupply":      true,
+			"Percentage":       95.0,
+			"Energy":           20.5,
+			"EnergyFull":       21.5,
+			"EnergyFullDesign": 22.75,
+			"EnergyRate":       0.0,
+			"Voltage":          11.5,
+			"State":            uint32(4),
+			"Technology":       uint32(1),
+			"Vendor":           "SMP",
+			"Model":            "01AV421",
+			"ChargeCycles":     int32(-1),
+			// Newer versions of UPower report thresholds even if they aren't supported.
+			"ChargeStartThreshold":     uint32(75),
+			"ChargeEndThreshold":       uint32(80),
+			"ChargeThresholdSupported": false,
+		},
+	},
+	{
+		path: "/org/freedesktop/UPower/devices/line_power_AC",
+		props: map[string]interface{}{
+			"NativePath":  "AC",
+			"Type":        uint32(1),
+			"PowerSupply": true,
+			"Online":      false,
+		},
+	},
+	{
+		path: "/org/freedesktop/UPower/devices/mouse_hidpp_battery_0",
+		props: map[string]interface{}{
+			"NativePath":  "hidpp_battery_0",
+			"Type":        uint32(5),
+			"PowerSupply": false,
+			"Percentage":  50.0,
+			"State":       uint32(2),
+		},
+	},
+	{
+		path: upowerDisplayDevicePath,
+		props: map[string]interface{}{
+			"NativePath":  "",
+			"Type":        uint32(upowerTypeBattery),
+			"PowerSupply": true,
+			"Percentage":  79.5,
+			"Energy":      53.0,
+			"EnergyFull":  66.75,
+			"EnergyRate":  12.25,
+			"State":       uint32(2),
+		},
+	},
+}
+
+func TestUPowerBackend_Read(t *testing.T) {
+	address, stop := startTestBus(t)
+	defer stop()
+
+	fakeUPower(t, dialTestBus(t, address), testUPowerDevices)
+
+	backend := NewUPowerBackend(dialTestBus(t, address))
+
+	bat0 := Info{
+		Name:                 "BAT0",
+		Capacity:             72,
+		HasCapacity:          true,
+		ChargeEndThreshold:   80,
+		ChargeStartThreshold: 60,
+		CycleCount:           187,
+		EnergyFull:           45250000,
+		EnergyFullDesign:     50500000,
+		EnergyNow:            32500000,
+		PowerNow:             12250000,
+		VoltageNow:           12125000,
+		Manufacturer:         "SMP",
+		ModelName:            "01AV430",
+		Status:               StatusDischarging,
+		Technology:           "Li-poly",
+
+		HasChargeStartThreshold: true,
+	}
+
+	bat1 := Info{
+		Name:             "BAT1",
+		Capacity:         95,
+		HasCapacity:      true,
+		EnergyFull:       21500000,
+		EnergyFullDesign: 22750000,
+		EnergyNow:        20500000,
+		VoltageNow:       11500000,
+		Manufacturer:     "SMP",
+		ModelName:        "01AV421",
+		Status:           StatusFull,
+		Technology:       "Li-ion",
+	}
+
+	tests := []struct {
+		name        string
+		powerSupply string
+		expected    Update
+	}{
+		{
+			name:        "battery",
+			powerSupply: "BAT1",
+			expected: Update{
+				Batteries: []Info{bat1},
+				Total:     bat1,
+			},
+		},
+		{
+			// The mains adapter, and the mouse are skipped, and the display device is the total.
+			name:        "auto",
+			powerSupply: PowerSupplyAuto,
+			expected: Update{
+				Batteries: []Info{bat0, bat1},
+				Total: Info{
+					Name:        "total",
+					Capacity:    79.5,
+					HasCapacity: true,
+					EnergyFull:  66750000,
+					EnergyNow:   53000000,
+					PowerNow:    12250000,
+					Status:      StatusDischarging,
+				},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			update, err := backend.Read(test.powerSupply)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !reflect.DeepEqual(update, test.expected) {
+				t.Errorf("expected %+v, got %+v", test.expected, update)
+			}
+		})
+	}
+
+	t.Run("missing", func(t *testing.T) {
+		_, err := backend.Read("BAT2")
+		if err == nil {
+			t.Error("expected an error")
+		}
+	})
+}
+
+func TestUPowerBackend_Read_NoUPower(t *testing.T) {
+	address, stop := startTestBus(t)
+	defer stop()
+
+	_, err := NewUPowerBackend(dialTestBus(t, address)).Read(PowerSupplyAuto)
+	if err == nil {
+		t.Error("expected an error")
+	}
+}
+
+func TestUPowerBackend_Watch(t *testing.T) {
+	address, stop := startTestBus(t)
+	defer stop()
+
+	server := dialTestBus(t, address)
+	props := fakeUPower(t, server, testUPowerDevices)
+
+	backend := NewUPowerBackend(dialTestBus(t, address))
+
+	ctx, cfn := context.WithCancel(context.Background())
+	defer cfn()
+
+	changes, err := backend.Watch(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		signal func() error
+	}{
+		{
+			name: "properties changed",
+			signal: func() error {
+				props[testUPowerDevices[0].path].SetMust(upowerDeviceInterface, "Percentage", 71.0)
+				return nil
+			},
+		},
+		{
+			name: "device added",
+			signal: func() error {
+				return server.Emit(upowerPath, upowerName+".DeviceAdded", dbus.ObjectPath(upowerPath+"/devices/battery_BAT2"))
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := test.signal()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			select {
+			case <-changes:
+			case <-time.After(testTimeout):
+				t.Fatal("expected a change")
+			}
+		})
+	}
+
+	cfn()
+
+	select {
+	case _, ok := <-changes:
+		if ok {
+			t.Fatal("expected no change after the context is done")
+		}
+	case <-time.After(testTimeout):
+		t.Fatal("expected changes to be closed once the context is done")
+	}
+}
+
+// fakeUPowerService implements the methods of UPower's main object.
+type fakeUPowerService struct {
+	devices []dbus.ObjectPath
+}
+
+// EnumerateDevices returns the paths of every device, other than the display device.
+func (s *fakeUPowerService) EnumerateDevices() ([]dbus.ObjectPath, *dbus.Error) {
+	return s.devices, nil
+}
+
+// fakeUPower exports the given devices on the given connection, pretending to be UPower. The
+// properties of each device are returned by path, so that they can be changed.
+func fakeUPower(t *testing.T, conn *dbus.Conn, devices []fakeUPowerDevice) map[dbus.ObjectPath]*prop.Properties {
+	t.Helper()
+
+	service := &fakeUPowerService{}
+	props := make(map[dbus.ObjectPath]*prop.Properties, len(devices))
+
+	for _, device := range devices {
+		if device.path != upowerDisplayDevicePath {
+			service.devices = append(service.devices, device.path)
+		}
+
+		deviceProps := make(map[string]*prop.Prop, len(device.props))
+		for name, value := range device.props {
+			deviceProps[name] = &prop.Prop{Value: value, Emit: prop.EmitTrue}
+		}
+
+		props[device.path] = prop.New(conn, device.path, map[string]map[string]*prop.Prop{
+			upowerDeviceInterface: deviceProps,
+		})
+	}
+
+	err := conn.Export(service, upowerPath, upowerName)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	reply, err := conn.RequestName(upowerName, dbus.NameFlagDoNotQueue)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if reply != dbus.RequestNameReplyPrimaryOwner {
+		t.Fatalf("failed to own %q", upowerName)
+	}
+
+	return props
+}
+
+// startTestBus starts a private D-Bus daemon, returning it's address, and a function that stops it.
+// If dbus-daemon isn't installed, the test is skipped.
+func startTestBus(t *testing.T) (string, func()) {
+	t.Helper()
+
+	if _, err := exec.LookPath("dbus-daemon"); err != nil {
+		t.Skip("dbus-daemon is not installed")
+	}
+
+	cmd := exec.Command("dbus-daemon", "--session", "--nofork", "--nopidfile", "--print-address")
+
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = cmd.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stop := func() {
+		cmd.Process.Kill()
+		cmd.Wait()
+	}
+
+	address, err := bufio.NewReader(stdout).ReadString('\n')
+	if err != nil {
+		stop()
+		t.Fatalf("failed to read dbus-daemon address: %v", err)
+	}
+
+	return strings.TrimSpace(address), stop
+}
+
+// dialTestBus returns a new connection to the D-Bus daemon at the given address. The connection is
+// closed when the daemon is stopped.
+func dialTestBus(t *testing.T, address string) *dbus.Conn {
+	t.Helper()
+
+	conn, err := dbus.Dial(address)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = conn.Auth(nil)
+	if err == nil {
+		err = conn.Hello()
+	}
+
+	if err != nil {
+		conn.Close()
+		t.Fatal(err)
+	}
+
+	return conn
+}
@@ -0,0 +1,103 @@
+package clock
+
+import (
+	"bytes"
+	"fmt"
+	"html"
+	"math"
+	"text/template"
+	"time"
+)
+
+// nextEventData is the data that the next event format is executed with.
+type nextEventData struct {
+	Occurrence
+
+	Minutes int
+}
+
+// newNextEventFormat returns the template used to show the next event in the label, with defaults
+// filled in from the given configuration.
+func newNextEventFormat(config *NextEventConfig) (*template.Template, error) {
+	format := config.Format
+	if format == "" {
+		format = DefaultNextEventFormat
+	}
+
+	tmpl, err := template.New("next_event").Parse(format)
+	if err != nil {
+		return nil, fmt.Errorf("clock: invalid next event format: %v", err)
+	}
+
+	return tmpl, nil
+}
+
+// formatNextEvent returns the text shown in the label for the given upcoming event, at the given
+// time, using the given template.
+func formatNextEvent(tmpl *template.Template, occurrence Occurrence, now time.Time) (string, error) {
+	data := nextEventData{
+		Occurrence: occurrence,
+		// Round up, so an event starting in 30 seconds is "in 1 min", not "in 0 min".
+		Minutes: int(math.Ceil(occurrence.Start.Sub(now).Minutes())),
+	}
+
+	var buf bytes.Buffer
+
+	err := tmpl.Execute(&buf, data)
+	if err != nil {
+		return "", err
+	}
+
+	return buf.String(), nil
+}
+
+// getAgendaText returns the rich text shown under the calendar for the given day's events.
+func getAgendaText(day time.Time, occurrences []Occurrence) string {
+	var buf bytes.Buffer
+
+	fmt.Fprintf(&buf, "<b>%s</b>", html.EscapeString(day.Format("Monday 2 January")))
+
+	if len(occurrences) == 0 {
+		buf.WriteString("<br>No events")
+		return buf.String()
+	}
+
+	buf.WriteString("<table cellspacing=\"2\">")
+
+	for _, occurrence := range occurrences {
+		when := "All day"
+		if !occurrence.AllDay {
+			when = fmt.Sprintf("%s–%s", occurrence.Start.Format("15:04"), occurrence.End.Format("15:04"))
+		}
+
+		what := html.EscapeString(occurrence.Summary)
+		if occurrence.Location != "" {
+			what += fmt.Sprintf("<br><small>%s</small>", html.EscapeString(occurrence.Location))
+		}
+
+		fmt.Fprintf(&buf, "<tr><td>%s</td><td>%s</td></tr>", html.EscapeString(when), what)
+	}
+
+	buf.WriteString("</table>")
+
+	return buf.String()
+}
+
+// getEventDays returns the start of each day that the given events happen on, in the given
+// location. Days may be repeated.
+func getEventDays(occurrences []Occurrence, location *time.Location) []time.Time {
+	var days []time.Time
+
+	for _, occurrence := range occurrences {
+		start := occurrence.Start.In(location)
+		first := time.Date(start.Year(), start.Month(), start.Day(), 0, 0, 0, 0, location)
+
+		// Events end at the end of their last minute, so an event that ends at midnight doesn't
+		// happen on the next day. Events with no duration still happen on the day they start.
+		for day := first; day.Equal(first) || day.Before(occurrence.End); day = addDays(day, 1) {
+			days = append(days, day)
+		}
+	}
+
+	return days
+}
@@ -0,0 +1,182 @@
+package clock
+
+import (
+	"time"
+
+	"github.com/seeruk/barbara/barbara"
+	"github.com/therecipe/qt/core"
+	"github.com/therecipe/qt/gui"
+	"github.com/therecipe/qt/widgets"
+)
+
+// calendar is a popup showing a month view calendar, with week numbers, and a button to go back to
+// today. If there are events, days with events are marked, and the selected day's events are listed
+// under the calendar.
+type calendar struct {
+	menu     *widgets.QMenu
+	calendar *widgets.QCalendarWidget
+	agenda   *widgets.QLabel
+	action   *widgets.QWidgetAction
+	location *time.Location
+	events   *events
+
+	// today is the current date in the clock's time zone, which may not be the system's time zone,
+	// so it's highlighted by us, rather than by the calendar widget.
+	today *core.QDate
+}
+
+// newCalendar returns a new calendar instance, showing dates in the given location. It must be
+// called on the main thread.
+func newCalendar(location *time.Location) *calendar {
+	menu := widgets.NewQMenu(nil)
+
+	container := widgets.NewQWidget(nil, 0)
+	container.SetContentsMargins(4, 4, 4, 4)
+
+	cal := widgets.NewQCalendarWidget(nil)
+	cal.SetVerticalHeaderFormat(widgets.QCalendarWidget__ISOWeekNumbers)
+	cal.SetGridVisible(false)
+
+	todayButton := widgets.NewQPushButton2("Today", nil)
+
+	agenda := widgets.NewQLabel(nil, core.Qt__Widget)
+	agenda.SetTextFormat(core.Qt__RichText)
+	agenda.SetWordWrap(true)
+	agenda.SetVisible(false)
+
+	layout := widgets.NewQVBoxLayout2(container)
+	layout.SetContentsMargins(0, 0, 0, 0)
+	layout.AddWidget(cal, 0, 0)
+	layout.AddWidget(todayButton, 0, core.Qt__AlignRight)
+	layout.AddWidget(agenda, 0, 0)
+
+	// The calendar isn't an action that can be triggered, it's just shown in the menu. Clicking on
+	// it doesn't close the menu.
+	action := widgets.NewQWidgetAction(menu)
+	action.SetDefaultWidget(container)
+
+	menu.AddActions([]*widgets.QAction{action.QAction_PTR()})
+
+	c := &calendar{
+		menu:     menu,
+		calendar: cal,
+		agenda:   agenda,
+		action:   action,
+		location: location,
+	}
+
+	todayButton.ConnectClicked(func(_ bool) {
+		c.showToday()
+	})
+
+	cal.ConnectCurrentPageChanged(func(_ int, _ int) {
+		c.updateFormats()
+	})
+
+	cal.ConnectSelectionChanged(c.updateAgenda)
+
+	return c
+}
+
+// show opens the calendar on the month of the given date, positioned next to the given widget, on
+// the side of the bar that's furthest from the edge of the screen.
+func (c *calendar) show(anchor widgets.QWidget_ITF, alignment barbara.ModuleAlignment, position barbara.WindowPosition, today time.Time) {
+	c.today = toQDate(today)
+	c.showToday()
+	c.updateFormats()
+
+	// Like the menu module, everything here is calculated when the popup is opened, because the bar
+	// could have moved since it was rendered.
+	widget := anchor.QWidget_PTR()
+
+	ash := widget.SizeHint()
+	csh := c.menu.SizeHint()
+
+	var x int
+	if alignment == barbara.ModuleAlignmentRight {
+		x = ash.Width() - csh.Width()
+	}
+
+	var y int
+	if position == barbara.WindowPositionBottom {
+		y = -csh.Height()
+	} else {
+		y = ash.Height()
+	}
+
+	c.menu.Popup(widget.MapToGlobal(core.NewQPoint2(x, y)), nil)
+}
+
+// setEvents sets the events shown in the calendar, e.g. after they've been read again. If events is
+// nil, no events are shown.
+func (c *calendar) setEvents(events *events) {
+	c.events = events
+	c.agenda.SetVisible(events != nil)
+
+	c.updateFormats()
+	c.updateAgenda()
+}
+
+// showToday selects today, and shows it's month.
+func (c *calendar) showToday() {
+	if c.today == nil {
+		return
+	}
+
+	c.calendar.SetSelectedDate(c.today)
+	c.calendar.SetCurrentPage(c.today.Year(), c.today.Month())
+}
+
+// updateFormats marks the days with events on the month being shown, and highlights today.
+func (c *calendar) updateFormats() {
+	// A null date clears the format of every date.
+	c.calendar.SetDateTextFormat(core.NewQDate(), gui.NewQTextCharFormat())
+
+	if c.events != nil {
+		// The month's page also shows the end of the previous month, and the start of the next.
+		first := time.Date(c.calendar.YearShown(), time.Month(c.calendar.MonthShown()), 1, 0, 0, 0, 0, c.location)
+		from, to := addDays(first, -7), addDays(first.AddDate(0, 1, 0), 14)
+
+		format := gui.NewQTextCharFormat()
+		format.SetFontWeight(int(gui.QFont__Bold))
+		format.SetForeground(gui.NewQBrush3(c.calendar.Palette().Color2(gui.QPalette__Highlight), core.Qt__SolidPattern))
+
+		for _, day := range getEventDays(c.events.Between(from, to), c.location) {
+			c.calendar.SetDateTextFormat(toQDate(day), format)
+		}
+	}
+
+	if c.today != nil {
+		format := c.calendar.DateTextFormat2(c.today)
+		format.SetFontWeight(int(gui.QFont__Bold))
+		format.SetFontUnderline(true)
+
+		c.calendar.SetDateTextFormat(c.today, format)
+	}
+}
+
+// updateAgenda lists the selected day's events under the calendar.
+func (c *calendar) updateAgenda() {
+	if c.events == nil {
+		return
+	}
+
+	selected := c.calendar.SelectedDate()
+	day := time.Date(selected.Year(), time.Month(selected.Month()), selected.Day(), 0, 0, 0, 0, c.location)
+
+	c.agenda.SetText(getAgendaText(day, c.events.Between(day, addDays(day, 1))))
+
+	if c.menu.IsVisible() {
+		c.menu.AdjustSize()
+	}
+}
+
+// destroy frees up the resources used by this calendar.
+func (c *calendar) destroy() {
+	c.menu.Destroy(true, true)
+}
+
+// toQDate returns the date of the given time, in it's time zone, as a QDate.
+func toQDate(t time.Time) *core.QDate {
+	return core.NewQDate3(t.Year(), int(t.Month()), t.Day())
+}
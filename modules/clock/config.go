@@ -1,7 +1,139 @@
 package clock
 
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/seeruk/barbara/barbara"
+)
+
+const (
+	// DefaultZoneFormat is the Go time format string used for extra time zones, if they don't have
+	// their own format.
+	DefaultZoneFormat = "Mon 15:04"
+	// DefaultNextEventFormat is the format of the next event shown in the label.
+	DefaultNextEventFormat = "· {{.Summary}} in {{.Minutes}} min"
+	// DefaultNextEventWithin is how soon the next event must start to be shown in the label.
+	DefaultNextEventWithin = time.Hour
+)
+
 // Config holds all clock module configuration.
 type Config struct {
 	// Format is a Go time format string. See the Go documentation for more information.
 	Format string `json:"format"`
+	// Timezone is the name of the time zone that the clock shows, from the IANA time zone
+	// database, e.g. "Europe/London". Defaults to the local time zone.
+	Timezone string `json:"timezone"`
+	// Zones are extra time zones, shown in the clock's tooltip.
+	Zones []ZoneConfig `json:"zones"`
+	// ICS lists local iCalendar files, or directories of them (e.g. calendars synced by
+	// vdirsyncer), whose events are shown in the calendar. A leading "~" is the user's home
+	// directory. Files are read again when they change.
+	ICS []string `json:"ics"`
+	// NextEvent shows the next event in the label, after the time, when it's starting soon. It
+	// needs ICS to be set.
+	NextEvent *NextEventConfig `json:"next_event"`
+}
+
+// NextEventConfig holds configuration for showing the next event in the clock's label.
+type NextEventConfig struct {
+	// Within is how soon the next event must start to be shown. Defaults to an hour.
+	Within barbara.Duration `json:"within"`
+	// Format is the format of the text shown after the time, as a text/template. The event's
+	// .Summary, .Location, and .Start can be used, as well as .Minutes, which is how many minutes
+	// it is until the event starts. Defaults to DefaultNextEventFormat.
+	Format string `json:"format"`
+}
+
+// ZoneConfig holds configuration for an extra time zone shown in the clock's tooltip. A zone may
+// also be configured using just a string, which is treated as Timezone.
+type ZoneConfig struct {
+	// Label is the name the time zone is shown with, e.g. a city or a team. Defaults to the name of
+	// the time zone.
+	Label string `json:"label,omitempty"`
+	// Timezone is the name of the time zone, from the IANA time zone database.
+	Timezone string `json:"timezone"`
+	// Format is a Go time format string. Defaults to DefaultZoneFormat.
+	Format string `json:"format,omitempty"`
+}
+
+// UnmarshalJSON allows a ZoneConfig to be unmarshalled from either an object, or a string that is
+// the name of a time zone.
+func (c *ZoneConfig) UnmarshalJSON(raw []byte) error {
+	var timezone string
+	if err := json.Unmarshal(raw, &timezone); err == nil {
+		*c = ZoneConfig{Timezone: timezone}
+		return nil
+	}
+
+	// Use a different type to avoid recursing back into this method.
+	type zoneConfig ZoneConfig
+
+	var config zoneConfig
+
+	err := json.Unmarshal(raw, &config)
+	if err != nil {
+		return err
+	}
+
+	*c = ZoneConfig(config)
+
+	return nil
+}
+
+// zone is an extra time zone, ready to be shown.
+type zone struct {
+	label    string
+	location *time.Location
+	format   string
+}
+
+// loadLocation returns the time zone with the given name, or the local time zone if the name is
+// empty.
+func loadLocation(name string) (*time.Location, error) {
+	if name == "" {
+		return time.Local, nil
+	}
+
+	location, err := time.LoadLocation(name)
+	if err != nil {
+		return nil, fmt.Errorf("clock: invalid timezone %q: %v", name, err)
+	}
+
+	return location, nil
+}
+
+// loadZones returns the extra time zones in the given configuration, with defaults filled in.
+func loadZones(configs []ZoneConfig) ([]zone, error) {
+	zones := make([]zone, 0, len(configs))
+
+	for _, config := range configs {
+		if config.Timezone == "" {
+			return nil, fmt.Errorf("clock: zone %q has no timezone", config.Label)
+		}
+
+		location, err := loadLocation(config.Timezone)
+		if err != nil {
+			return nil, err
+		}
+
+		z := zone{
+			label:    config.Label,
+			location: location,
+			format:   config.Format,
+		}
+
+		if z.label == "" {
+			z.label = config.Timezone
+		}
+
+		if z.format == "" {
+			z.format = DefaultZoneFormat
+		}
+
+		zones = append(zones, z)
+	}
+
+	return zones, nil
 }
@@ -0,0 +1,259 @@
+package clock
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Occurrence is a single occurrence of an event. Recurring events have an Occurrence for each time
+// they recur.
+type Occurrence struct {
+	Summary  string
+	Location string
+	Start    time.Time
+	End      time.Time
+	AllDay   bool
+}
+
+// maxCachedRanges is the most ranges of days that events keeps the occurrences of. The clock only
+// asks for a few (e.g. today, and the month shown in the calendar), but the days shown change
+// over time.
+const maxCachedRanges = 32
+
+// events holds every event read from the configured iCalendar files. Occurrences are cached, so
+// it's not safe for concurrent use once it's been loaded.
+type events struct {
+	location *time.Location
+	events   []event
+	// overrides holds, by UID, the recurrence IDs of occurrences that have been replaced (or
+	// cancelled) by another event.
+	overrides map[string][]time.Time
+	// cache holds the occurrences happening during ranges of whole days, so that recurring events
+	// aren't expanded again every time the same days are shown. Events are read again (and so
+	// the cache starts again) whenever the iCalendar files change.
+	cache map[eventsRange][]Occurrence
+}
+
+// eventsRange is a range of whole days, as Unix times, that events caches the occurrences of.
+type eventsRange struct {
+	from int64
+	to   int64
+}
+
+// loadEvents reads every event from the given iCalendar files, and from every ".ics" file in the
+// given directories (e.g. those synced by vdirsyncer). Files that can't be read are logged and
+// skipped, so one broken file doesn't hide every other event. Times without a time zone are in the
+// given location.
+func loadEvents(paths []string, location *time.Location) *events {
+	e := &events{
+		location:  location,
+		overrides: make(map[string][]time.Time),
+		cache:     make(map[eventsRange][]Occurrence),
+	}
+
+	for _, fileName := range findICSFiles(paths) {
+		fileEvents, err := readICSFile(fileName, location)
+		if err != nil {
+			log.Printf("clock: failed to read calendar %q: %v\n", fileName, err)
+			continue
+		}
+
+		for _, ev := range fileEvents {
+			if !ev.recurrenceID.IsZero() {
+				e.overrides[ev.uid] = append(e.overrides[ev.uid], ev.recurrenceID)
+			}
+
+			if !ev.cancelled {
+				e.events = append(e.events, ev)
+			}
+		}
+	}
+
+	return e
+}
+
+// Between returns every occurrence of every event that's happening at some point between the two
+// given times, ordered by when they start. Occurrences are in the location events were loaded in.
+func (e *events) Between(from, to time.Time) []Occurrence {
+	// Occurrences are found for whole days, so that they can be reused, e.g. as time goes by.
+	days := startOfDay(from.In(e.location))
+	daysEnd := startOfDay(to.In(e.location))
+	if daysEnd.Before(to) {
+		daysEnd = addDays(daysEnd, 1)
+	}
+
+	key := eventsRange{from: days.Unix(), to: daysEnd.Unix()}
+
+	cached, ok := e.cache[key]
+	if !ok {
+		cached = e.expand(days, daysEnd)
+
+		if len(e.cache) >= maxCachedRanges {
+			e.cache = make(map[eventsRange][]Occurrence)
+		}
+
+		e.cache[key] = cached
+	}
+
+	var occurrences []Occurrence
+	for _, occurrence := range cached {
+		if occurrence.Start.Before(to) && occurrence.End.After(from) {
+			occurrences = append(occurrences, occurrence)
+		}
+	}
+
+	return occurrences
+}
+
+// expand returns every occurrence of every event that's happening at some point between the two
+// given times, ordered by when they start.
+func (e *events) expand(from, to time.Time) []Occurrence {
+	var occurrences []Occurrence
+
+	for _, ev := range e.events {
+		if ev.rule == nil || !ev.recurrenceID.IsZero() {
+			if ev.start.Before(to) && ev.end.After(from) {
+				occurrences = append(occurrences, newOccurrence(ev, ev.start, e.location))
+			}
+
+			continue
+		}
+
+		// Occurrences that start before the range may still be happening during it.
+		duration := ev.end.Sub(ev.start)
+
+		for _, start := range ev.rule.occurrences(ev.start, from.Add(-duration), to) {
+			if containsTime(ev.exdates, start) || containsTime(e.overrides[ev.uid], start) {
+				continue
+			}
+
+			occurrence := newOccurrence(ev, start, e.location)
+			if occurrence.End.After(from) {
+				occurrences = append(occurrences, occurrence)
+			}
+		}
+	}
+
+	sort.SliceStable(occurrences, func(i, j int) bool {
+		return occurrences[i].Start.Before(occurrences[j].Start)
+	})
+
+	return occurrences
+}
+
+// Next returns the next event that starts after the given time, and before the given time limit.
+// All-day events are skipped, they don't start at a time worth counting down to. If there's no
+// such event, false is returned.
+func (e *events) Next(now, limit time.Time) (Occurrence, bool) {
+	for _, occurrence := range e.Between(now, limit) {
+		if !occurrence.AllDay && occurrence.Start.After(now) {
+			return occurrence, true
+		}
+	}
+
+	return Occurrence{}, false
+}
+
+// newOccurrence returns the occurrence of the given event that starts at the given time, in the
+// given location.
+func newOccurrence(ev event, start time.Time, location *time.Location) Occurrence {
+	end := start.Add(ev.end.Sub(ev.start))
+	if ev.allDay {
+		// All-day events last a number of days, not hours, which may not be the same thing.
+		end = addDays(start, int(ev.end.Sub(ev.start).Hours()/24+0.5))
+	}
+
+	return Occurrence{
+		Summary:  ev.summary,
+		Location: ev.location,
+		Start:    start.In(location),
+		End:      end.In(location),
+		AllDay:   ev.allDay,
+	}
+}
+
+// startOfDay returns midnight at the start of the given time's day, in it's location.
+func startOfDay(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+}
+
+// containsTime returns true if the given times include the given time.
+func containsTime(times []time.Time, t time.Time) bool {
+	for _, other := range times {
+		if other.Equal(t) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// findICSFiles returns the given files, along with every ".ics" file in the given directories, and
+// their subdirectories. A leading "~" in a path is the user's home directory.
+func findICSFiles(paths []string) []string {
+	var fileNames []string
+
+	for _, path := range paths {
+		if path == "~" || strings.HasPrefix(path, "~/") {
+			path = filepath.Join(os.Getenv("HOME"), path[1:])
+		}
+
+		err := filepath.Walk(path, func(fileName string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+
+			// Files that are given directly are read whatever they're called.
+			if !info.IsDir() && (fileName == path || strings.EqualFold(filepath.Ext(fileName), ".ics")) {
+				fileNames = append(fileNames, fileName)
+			}
+
+			return nil
+		})
+
+		if err != nil {
+			log.Printf("clock: failed to find calendars: %v\n", err)
+		}
+	}
+
+	return fileNames
+}
+
+// icsModified returns the latest time that any of the given iCalendar files, or directories of
+// them, was modified, along with how many files there are, so that changes (including files being
+// removed) can be spotted without reading everything.
+func icsModified(paths []string) (time.Time, int) {
+	var latest time.Time
+
+	fileNames := findICSFiles(paths)
+	for _, fileName := range fileNames {
+		info, err := os.Stat(fileName)
+		if err == nil && info.ModTime().After(latest) {
+			latest = info.ModTime()
+		}
+	}
+
+	return latest, len(fileNames)
+}
+
+// readICSFile reads every event in the iCalendar file with the given name.
+func readICSFile(fileName string, location *time.Location) ([]event, error) {
+	file, err := os.Open(fileName)
+	if err != nil {
+		return nil, err
+	}
+
+	defer file.Close()
+
+	evs, err := parseICS(file, location)
+	if err != nil {
+		return nil, fmt.Errorf("invalid calendar: %v", err)
+	}
+
+	return evs, nil
+}
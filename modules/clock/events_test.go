@@ -0,0 +1,86 @@
+package clock
+
+import (
+	"testing"
+	"time"
+)
+
+func TestEvents_Between(t *testing.T) {
+	london, err := time.LoadLocation("Europe/London")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	events := loadEvents([]string{"testdata"}, london)
+
+	at := func(day, hour, min int) time.Time {
+		return time.Date(2019, time.May, day, hour, min, 0, 0, london)
+	}
+
+	tests := []struct {
+		name     string
+		from     time.Time
+		to       time.Time
+		expected []Occurrence
+	}{
+		{
+			name: "all day",
+			from: at(6, 0, 0),
+			to:   at(7, 0, 0),
+			expected: []Occurrence{
+				{Summary: "Bank holiday", Start: at(6, 0, 0), End: at(7, 0, 0), AllDay: true},
+				{Summary: "Standup", Start: at(6, 9, 30), End: at(6, 9, 45)},
+			},
+		},
+		{
+			// The 8th is excluded by EXDATE, and the 10th is moved.
+			name: "overrides",
+			from: at(7, 0, 0),
+			to:   at(11, 0, 0),
+			expected: []Occurrence{
+				{Summary: "Standup (moved)", Start: at(10, 11, 0), End: at(10, 11, 15)},
+			},
+		},
+		{
+			// The 13th is cancelled.
+			name: "cancelled",
+			from: at(13, 0, 0),
+			to:   at(16, 0, 0),
+			expected: []Occurrence{
+				{Summary: "Standup", Start: at(15, 9, 30), End: at(15, 9, 45)},
+			},
+		},
+		{
+			// Occurrences that are happening at the start of the range are included.
+			name: "during",
+			from: at(15, 9, 40),
+			to:   at(15, 9, 50),
+			expected: []Occurrence{
+				{Summary: "Standup", Start: at(15, 9, 30), End: at(15, 9, 45)},
+			},
+		},
+		{
+			name: "ended",
+			from: at(15, 9, 45),
+			to:   at(15, 12, 0),
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			occurrences := events.Between(test.from, test.to)
+			if len(occurrences) != len(test.expected) {
+				t.Fatalf("expected %+v, got %+v", test.expected, occurrences)
+			}
+
+			for i, occurrence := range occurrences {
+				expected := test.expected[i]
+
+				if occurrence.Summary != expected.Summary || !occurrence.Start.Equal(expected.Start) ||
+					!occurrence.End.Equal(expected.End) || occurrence.AllDay != expected.AllDay {
+					t.Errorf("expected occurrence %d to be %+v, got %+v", i, expected, occurrence)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,307 @@
+package clock
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"strings"
+	"time"
+)
+
+// icsProperty is a single content line of an iCalendar file, e.g. "DTSTART;TZID=Europe/London:
+// 20190506T090000".
+type icsProperty struct {
+	name   string
+	params map[string]string
+	value  string
+}
+
+// event is a VEVENT read from an iCalendar file. Recurring events are expanded into occurrences by
+// the events type.
+type event struct {
+	uid      string
+	summary  string
+	location string
+	start    time.Time
+	end      time.Time
+	allDay   bool
+	rule     *rrule
+	exdates  []time.Time
+
+	// recurrenceID is set if this event replaces a single occurrence of a recurring event with the
+	// same UID, e.g. because it was moved.
+	recurrenceID time.Time
+	cancelled    bool
+}
+
+// parseICS reads every event from the given iCalendar data. Times without a time zone (and dates)
+// are in the given location. Only the parts of iCalendar needed to show an agenda are understood;
+// everything else is ignored. Events that can't be parsed are logged and skipped, so that one odd
+// event doesn't hide the rest of the calendar.
+func parseICS(r io.Reader, location *time.Location) ([]event, error) {
+	lines, err := unfoldICS(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var events []event
+	var current *event
+	var duration time.Duration
+	var depth int
+	var broken error
+
+	for _, line := range lines {
+		prop, err := parseICSProperty(line)
+		if err != nil {
+			// Lines that can't be parsed only matter if they're part of an event.
+			if current != nil && depth == 0 && broken == nil {
+				broken = err
+			}
+
+			continue
+		}
+
+		switch prop.name {
+		case "BEGIN":
+			if current != nil {
+				// Components nested in an event, e.g. VALARM, aren't needed.
+				depth++
+			} else if prop.value == "VEVENT" {
+				current = &event{}
+				duration = 0
+				broken = nil
+			}
+
+			continue
+		case "END":
+			if current == nil {
+				continue
+			}
+
+			if depth > 0 {
+				depth--
+				continue
+			}
+
+			if broken == nil && current.start.IsZero() {
+				broken = errors.New("no start")
+			}
+
+			if broken != nil {
+				log.Printf("clock: skipping invalid event %q: %v\n", current.summary, broken)
+				current = nil
+
+				continue
+			}
+
+			if current.end.IsZero() {
+				current.end = current.start.Add(duration)
+				if current.allDay && duration == 0 {
+					current.end = current.start.AddDate(0, 0, 1)
+				}
+			}
+
+			events = append(events, *current)
+			current = nil
+
+			continue
+		}
+
+		if current == nil || depth > 0 {
+			continue
+		}
+
+		switch prop.name {
+		case "UID":
+			current.uid = prop.value
+		case "SUMMARY":
+			current.summary = unescapeICSText(prop.value)
+		case "LOCATION":
+			current.location = unescapeICSText(prop.value)
+		case "STATUS":
+			current.cancelled = prop.value == "CANCELLED"
+		case "DTSTART":
+			current.start, current.allDay, err = parseICSTime(prop, location)
+		case "DTEND":
+			current.end, _, err = parseICSTime(prop, location)
+		case "DURATION":
+			duration, err = parseICSDuration(prop.value)
+		case "RECURRENCE-ID":
+			current.recurrenceID, _, err = parseICSTime(prop, location)
+		case "RRULE":
+			current.rule, err = parseRRule(prop.value, location)
+		case "EXDATE":
+			for _, value := range strings.Split(prop.value, ",") {
+				var exdate time.Time
+
+				exdate, _, err = parseICSTime(icsProperty{params: prop.params, value: value}, location)
+				if err != nil {
+					break
+				}
+
+				current.exdates = append(current.exdates, exdate)
+			}
+		}
+
+		if err != nil && broken == nil {
+			broken = fmt.Errorf("invalid %s: %v", prop.name, err)
+		}
+	}
+
+	return events, nil
+}
+
+// unfoldICS reads the content lines of the given iCalendar data, joining lines that have been
+// folded (i.e. continuation lines that start with a space or tab).
+func unfoldICS(r io.Reader) ([]string, error) {
+	var lines []string
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if line == "" {
+			continue
+		}
+
+		if (line[0] == ' ' || line[0] == '\t') && len(lines) > 0 {
+			lines[len(lines)-1] += line[1:]
+			continue
+		}
+
+		lines = append(lines, line)
+	}
+
+	return lines, scanner.Err()
+}
+
+// parseICSProperty parses a single unfolded content line.
+func parseICSProperty(line string) (icsProperty, error) {
+	prop := icsProperty{params: make(map[string]string)}
+
+	// The value starts after the first colon that isn't in a quoted parameter value.
+	var quoted bool
+	colon := -1
+
+	for i, r := range line {
+		if r == '"' {
+			quoted = !quoted
+		} else if r == ':' && !quoted {
+			colon = i
+			break
+		}
+	}
+
+	if colon < 0 {
+		return prop, fmt.Errorf("invalid line %q", line)
+	}
+
+	prop.value = line[colon+1:]
+
+	parts := strings.Split(line[:colon], ";")
+	prop.name = strings.ToUpper(parts[0])
+
+	for _, param := range parts[1:] {
+		kv := strings.SplitN(param, "=", 2)
+		if len(kv) == 2 {
+			prop.params[strings.ToUpper(kv[0])] = strings.Trim(kv[1], "\"")
+		}
+	}
+
+	return prop, nil
+}
+
+// parseICSTime parses the given date or date-time property. Date-times without a time zone, or in
+// time zones that can't be found, are in the given location. Dates are returned as midnight in the
+// given location, along with true.
+func parseICSTime(prop icsProperty, location *time.Location) (time.Time, bool, error) {
+	value := prop.value
+
+	if prop.params["VALUE"] == "DATE" || len(value) == len("20060102") {
+		t, err := time.ParseInLocation("20060102", value, location)
+		return t, true, err
+	}
+
+	if strings.HasSuffix(value, "Z") {
+		// Times in UTC are left in UTC, so that recurring events stay at the same time in UTC.
+		t, err := time.Parse("20060102T150405Z", value)
+		return t, false, err
+	}
+
+	tzLocation := location
+	if tzid := prop.params["TZID"]; tzid != "" {
+		// Some calendars use time zone names that aren't in the IANA database (e.g. Windows time
+		// zone names), in which case the time is treated as local, which is usually right.
+		if loaded, err := time.LoadLocation(tzid); err == nil {
+			tzLocation = loaded
+		}
+	}
+
+	t, err := time.ParseInLocation("20060102T150405", value, tzLocation)
+
+	return t, false, err
+}
+
+// parseICSDuration parses an iCalendar duration, e.g. "PT1H30M", or "P1D".
+func parseICSDuration(value string) (time.Duration, error) {
+	str := value
+
+	sign := time.Duration(1)
+	switch {
+	case strings.HasPrefix(str, "-"):
+		sign = -1
+		str = str[1:]
+	case strings.HasPrefix(str, "+"):
+		str = str[1:]
+	}
+
+	if !strings.HasPrefix(str, "P") {
+		return 0, fmt.Errorf("invalid duration %q", value)
+	}
+
+	units := map[byte]time.Duration{
+		'W': 7 * 24 * time.Hour,
+		'D': 24 * time.Hour,
+		'H': time.Hour,
+		'M': time.Minute,
+		'S': time.Second,
+	}
+
+	var duration time.Duration
+	var n int
+	var digits bool
+
+	for i := 1; i < len(str); i++ {
+		c := str[i]
+
+		switch {
+		case c == 'T':
+			continue
+		case c >= '0' && c <= '9':
+			n = n*10 + int(c-'0')
+			digits = true
+		case units[c] > 0 && digits:
+			duration += time.Duration(n) * units[c]
+			n = 0
+			digits = false
+		default:
+			return 0, fmt.Errorf("invalid duration %q", value)
+		}
+	}
+
+	return sign * duration, nil
+}
+
+// unescapeICSText unescapes an iCalendar text value.
+func unescapeICSText(value string) string {
+	return strings.NewReplacer(
+		"\\n", "\n",
+		"\\N", "\n",
+		"\\,", ",",
+		"\\;", ";",
+		"\\\\", "\\",
+	).Replace(value)
+}
@@ -0,0 +1,285 @@
+package clock
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestUnfoldICS(t *testing.T) {
+	tests := []struct {
+		name     string
+		data     string
+		expected []string
+	}{
+		{
+			name:     "unfolded",
+			data:     "BEGIN:VEVENT\r\nSUMMARY:Standup\r\nEND:VEVENT\r\n",
+			expected: []string{"BEGIN:VEVENT", "SUMMARY:Standup", "END:VEVENT"},
+		},
+		{
+			name:     "space",
+			data:     "DESCRIPTION:This is a lo\r\n ng description\r\nEND:VEVENT\r\n",
+			expected: []string{"DESCRIPTION:This is a long description", "END:VEVENT"},
+		},
+		{
+			name:     "tab",
+			data:     "SUMMARY:Stand\r\n\tup\r\n",
+			expected: []string{"SUMMARY:Standup"},
+		},
+		{
+			name:     "folded more than once",
+			data:     "SUMMARY:S\r\n ta\r\n  nd\r\n up\r\n",
+			expected: []string{"SUMMARY:Sta ndup"},
+		},
+		{
+			// Some calendars don't bother with carriage returns, or leave blank lines around.
+			name:     "line feeds",
+			data:     "BEGIN:VEVENT\n\nSUMMARY:Stand\n up\nEND:VEVENT",
+			expected: []string{"BEGIN:VEVENT", "SUMMARY:Standup", "END:VEVENT"},
+		},
+		{
+			// A continuation line with nothing to continue is kept as it is.
+			name:     "leading continuation",
+			data:     " SUMMARY:Standup\r\n",
+			expected: []string{" SUMMARY:Standup"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			lines, err := unfoldICS(strings.NewReader(test.data))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !reflect.DeepEqual(lines, test.expected) {
+				t.Errorf("expected %q, got %q", test.expected, lines)
+			}
+		})
+	}
+}
+
+func TestParseICS(t *testing.T) {
+	london, err := time.LoadLocation("Europe/London")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		data     string
+		expected []event
+	}{
+		{
+			name: "time zone",
+			data: "BEGIN:VEVENT\r\n" +
+				"UID:standup@example.com\r\n" +
+				"SUMMARY:Standup\\, daily\r\n" +
+				"LOCATION:Room 1\\nFloor 2\r\n" +
+				"DTSTART;TZID=Europe/London:20190506T093000\r\n" +
+				"DTEND;TZID=Europe/London:20190506T094500\r\n" +
+				"END:VEVENT\r\n",
+			expected: []event{{
+				uid:      "standup@example.com",
+				summary:  "Standup, daily",
+				location: "Room 1\nFloor 2",
+				start:    time.Date(2019, time.May, 6, 9, 30, 0, 0, london),
+				end:      time.Date(2019, time.May, 6, 9, 45, 0, 0, london),
+			}},
+		},
+		{
+			name: "duration",
+			data: "BEGIN:VEVENT\r\n" +
+				"SUMMARY:Lunch\r\n" +
+				"DTSTART:20190506T120000Z\r\n" +
+				"DURATION:PT1H30M\r\n" +
+				"END:VEVENT\r\n",
+			expected: []event{{
+				summary: "Lunch",
+				start:   time.Date(2019, time.May, 6, 12, 0, 0, 0, time.UTC),
+				end:     time.Date(2019, time.May, 6, 13, 30, 0, 0, time.UTC),
+			}},
+		},
+		{
+			// All-day events without an end last a day.
+			name: "all day",
+			data: "BEGIN:VEVENT\r\n" +
+				"SUMMARY:Bank holiday\r\n" +
+				"DTSTART;VALUE=DATE:20190506\r\n" +
+				"END:VEVENT\r\n",
+			expected: []event{{
+				summary: "Bank holiday",
+				start:   time.Date(2019, time.May, 6, 0, 0, 0, 0, london),
+				end:     time.Date(2019, time.May, 7, 0, 0, 0, 0, london),
+				allDay:  true,
+			}},
+		},
+		{
+			// Properties of components in events, like alarms, aren't the event's.
+			name: "nested",
+			data: "BEGIN:VEVENT\r\n" +
+				"SUMMARY:Dentist\r\n" +
+				"DTSTART:20190506T150000\r\n" +
+				"DTEND:20190506T153000\r\n" +
+				"BEGIN:VALARM\r\n" +
+				"SUMMARY:Reminder\r\n" +
+				"TRIGGER:-PT15M\r\n" +
+				"END:VALARM\r\n" +
+				"STATUS:CANCELLED\r\n" +
+				"END:VEVENT\r\n",
+			expected: []event{{
+				summary:   "Dentist",
+				start:     time.Date(2019, time.May, 6, 15, 0, 0, 0, london),
+				end:       time.Date(2019, time.May, 6, 15, 30, 0, 0, london),
+				cancelled: true,
+			}},
+		},
+		{
+			// Rule parts that aren't understood don't make the rule invalid.
+			name: "unknown rule parts",
+			data: "BEGIN:VEVENT\r\n" +
+				"DTSTART:20190506T093000\r\n" +
+				"DTEND:20190506T094500\r\n" +
+				"RRULE:FREQ=DAILY;X-NAME;BYSETPOS=1;WKST=SU\r\n" +
+				"END:VEVENT\r\n",
+			expected: []event{{
+				start: time.Date(2019, time.May, 6, 9, 30, 0, 0, london),
+				end:   time.Date(2019, time.May, 6, 9, 45, 0, 0, london),
+				rule:  &rrule{freq: "DAILY", interval: 1},
+			}},
+		},
+		{
+			name: "recurring",
+			data: "BEGIN:VEVENT\r\n" +
+				"UID:standup@example.com\r\n" +
+				"DTSTART:20190506T093000\r\n" +
+				"DTEND:20190506T094500\r\n" +
+				"RRULE:FREQ=WEEKLY;BYDAY=MO,-1FR;UNTIL=20190531\r\n" +
+				"EXDATE:20190508T093000,20190510T093000\r\n" +
+				"END:VEVENT\r\n" +
+				"BEGIN:VEVENT\r\n" +
+				"UID:standup@example.com\r\n" +
+				"RECURRENCE-ID:20190513T093000\r\n" +
+				"DTSTART:20190513T100000\r\n" +
+				"DTEND:20190513T101500\r\n" +
+				"END:VEVENT\r\n",
+			expected: []event{
+				{
+					uid:   "standup@example.com",
+					start: time.Date(2019, time.May, 6, 9, 30, 0, 0, london),
+					end:   time.Date(2019, time.May, 6, 9, 45, 0, 0, london),
+					rule: &rrule{
+						freq:     "WEEKLY",
+						interval: 1,
+						until:    time.Date(2019, time.June, 1, 0, 0, 0, 0, london).Add(-time.Nanosecond),
+						byDay:    []rruleWeekday{{weekday: time.Monday}, {n: -1, weekday: time.Friday}},
+					},
+					exdates: []time.Time{
+						time.Date(2019, time.May, 8, 9, 30, 0, 0, london),
+						time.Date(2019, time.May, 10, 9, 30, 0, 0, london),
+					},
+				},
+				{
+					uid:          "standup@example.com",
+					start:        time.Date(2019, time.May, 13, 10, 0, 0, 0, london),
+					end:          time.Date(2019, time.May, 13, 10, 15, 0, 0, london),
+					recurrenceID: time.Date(2019, time.May, 13, 9, 30, 0, 0, london),
+				},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			events, err := parseICS(strings.NewReader("BEGIN:VCALENDAR\r\n"+test.data+"END:VCALENDAR\r\n"), london)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			for i := range events {
+				events[i] = eventInUTC(events[i])
+			}
+
+			for i := range test.expected {
+				test.expected[i] = eventInUTC(test.expected[i])
+			}
+
+			if !reflect.DeepEqual(events, test.expected) {
+				t.Errorf("expected %+v, got %+v", test.expected, events)
+			}
+		})
+	}
+}
+
+func TestParseICS_Invalid(t *testing.T) {
+	valid := "BEGIN:VEVENT\r\nSUMMARY:Standup\r\nDTSTART:20190506T093000Z\r\nEND:VEVENT\r\n"
+
+	tests := []struct {
+		name    string
+		invalid string
+	}{
+		{"no start", "BEGIN:VEVENT\r\nSUMMARY:Broken\r\nEND:VEVENT\r\n"},
+		{"invalid line", "BEGIN:VEVENT\r\nSUMMARY\r\nDTSTART:20190506T093000Z\r\nEND:VEVENT\r\n"},
+		{"invalid start", "BEGIN:VEVENT\r\nDTSTART:2019-05-06\r\nEND:VEVENT\r\n"},
+		{"invalid duration", "BEGIN:VEVENT\r\nDTSTART:20190506T093000\r\nDURATION:1H\r\nEND:VEVENT\r\n"},
+		{"invalid rule", "BEGIN:VEVENT\r\nDTSTART:20190506T093000\r\nRRULE:FREQ=FORTNIGHTLY\r\nEND:VEVENT\r\n"},
+		{
+			// Nested components are skipped along with the rest of the broken event.
+			name: "nested",
+			invalid: "BEGIN:VEVENT\r\n" +
+				"DTSTART:20190506T093000\r\n" +
+				"RRULE:FREQ=DAILY;INTERVAL=-1\r\n" +
+				"BEGIN:VALARM\r\n" +
+				"TRIGGER:-PT15M\r\n" +
+				"END:VALARM\r\n" +
+				"END:VEVENT\r\n",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			// Only the broken event is skipped, wherever it is in the calendar.
+			data := "BEGIN:VCALENDAR\r\n" + valid + test.invalid + valid + "END:VCALENDAR\r\n"
+
+			events, err := parseICS(strings.NewReader(data), time.UTC)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if len(events) != 2 {
+				t.Fatalf("expected 2 events, got %+v", events)
+			}
+
+			for _, ev := range events {
+				if ev.summary != "Standup" {
+					t.Errorf("expected only the valid events, got %+v", ev)
+				}
+			}
+		})
+	}
+}
+
+// eventInUTC returns the given event with every time in UTC, so that events can be compared
+// without worrying about which *time.Location each time uses.
+func eventInUTC(ev event) event {
+	ev.start = ev.start.UTC()
+	ev.end = ev.end.UTC()
+	ev.recurrenceID = ev.recurrenceID.UTC()
+
+	var exdates []time.Time
+	for _, exdate := range ev.exdates {
+		exdates = append(exdates, exdate.UTC())
+	}
+
+	ev.exdates = exdates
+
+	if ev.rule != nil {
+		rule := *ev.rule
+		rule.until = rule.until.UTC()
+		ev.rule = &rule
+	}
+
+	return ev
+}
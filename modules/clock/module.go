@@ -3,22 +3,43 @@ package clock
 import (
 	"context"
 	"encoding/json"
+	"log"
+	"text/template"
 	"time"
 
 	"github.com/seeruk/barbara/barbara"
 	"github.com/therecipe/qt/core"
+	"github.com/therecipe/qt/gui"
 	"github.com/therecipe/qt/widgets"
 )
 
+// eventsCheckInterval is how often the configured iCalendar files are checked for changes.
+const eventsCheckInterval = 30 * time.Second
+
 // Module is a Barbara Module that presents a clock. It uses Go's time formatting, and is basically
-// just a label that gets updated every second.
+// just a label that gets updated every second. Other time zones can be shown in it's tooltip, and
+// clicking on it opens a calendar, showing events from local iCalendar files.
 type Module struct {
 	ctx context.Context
 	cfn context.CancelFunc
 
-	config Config
-	layout *widgets.QHBoxLayout
-	label  *widgets.QLabel
+	clock     barbara.Clock
+	config    Config
+	location  *time.Location
+	zones     []zone
+	nextFmt   *template.Template
+	alignment barbara.ModuleAlignment
+	position  barbara.WindowPosition
+	layout    *widgets.QHBoxLayout
+	label     *widgets.QLabel
+	tooltip   string
+	calendar  *calendar
+	events    *events
+
+	// The next event is only looked for once a minute, rather than every time the label is updated.
+	next        Occurrence
+	hasNext     bool
+	nextChecked time.Time
 }
 
 // NewModule returns a new clock Module instance.
@@ -31,8 +52,36 @@ func NewModule(mctx barbara.ModuleContext) (barbara.Module, error) {
 		return nil, err
 	}
 
+	location, err := loadLocation(config.Timezone)
+	if err != nil {
+		return nil, err
+	}
+
+	zones, err := loadZones(config.Zones)
+	if err != nil {
+		return nil, err
+	}
+
+	var nextFmt *template.Template
+	if config.NextEvent != nil {
+		if config.NextEvent.Within == 0 {
+			config.NextEvent.Within = barbara.Duration(DefaultNextEventWithin)
+		}
+
+		nextFmt, err = newNextEventFormat(config.NextEvent)
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	return &Module{
-		config: config,
+		clock:     mctx.Clock,
+		config:    config,
+		location:  location,
+		zones:     zones,
+		nextFmt:   nextFmt,
+		alignment: mctx.Alignment,
+		position:  mctx.Window.Position(),
 	}, nil
 }
 
@@ -41,24 +90,37 @@ func NewModule(mctx barbara.ModuleContext) (barbara.Module, error) {
 func (m *Module) Render() (widgets.QLayout_ITF, error) {
 	m.layout = widgets.NewQHBoxLayout()
 
-	m.label = widgets.NewQLabel2(time.Now().Format(m.config.Format), nil, core.Qt__Widget)
+	m.label = widgets.NewQLabel(nil, core.Qt__Widget)
 	m.label.SetAlignment(core.Qt__AlignCenter)
+	m.label.ConnectMousePressEvent(m.onMousePress)
+
+	m.calendar = newCalendar(m.location)
+
+	m.onTick()
 
 	m.ctx, m.cfn = context.WithCancel(context.Background())
 
-	go func() {
+	if len(m.config.ICS) > 0 {
+		go m.watchEvents(m.ctx)
+	}
+
+	go func(ctx context.Context) {
 		ticker := time.NewTicker(time.Second)
 
 		for {
 			select {
-			case <-m.ctx.Done():
+			case <-ctx.Done():
 				ticker.Stop()
 				return
 			case <-ticker.C:
-				m.label.SetText(time.Now().Format(m.config.Format))
+				barbara.RunOnMainThread(func() {
+					if ctx.Err() == nil {
+						m.onTick()
+					}
+				})
 			}
 		}
-	}()
+	}(m.ctx)
 
 	m.layout.AddWidget(m.label, 0, core.Qt__AlignJustify)
 
@@ -71,6 +133,10 @@ func (m *Module) Destroy() error {
 		m.cfn()
 	}
 
+	if m.calendar != nil {
+		m.calendar.destroy()
+	}
+
 	if m.layout != nil {
 		m.layout.DestroyQHBoxLayout()
 	}
@@ -83,6 +149,123 @@ func (m *Module) Destroy() error {
 	m.cfn = nil
 	m.layout = nil
 	m.label = nil
+	m.tooltip = ""
+	m.calendar = nil
+	m.events = nil
+	m.hasNext = false
+	m.nextChecked = time.Time{}
 
 	return nil
 }
+
+// Popup opens the calendar, positioned next to the clock.
+func (m *Module) Popup() {
+	if m.calendar == nil {
+		return
+	}
+
+	m.calendar.show(m.label, m.alignment, m.position, m.now())
+}
+
+// now returns the current time, in the clock's time zone.
+func (m *Module) now() time.Time {
+	return m.clock.Now().In(m.location)
+}
+
+// onTick updates the label, and it's tooltip, to show the current time. It must be called on the
+// main thread.
+func (m *Module) onTick() {
+	now := m.now()
+
+	text := now.Format(m.config.Format)
+	if next := m.nextEventText(now); next != "" {
+		text += " " + next
+	}
+
+	m.label.SetText(text)
+
+	// The tooltip only changes every minute or so, and setting it while it's shown makes it jump.
+	if tooltip := getTooltipText(now, m.zones); tooltip != m.tooltip {
+		m.tooltip = tooltip
+		m.label.SetToolTip(tooltip)
+	}
+}
+
+// onEvents shows the given events, after they've been read. It must be called on the main thread.
+func (m *Module) onEvents(events *events) {
+	m.events = events
+	m.nextChecked = time.Time{}
+	m.calendar.setEvents(events)
+	m.onTick()
+}
+
+// nextEventText returns the text shown in the label for the next event, at the given time, or an
+// empty string if the next event isn't shown, or isn't starting soon. It must be called on the
+// main thread.
+func (m *Module) nextEventText(now time.Time) string {
+	if m.events == nil || m.nextFmt == nil {
+		return ""
+	}
+
+	if now.Sub(m.nextChecked) >= time.Minute || now.Before(m.nextChecked) || (m.hasNext && !m.next.Start.After(now)) {
+		m.next, m.hasNext = m.events.Next(now, now.Add(m.config.NextEvent.Within.Duration()))
+		m.nextChecked = now
+	}
+
+	if !m.hasNext {
+		return ""
+	}
+
+	text, err := formatNextEvent(m.nextFmt, m.next, now)
+	if err != nil {
+		log.Printf("clock: failed to format next event: %v\n", err)
+		return ""
+	}
+
+	return text
+}
+
+// watchEvents reads the configured iCalendar files, and reads them again whenever they change,
+// until the given context is done. Reading happens in the background, because there may be a lot
+// of them.
+func (m *Module) watchEvents(ctx context.Context) {
+	ticker := time.NewTicker(eventsCheckInterval)
+	defer ticker.Stop()
+
+	var loaded bool
+	var modified time.Time
+	var count int
+
+	for {
+		latest, latestCount := icsModified(m.config.ICS)
+
+		if !loaded || latest.After(modified) || latestCount != count {
+			loaded, modified, count = true, latest, latestCount
+
+			events := loadEvents(m.config.ICS, m.location)
+
+			barbara.RunOnMainThread(func() {
+				if ctx.Err() == nil {
+					m.onEvents(events)
+				}
+			})
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// onMousePress is the mouse press handler for the label, used to open the calendar when the clock
+// is clicked. Other buttons are left alone, so they can still be used for actions.
+func (m *Module) onMousePress(event *gui.QMouseEvent) {
+	if event.Button() != core.Qt__LeftButton {
+		m.label.MousePressEventDefault(event)
+		return
+	}
+
+	m.Popup()
+}
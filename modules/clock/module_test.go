@@ -0,0 +1,42 @@
+package clock
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/seeruk/barbara/barbara"
+	"github.com/seeruk/barbara/barbara/barbaratest"
+)
+
+func TestMain(m *testing.M) {
+	barbaratest.Main(m)
+}
+
+func TestModule_Golden(t *testing.T) {
+	mbf := barbara.NewModuleFactory()
+	mbf.RegisterConstructor("clock", NewModule)
+
+	clock := barbara.FrozenClock(time.Date(2018, time.June, 1, 9, 30, 0, 0, time.UTC))
+	harness := barbaratest.NewHarness(mbf, barbara.NewServiceRegistry(), clock)
+	screen := barbara.NewVirtualScreen("test", 0, 0, 640, 480)
+
+	tests := []struct {
+		name   string
+		config string
+	}{
+		{"clock", `{"kind": "clock", "format": "15:04:05", "timezone": "UTC"}`},
+		{"clock_timezone", `{"kind": "clock", "format": "Mon 2 Jan 15:04 MST", "timezone": "America/New_York"}`},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			img, err := harness.RenderModule(json.RawMessage(test.config), screen)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			barbaratest.AssertGolden(t, test.name, img)
+		})
+	}
+}
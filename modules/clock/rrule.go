@@ -0,0 +1,397 @@
+package clock
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxRRulePeriods is the most periods (e.g. days, or weeks) that a recurrence rule is expanded
+// over in one go, so that a rule with no end doesn't run forever. Expansion starts near the
+// beginning of the requested range, so this only limits how long that range can be; for an hourly
+// event, it's over 5 years.
+const maxRRulePeriods = 50000
+
+// rruleWeekdays maps the weekdays used in recurrence rules to time.Weekday.
+var rruleWeekdays = map[string]time.Weekday{
+	"MO": time.Monday,
+	"TU": time.Tuesday,
+	"WE": time.Wednesday,
+	"TH": time.Thursday,
+	"FR": time.Friday,
+	"SA": time.Saturday,
+	"SU": time.Sunday,
+}
+
+// rruleUnits are the units of the frequencies that are expanded by simply adding time, rather
+// than by working with dates.
+var rruleUnits = map[string]time.Duration{
+	"SECONDLY": time.Second,
+	"MINUTELY": time.Minute,
+	"HOURLY":   time.Hour,
+}
+
+// rrule is a recurrence rule, from an event's RRULE property. The common parts of RFC 5545 are
+// supported: FREQ, INTERVAL, COUNT, UNTIL, BYDAY, BYMONTHDAY, and BYMONTH. Other parts (e.g.
+// BYSETPOS) are ignored, so some unusual rules will have extra occurrences.
+type rrule struct {
+	freq       string
+	interval   int
+	count      int
+	until      time.Time
+	byDay      []rruleWeekday
+	byMonthDay []int
+	byMonth    []time.Month
+}
+
+// rruleWeekday is a weekday in a BYDAY rule part, e.g. "MO", or "-1FR" (the last Friday). If n is
+// zero, every matching weekday is included.
+type rruleWeekday struct {
+	n       int
+	weekday time.Weekday
+}
+
+// parseRRule parses the given RRULE value. A date-time in UNTIL without a time zone is in the
+// given location. Rule parts that aren't supported are ignored, rather than making the whole
+// rule invalid.
+func parseRRule(value string, location *time.Location) (*rrule, error) {
+	r := &rrule{interval: 1}
+
+	for _, part := range strings.Split(value, ";") {
+		kv := strings.SplitN(part, "=", 2)
+		if len(kv) != 2 {
+			// Like unknown rule parts, parts that aren't understood at all are ignored.
+			continue
+		}
+
+		var err error
+
+		switch name, val := strings.ToUpper(kv[0]), kv[1]; name {
+		case "FREQ":
+			r.freq = val
+		case "INTERVAL":
+			r.interval, err = strconv.Atoi(val)
+			if err == nil && r.interval < 1 {
+				err = fmt.Errorf("invalid interval %d", r.interval)
+			}
+		case "COUNT":
+			r.count, err = strconv.Atoi(val)
+		case "UNTIL":
+			var date bool
+
+			r.until, date, err = parseICSTime(icsProperty{value: val}, location)
+			if date {
+				// An UNTIL date includes occurrences on that date.
+				r.until = r.until.AddDate(0, 0, 1).Add(-time.Nanosecond)
+			}
+		case "BYDAY":
+			for _, day := range strings.Split(val, ",") {
+				if len(day) < 2 {
+					return nil, fmt.Errorf("invalid weekday %q", day)
+				}
+
+				weekday, ok := rruleWeekdays[day[len(day)-2:]]
+				if !ok {
+					return nil, fmt.Errorf("invalid weekday %q", day)
+				}
+
+				var n int
+				if ordinal := day[:len(day)-2]; ordinal != "" {
+					n, err = strconv.Atoi(ordinal)
+					if err != nil {
+						break
+					}
+				}
+
+				r.byDay = append(r.byDay, rruleWeekday{n: n, weekday: weekday})
+			}
+		case "BYMONTHDAY":
+			for _, day := range strings.Split(val, ",") {
+				var n int
+
+				n, err = strconv.Atoi(day)
+				if err != nil {
+					break
+				}
+
+				r.byMonthDay = append(r.byMonthDay, n)
+			}
+		case "BYMONTH":
+			for _, month := range strings.Split(val, ",") {
+				var n int
+
+				n, err = strconv.Atoi(month)
+				if err != nil {
+					break
+				}
+
+				r.byMonth = append(r.byMonth, time.Month(n))
+			}
+		}
+
+		if err != nil {
+			return nil, fmt.Errorf("invalid rule part %q: %v", part, err)
+		}
+	}
+
+	switch r.freq {
+	case "DAILY", "WEEKLY", "MONTHLY", "YEARLY":
+	default:
+		if rruleUnits[r.freq] == 0 {
+			return nil, fmt.Errorf("invalid frequency %q", r.freq)
+		}
+	}
+
+	return r, nil
+}
+
+// occurrences returns the start of each occurrence of an event with this rule that started at the
+// given time, that starts at or after the given time, and before the given time, in order. The
+// event's own start is always the first occurrence.
+func (r *rrule) occurrences(start, after, before time.Time) []time.Time {
+	var times []time.Time
+
+	add := func(t time.Time) {
+		if !t.Before(after) {
+			times = append(times, t)
+		}
+	}
+
+	if !start.Before(before) {
+		return nil
+	}
+
+	add(start)
+	count := 1
+
+	// Rules with a COUNT have to be expanded from the start, to know which occurrence is the last.
+	// Otherwise, periods that end before the range starts can be skipped.
+	var first int
+	if r.count == 0 {
+		first = r.periodsBefore(start, after)
+	}
+
+	for period := first; period < first+maxRRulePeriods; period++ {
+		candidates := r.candidates(start, period*r.interval)
+
+		for _, candidate := range candidates {
+			if !candidate.After(start) {
+				continue
+			}
+
+			if !r.until.IsZero() && candidate.After(r.until) {
+				return times
+			}
+
+			if !candidate.Before(before) {
+				return times
+			}
+
+			if r.count > 0 && count >= r.count {
+				return times
+			}
+
+			add(candidate)
+			count++
+		}
+	}
+
+	return times
+}
+
+// periodsBefore returns how many whole intervals of the rule (e.g. every 2 weeks) there are between
+// an event's start, and the given time. Every occurrence in those intervals starts before the
+// given time. A period is left as a margin, because periods are counted in the event's location,
+// and occurrences may start later in their period than the event's start does.
+func (r *rrule) periodsBefore(start, t time.Time) int {
+	if !t.After(start) {
+		return 0
+	}
+
+	t = t.In(start.Location())
+
+	var periods int
+
+	switch r.freq {
+	case "DAILY":
+		periods = daysBetween(start, t)
+	case "WEEKLY":
+		periods = daysBetween(addDays(start, -daysSinceMonday(start.Weekday())), addDays(t, -daysSinceMonday(t.Weekday()))) / 7
+	case "MONTHLY":
+		periods = (t.Year()-start.Year())*12 + int(t.Month()-start.Month())
+	case "YEARLY":
+		periods = t.Year() - start.Year()
+	default:
+		periods = int(t.Sub(start) / rruleUnits[r.freq])
+	}
+
+	if periods <= 1 {
+		return 0
+	}
+
+	return (periods - 1) / r.interval
+}
+
+// candidates returns the possible occurrences in the period (e.g. the day, or the week) that's the
+// given number of periods after the event's start, in order.
+func (r *rrule) candidates(start time.Time, n int) []time.Time {
+	var times []time.Time
+
+	switch r.freq {
+	case "DAILY":
+		times = append(times, addDays(start, n))
+	case "WEEKLY":
+		// Weeks start on Monday.
+		weekStart := addDays(start, 7*n-daysSinceMonday(start.Weekday()))
+
+		if len(r.byDay) == 0 {
+			times = append(times, addDays(weekStart, daysSinceMonday(start.Weekday())))
+		}
+
+		for _, day := range r.byDay {
+			times = append(times, addDays(weekStart, daysSinceMonday(day.weekday)))
+		}
+	case "MONTHLY":
+		first := time.Date(start.Year(), start.Month()+time.Month(n), 1, 0, 0, 0, 0, start.Location())
+		times = r.monthCandidates(start, first.Year(), first.Month())
+	case "YEARLY":
+		months := r.byMonth
+		if len(months) == 0 {
+			months = []time.Month{start.Month()}
+		}
+
+		for _, month := range months {
+			times = append(times, r.monthCandidates(start, start.Year()+n, month)...)
+		}
+	default:
+		times = append(times, start.Add(time.Duration(n)*rruleUnits[r.freq]))
+	}
+
+	filtered := times[:0]
+	for _, t := range times {
+		if r.matches(t) {
+			filtered = append(filtered, t)
+		}
+	}
+
+	sort.Slice(filtered, func(i, j int) bool {
+		return filtered[i].Before(filtered[j])
+	})
+
+	return filtered
+}
+
+// monthCandidates returns the possible occurrences in the given month, at the same time of day as
+// the event's start. Without BYMONTHDAY or BYDAY, that's the same day of the month as the start, if
+// the month has that day.
+func (r *rrule) monthCandidates(start time.Time, year int, month time.Month) []time.Time {
+	daysInMonth := time.Date(year, month+1, 0, 0, 0, 0, 0, time.UTC).Day()
+
+	var days []int
+
+	switch {
+	case len(r.byMonthDay) > 0:
+		for _, day := range r.byMonthDay {
+			if day < 0 {
+				day = daysInMonth + day + 1
+			}
+
+			days = append(days, day)
+		}
+	case len(r.byDay) > 0:
+		for _, day := range r.byDay {
+			var matching []int
+			for d := 1; d <= daysInMonth; d++ {
+				if time.Date(year, month, d, 0, 0, 0, 0, time.UTC).Weekday() == day.weekday {
+					matching = append(matching, d)
+				}
+			}
+
+			switch {
+			case day.n == 0:
+				days = append(days, matching...)
+			case day.n > 0 && day.n <= len(matching):
+				days = append(days, matching[day.n-1])
+			case day.n < 0 && -day.n <= len(matching):
+				days = append(days, matching[len(matching)+day.n])
+			}
+		}
+	default:
+		days = append(days, start.Day())
+	}
+
+	var times []time.Time
+	for _, day := range days {
+		if day < 1 || day > daysInMonth {
+			continue
+		}
+
+		times = append(times, time.Date(year, month, day, start.Hour(), start.Minute(), start.Second(), 0, start.Location()))
+	}
+
+	return times
+}
+
+// matches returns true if the given time is allowed by the rule's BYMONTH, BYMONTHDAY, and BYDAY
+// parts. BYDAY ordinals (e.g. the "-1" in "-1FR") are handled when candidates are found, so only
+// the weekday is checked here.
+func (r *rrule) matches(t time.Time) bool {
+	if len(r.byMonth) > 0 {
+		var ok bool
+		for _, month := range r.byMonth {
+			ok = ok || t.Month() == month
+		}
+
+		if !ok {
+			return false
+		}
+	}
+
+	if len(r.byMonthDay) > 0 {
+		daysInMonth := time.Date(t.Year(), t.Month()+1, 0, 0, 0, 0, 0, time.UTC).Day()
+
+		var ok bool
+		for _, day := range r.byMonthDay {
+			ok = ok || t.Day() == day || t.Day() == daysInMonth+day+1
+		}
+
+		if !ok {
+			return false
+		}
+	}
+
+	if len(r.byDay) > 0 {
+		var ok bool
+		for _, day := range r.byDay {
+			ok = ok || t.Weekday() == day.weekday
+		}
+
+		if !ok {
+			return false
+		}
+	}
+
+	return true
+}
+
+// addDays returns the given time, the given number of days later, at the same time of day, even
+// if a daylight saving change happens in between.
+func addDays(t time.Time, days int) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day()+days, t.Hour(), t.Minute(), t.Second(), 0, t.Location())
+}
+
+// daysBetween returns how many days after the date of the first time the date of the second time
+// is, ignoring the time of day.
+func daysBetween(from, to time.Time) int {
+	fromDate := time.Date(from.Year(), from.Month(), from.Day(), 0, 0, 0, 0, time.UTC)
+	toDate := time.Date(to.Year(), to.Month(), to.Day(), 0, 0, 0, 0, time.UTC)
+
+	return int(toDate.Sub(fromDate).Hours() / 24)
+}
+
+// daysSinceMonday returns how many days after Monday the given weekday is.
+func daysSinceMonday(weekday time.Weekday) int {
+	return (int(weekday) + 6) % 7
+}
@@ -0,0 +1,204 @@
+package clock
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRRule_Occurrences(t *testing.T) {
+	london, err := time.LoadLocation("Europe/London")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	at := func(year int, month time.Month, day, hour, min int) time.Time {
+		return time.Date(year, month, day, hour, min, 0, 0, london)
+	}
+
+	tests := []struct {
+		name     string
+		rule     string
+		start    time.Time
+		after    time.Time
+		before   time.Time
+		expected []time.Time
+	}{
+		{
+			name:     "daily",
+			rule:     "FREQ=DAILY",
+			start:    at(2019, time.May, 6, 9, 30),
+			after:    at(2019, time.May, 6, 0, 0),
+			before:   at(2019, time.May, 9, 0, 0),
+			expected: []time.Time{at(2019, time.May, 6, 9, 30), at(2019, time.May, 7, 9, 30), at(2019, time.May, 8, 9, 30)},
+		},
+		{
+			// Daily events stay at the same time of day when the clocks change.
+			name:     "daylight saving",
+			rule:     "FREQ=DAILY",
+			start:    at(2019, time.March, 30, 9, 30),
+			after:    at(2019, time.March, 30, 0, 0),
+			before:   at(2019, time.April, 1, 0, 0),
+			expected: []time.Time{at(2019, time.March, 30, 9, 30), at(2019, time.March, 31, 9, 30)},
+		},
+		{
+			name:     "interval",
+			rule:     "FREQ=DAILY;INTERVAL=3",
+			start:    at(2019, time.May, 6, 9, 30),
+			after:    at(2019, time.May, 10, 0, 0),
+			before:   at(2019, time.May, 20, 0, 0),
+			expected: []time.Time{at(2019, time.May, 12, 9, 30), at(2019, time.May, 15, 9, 30), at(2019, time.May, 18, 9, 30)},
+		},
+		{
+			name:   "weekly by day",
+			rule:   "FREQ=WEEKLY;BYDAY=MO,WE,FR",
+			start:  at(2019, time.May, 8, 9, 30),
+			after:  at(2019, time.May, 1, 0, 0),
+			before: at(2019, time.May, 16, 0, 0),
+			expected: []time.Time{
+				at(2019, time.May, 8, 9, 30),
+				at(2019, time.May, 10, 9, 30),
+				at(2019, time.May, 13, 9, 30),
+				at(2019, time.May, 15, 9, 30),
+			},
+		},
+		{
+			name:     "fortnightly",
+			rule:     "FREQ=WEEKLY;INTERVAL=2;BYDAY=TU",
+			start:    at(2019, time.May, 7, 14, 0),
+			after:    at(2019, time.June, 1, 0, 0),
+			before:   at(2019, time.July, 1, 0, 0),
+			expected: []time.Time{at(2019, time.June, 4, 14, 0), at(2019, time.June, 18, 14, 0)},
+		},
+		{
+			name:     "monthly last weekday",
+			rule:     "FREQ=MONTHLY;BYDAY=-1FR",
+			start:    at(2019, time.May, 31, 16, 0),
+			after:    at(2019, time.June, 1, 0, 0),
+			before:   at(2019, time.September, 1, 0, 0),
+			expected: []time.Time{at(2019, time.June, 28, 16, 0), at(2019, time.July, 26, 16, 0), at(2019, time.August, 30, 16, 0)},
+		},
+		{
+			// Months without the day are skipped.
+			name:     "monthly by month day",
+			rule:     "FREQ=MONTHLY;BYMONTHDAY=31",
+			start:    at(2019, time.January, 31, 12, 0),
+			after:    at(2019, time.January, 1, 0, 0),
+			before:   at(2019, time.June, 1, 0, 0),
+			expected: []time.Time{at(2019, time.January, 31, 12, 0), at(2019, time.March, 31, 12, 0), at(2019, time.May, 31, 12, 0)},
+		},
+		{
+			name:     "yearly",
+			rule:     "FREQ=YEARLY;BYMONTH=5;BYDAY=1MO",
+			start:    at(2019, time.May, 6, 0, 0),
+			after:    at(2020, time.January, 1, 0, 0),
+			before:   at(2022, time.January, 1, 0, 0),
+			expected: []time.Time{at(2020, time.May, 4, 0, 0), at(2021, time.May, 3, 0, 0)},
+		},
+		{
+			name:     "until",
+			rule:     "FREQ=WEEKLY;UNTIL=20190520",
+			start:    at(2019, time.May, 6, 9, 30),
+			after:    at(2019, time.May, 1, 0, 0),
+			before:   at(2019, time.June, 1, 0, 0),
+			expected: []time.Time{at(2019, time.May, 6, 9, 30), at(2019, time.May, 13, 9, 30), at(2019, time.May, 20, 9, 30)},
+		},
+		{
+			name:     "until time",
+			rule:     "FREQ=DAILY;UNTIL=20190507T083000Z",
+			start:    at(2019, time.May, 6, 9, 30),
+			after:    at(2019, time.May, 1, 0, 0),
+			before:   at(2019, time.June, 1, 0, 0),
+			expected: []time.Time{at(2019, time.May, 6, 9, 30), at(2019, time.May, 7, 9, 30)},
+		},
+		{
+			// The event's own start counts towards the count.
+			name:     "count",
+			rule:     "FREQ=DAILY;COUNT=3",
+			start:    at(2019, time.May, 6, 9, 30),
+			after:    at(2019, time.May, 1, 0, 0),
+			before:   at(2019, time.June, 1, 0, 0),
+			expected: []time.Time{at(2019, time.May, 6, 9, 30), at(2019, time.May, 7, 9, 30), at(2019, time.May, 8, 9, 30)},
+		},
+		{
+			// Occurrences before the range still count towards the count.
+			name:     "count after",
+			rule:     "FREQ=WEEKLY;BYDAY=MO,FR;COUNT=4",
+			start:    at(2019, time.May, 6, 9, 30),
+			after:    at(2019, time.May, 12, 0, 0),
+			before:   at(2019, time.June, 1, 0, 0),
+			expected: []time.Time{at(2019, time.May, 13, 9, 30), at(2019, time.May, 17, 9, 30)},
+		},
+		{
+			name:     "hourly",
+			rule:     "FREQ=HOURLY;INTERVAL=8",
+			start:    at(2019, time.May, 6, 9, 30),
+			after:    at(2019, time.May, 7, 0, 0),
+			before:   at(2019, time.May, 8, 0, 0),
+			expected: []time.Time{at(2019, time.May, 7, 1, 30), at(2019, time.May, 7, 9, 30), at(2019, time.May, 7, 17, 30)},
+		},
+		{
+			// Rules are expanded from near the range, so they don't run out after some time.
+			name:     "hourly years later",
+			rule:     "FREQ=HOURLY",
+			start:    at(2019, time.May, 6, 9, 30),
+			after:    at(2039, time.May, 7, 0, 0),
+			before:   at(2039, time.May, 7, 2, 0),
+			expected: []time.Time{at(2039, time.May, 7, 0, 30), at(2039, time.May, 7, 1, 30)},
+		},
+		{
+			name:     "daily centuries later",
+			rule:     "FREQ=DAILY",
+			start:    at(2019, time.May, 6, 9, 30),
+			after:    at(2219, time.May, 7, 0, 0),
+			before:   at(2219, time.May, 8, 0, 0),
+			expected: []time.Time{at(2219, time.May, 7, 9, 30)},
+		},
+		{
+			name:   "before start",
+			rule:   "FREQ=DAILY",
+			start:  at(2019, time.May, 6, 9, 30),
+			after:  at(2019, time.May, 1, 0, 0),
+			before: at(2019, time.May, 6, 9, 30),
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			rule, err := parseRRule(test.rule, london)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			occurrences := rule.occurrences(test.start, test.after, test.before)
+			if len(occurrences) != len(test.expected) {
+				t.Fatalf("expected %v, got %v", test.expected, occurrences)
+			}
+
+			for i, occurrence := range occurrences {
+				if !occurrence.Equal(test.expected[i]) {
+					t.Errorf("expected occurrence %d to be %v, got %v", i, test.expected[i], occurrence)
+				}
+			}
+		})
+	}
+}
+
+func TestParseRRule_Invalid(t *testing.T) {
+	tests := []string{
+		"FREQ=FORTNIGHTLY",
+		"FREQ=DAILY;INTERVAL=0",
+		"FREQ=DAILY;COUNT=many",
+		"FREQ=WEEKLY;BYDAY=XX",
+		"FREQ=MONTHLY;BYDAY=ZFR",
+		"FREQ=DAILY;UNTIL=tomorrow",
+	}
+
+	for _, test := range tests {
+		t.Run(test, func(t *testing.T) {
+			_, err := parseRRule(test, time.UTC)
+			if err == nil {
+				t.Error("expected an error")
+			}
+		})
+	}
+}
@@ -0,0 +1,60 @@
+package clock
+
+import (
+	"bytes"
+	"fmt"
+	"html"
+	"time"
+)
+
+// getTooltipText returns the rich text shown in the clock's tooltip at the given time, which is in
+// the clock's time zone. Each extra time zone gets a row, along with how far it is ahead of, or
+// behind, the clock's time zone. If there are no extra time zones, the tooltip is empty.
+func getTooltipText(now time.Time, zones []zone) string {
+	if len(zones) == 0 {
+		return ""
+	}
+
+	_, offset := now.Zone()
+
+	var buf bytes.Buffer
+
+	buf.WriteString("<table cellspacing=\"2\">")
+
+	for _, z := range zones {
+		zoned := now.In(z.location)
+		_, zoneOffset := zoned.Zone()
+
+		fmt.Fprintf(&buf, "<tr><td>%s</td><td>%s</td><td>%s</td></tr>",
+			html.EscapeString(z.label),
+			html.EscapeString(zoned.Format(z.format)),
+			html.EscapeString(formatOffset(time.Duration(zoneOffset-offset)*time.Second)),
+		)
+	}
+
+	buf.WriteString("</table>")
+
+	return buf.String()
+}
+
+// formatOffset returns the difference between two time zones, e.g. "+5h", "−3h30m", or "same time".
+func formatOffset(offset time.Duration) string {
+	if offset == 0 {
+		return "same time"
+	}
+
+	sign := "+"
+	if offset < 0 {
+		sign = "−"
+		offset = -offset
+	}
+
+	hours := offset / time.Hour
+	minutes := (offset % time.Hour) / time.Minute
+
+	if minutes == 0 {
+		return fmt.Sprintf("%s%dh", sign, hours)
+	}
+
+	return fmt.Sprintf("%s%dh%02dm", sign, hours, minutes)
+}
@@ -0,0 +1,20 @@
+package exec
+
+import "github.com/seeruk/barbara/barbara"
+
+// Config holds all exec module configuration.
+type Config struct {
+	// Command is the command to run. It is run using the shell, so it may be a shell snippet.
+	Command string `json:"command"`
+	// Interval is how often the command is run. When Persistent is true, it is instead how long to
+	// wait before restarting the command if it exits. Defaults to 10 seconds.
+	Interval barbara.Duration `json:"interval"`
+	// Persistent runs the command once, as a long-running process. Each line the command outputs
+	// replaces the text shown on the bar.
+	Persistent bool `json:"persistent"`
+	// Timeout is how long the command may run for before it is killed. Defaults to the interval.
+	// Ignored when Persistent is true.
+	Timeout barbara.Duration `json:"timeout"`
+	// Env is additional environment variables that are set when running the command.
+	Env map[string]string `json:"env"`
+}
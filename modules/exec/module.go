@@ -0,0 +1,242 @@
+package exec
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	osexec "os/exec"
+	"strings"
+	"time"
+
+	"github.com/seeruk/barbara/barbara"
+	"github.com/therecipe/qt/core"
+	"github.com/therecipe/qt/widgets"
+)
+
+// defaultInterval is the interval used if no interval is configured.
+const defaultInterval = 10 * time.Second
+
+// Module is a Barbara Module that shows the output of a command. The command is either run on an
+// interval, showing it's output each time it exits, or once as a long-running process, showing each
+// line it outputs as it's written.
+type Module struct {
+	ctx context.Context
+	cfn context.CancelFunc
+
+	config Config
+	env    []string
+	layout *widgets.QHBoxLayout
+	label  *widgets.QLabel
+}
+
+// NewModule returns a new exec Module instance.
+func NewModule(mctx barbara.ModuleContext) (barbara.Module, error) {
+	var config Config
+
+	err := json.Unmarshal(mctx.Config, &config)
+	if err != nil {
+		// TODO(elliot): More context.
+		return nil, err
+	}
+
+	if config.Command == "" {
+		return nil, fmt.Errorf("exec: a command must be configured")
+	}
+
+	if config.Interval <= 0 {
+		config.Interval = barbara.Duration(defaultInterval)
+	}
+
+	if config.Timeout <= 0 {
+		config.Timeout = config.Interval
+	}
+
+	env := os.Environ()
+	for name, value := range config.Env {
+		env = append(env, fmt.Sprintf("%s=%s", name, value))
+	}
+
+	return &Module{
+		config: config,
+		env:    env,
+	}, nil
+}
+
+// Render starts a background process that runs the configured command, and returns a label that
+// will show the command's output, ready to be placed on a bar.
+func (m *Module) Render() (widgets.QLayout_ITF, error) {
+	m.layout = widgets.NewQHBoxLayout()
+
+	m.label = widgets.NewQLabel(nil, core.Qt__Widget)
+	m.label.SetAlignment(core.Qt__AlignCenter)
+
+	m.ctx, m.cfn = context.WithCancel(context.Background())
+
+	if m.config.Persistent {
+		go m.runPersistent(m.ctx)
+	} else {
+		go m.runInterval(m.ctx)
+	}
+
+	m.layout.AddWidget(m.label, 0, core.Qt__AlignJustify)
+
+	return m.layout, nil
+}
+
+// Destroy stops background processes, killing the command if it's running, and frees up resources.
+func (m *Module) Destroy() error {
+	if m.cfn != nil {
+		m.cfn()
+	}
+
+	if m.layout != nil {
+		m.layout.DestroyQHBoxLayout()
+	}
+
+	if m.label != nil {
+		m.label.Destroy(true, true)
+	}
+
+	m.ctx = nil
+	m.cfn = nil
+	m.layout = nil
+	m.label = nil
+
+	return nil
+}
+
+// runInterval runs the command immediately, and then again every interval, until the given context
+// is done. The output is shown each time the command exits.
+func (m *Module) runInterval(ctx context.Context) {
+	ticker := time.NewTicker(m.config.Interval.Duration())
+	defer ticker.Stop()
+
+	for {
+		m.runOnce(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// runOnce runs the command, waiting for it to exit or time out, and then shows it's output.
+func (m *Module) runOnce(ctx context.Context) {
+	runCtx, cfn := context.WithTimeout(ctx, m.config.Timeout.Duration())
+	defer cfn()
+
+	var stdout bytes.Buffer
+
+	cmd := m.command(runCtx)
+	cmd.Stdout = &stdout
+
+	err := cmd.Run()
+
+	switch runCtx.Err() {
+	case context.Canceled:
+		// The module is being destroyed, there's nothing to show the output on.
+		return
+	case context.DeadlineExceeded:
+		err = fmt.Errorf("timed out after %v", m.config.Timeout.Duration())
+	}
+
+	m.update(ctx, strings.TrimSpace(stdout.String()), err)
+}
+
+// runPersistent runs the command as a long-running process, showing each line it outputs. If the
+// command exits, it is restarted after the configured interval, until the given context is done.
+func (m *Module) runPersistent(ctx context.Context) {
+	for {
+		last, err := m.runStream(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		default:
+		}
+
+		if err == nil {
+			err = fmt.Errorf("exited")
+		}
+
+		// Keep showing the last line the command output, so it's clear what it was doing.
+		m.update(ctx, last, err)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(m.config.Interval.Duration()):
+		}
+	}
+}
+
+// runStream starts the command, showing each line it outputs, and blocks until it exits. The last
+// line that the command output is returned.
+func (m *Module) runStream(ctx context.Context) (string, error) {
+	cmd := m.command(ctx)
+
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return "", err
+	}
+
+	err = cmd.Start()
+	if err != nil {
+		return "", err
+	}
+
+	var last string
+
+	scanner := bufio.NewScanner(stdout)
+	for scanner.Scan() {
+		last = scanner.Text()
+
+		// Carry on reading until the command has been killed, update ignores lines once the
+		// context is done.
+		m.update(ctx, last, nil)
+	}
+
+	return last, cmd.Wait()
+}
+
+// command returns a new command that will run the configured command using the shell, killing it
+// once the given context is done.
+func (m *Module) command(ctx context.Context) *osexec.Cmd {
+	cmd := osexec.CommandContext(ctx, "sh", "-c", m.config.Command)
+	cmd.Env = m.env
+
+	return cmd
+}
+
+// update shows the given output on the label, on the main thread, unless the given context is done
+// by then. The first line of output is shown on the bar, and the full output is available in the
+// tooltip. If err is not nil, the label is styled as an error.
+func (m *Module) update(ctx context.Context, output string, err error) {
+	lines := strings.Split(output, "\n")
+
+	tooltip := output
+	if err != nil {
+		tooltip = strings.TrimSpace(fmt.Sprintf("%s\n\n%s: %v", output, m.config.Command, err))
+	}
+
+	barbara.RunOnMainThread(func() {
+		// The module may have been destroyed since the output was read.
+		if ctx.Err() != nil {
+			return
+		}
+
+		m.label.SetText(lines[0])
+		m.label.SetToolTip(tooltip)
+
+		if err != nil {
+			barbara.SetClass(m.label, barbara.ClassError)
+		} else {
+			barbara.SetClass(m.label)
+		}
+	})
+}
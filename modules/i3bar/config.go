@@ -0,0 +1,10 @@
+package i3bar
+
+// Config holds all i3bar module configuration.
+type Config struct {
+	// Command is the status command to run, e.g. "i3status". It is run using the shell, and must
+	// output the i3bar JSON protocol.
+	Command string `json:"command"`
+	// Env is additional environment variables that are set when running the command.
+	Env map[string]string `json:"env"`
+}
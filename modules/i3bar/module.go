@@ -0,0 +1,360 @@
+package i3bar
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+
+	"github.com/seeruk/barbara/barbara"
+	"github.com/therecipe/qt/core"
+	"github.com/therecipe/qt/gui"
+	"github.com/therecipe/qt/widgets"
+)
+
+// Module is a Barbara Module that runs a status command using the i3bar protocol (e.g. i3status),
+// showing each block the command outputs as it's own label.
+type Module struct {
+	ctx context.Context
+	cfn context.CancelFunc
+
+	config Config
+	layout *widgets.QHBoxLayout
+	items  []*blockItem
+
+	clicks      io.Writer
+	clicksMu    sync.Mutex
+	clickEvents bool
+}
+
+// blockItem holds the widgets used to show a single block.
+type blockItem struct {
+	block     Block
+	label     *widgets.QLabel
+	separator *widgets.QFrame
+}
+
+// NewModule returns a new i3bar Module instance.
+func NewModule(mctx barbara.ModuleContext) (barbara.Module, error) {
+	var config Config
+
+	err := json.Unmarshal(mctx.Config, &config)
+	if err != nil {
+		// TODO(elliot): More context.
+		return nil, err
+	}
+
+	if config.Command == "" {
+		return nil, fmt.Errorf("i3bar: a command must be configured")
+	}
+
+	return &Module{
+		config: config,
+	}, nil
+}
+
+// Render starts the status command, and returns a layout that blocks will be placed in as they're
+// received, ready to be placed on a bar.
+func (m *Module) Render() (widgets.QLayout_ITF, error) {
+	m.layout = widgets.NewQHBoxLayout()
+	m.layout.SetSpacing(0)
+
+	m.ctx, m.cfn = context.WithCancel(context.Background())
+
+	go func(ctx context.Context) {
+		err := m.run(ctx)
+		if ctx.Err() != nil {
+			// The module has been destroyed, the command was killed on purpose.
+			return
+		}
+
+		if err == nil {
+			err = fmt.Errorf("exited")
+		}
+
+		log.Printf("i3bar: %q: %v\n", m.config.Command, err)
+
+		barbara.RunOnMainThread(func() {
+			if ctx.Err() == nil {
+				m.showError(err)
+			}
+		})
+	}(m.ctx)
+
+	return m.layout, nil
+}
+
+// Destroy stops background processes, killing the command, and frees up resources.
+func (m *Module) Destroy() error {
+	if m.cfn != nil {
+		m.cfn()
+	}
+
+	for _, item := range m.items {
+		item.destroy()
+	}
+
+	if m.layout != nil {
+		m.layout.DestroyQHBoxLayout()
+	}
+
+	m.ctx = nil
+	m.cfn = nil
+	m.layout = nil
+	m.items = nil
+
+	return nil
+}
+
+// run starts the status command, and updates the bar with each status line it outputs, until the
+// given context is done, or the command exits.
+func (m *Module) run(ctx context.Context) error {
+	cmd := exec.CommandContext(ctx, "sh", "-c", m.config.Command)
+	cmd.Env = os.Environ()
+	for name, value := range m.config.Env {
+		cmd.Env = append(cmd.Env, fmt.Sprintf("%s=%s", name, value))
+	}
+
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return err
+	}
+
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+
+	err = cmd.Start()
+	if err != nil {
+		return err
+	}
+
+	defer cmd.Wait()
+
+	dec := NewDecoder(stdout)
+
+	header, err := dec.Header()
+	if err != nil {
+		return err
+	}
+
+	if header.ClickEvents {
+		// Click events are also sent as an infinite array.
+		_, err = io.WriteString(stdin, "[\n")
+		if err != nil {
+			return err
+		}
+
+		m.clicksMu.Lock()
+		m.clicks = stdin
+		m.clickEvents = true
+		m.clicksMu.Unlock()
+	}
+
+	for {
+		blocks, err := dec.Next()
+		if err != nil {
+			return err
+		}
+
+		barbara.RunOnMainThread(func() {
+			if ctx.Err() != nil {
+				// The module has been destroyed.
+				return
+			}
+
+			m.update(blocks)
+		})
+	}
+}
+
+// update shows the given blocks, creating or destroying labels so that there's one per block. It
+// must be called on the main thread.
+func (m *Module) update(blocks []Block) {
+	for len(m.items) > len(blocks) {
+		last := len(m.items) - 1
+
+		m.items[last].destroy()
+		m.items = m.items[:last]
+	}
+
+	for len(m.items) < len(blocks) {
+		m.items = append(m.items, m.createItem(len(m.items)))
+	}
+
+	for i, block := range blocks {
+		m.items[i].update(block, i == len(blocks)-1)
+	}
+}
+
+// showError replaces the blocks with a single block that's styled as an error, with the given
+// error in it's tooltip. The status command isn't running any more, so the blocks it output are
+// out of date. It must be called on the main thread.
+func (m *Module) showError(err error) {
+	m.update([]Block{{FullText: "!"}})
+
+	label := m.items[0].label
+	label.SetToolTip(fmt.Sprintf("%s: %v", m.config.Command, err))
+
+	barbara.SetClass(label, barbara.ClassError)
+}
+
+// createItem creates the widgets for the block at the given index, adding them to the layout.
+func (m *Module) createItem(index int) *blockItem {
+	item := &blockItem{
+		label:     widgets.NewQLabel(nil, core.Qt__Widget),
+		separator: widgets.NewQFrame(nil, core.Qt__Widget),
+	}
+
+	item.label.ConnectMousePressEvent(m.onMousePress(item))
+	item.label.ConnectWheelEvent(m.onWheel(item))
+
+	item.separator.SetFrameShadow(widgets.QFrame__Plain)
+
+	m.layout.AddWidget(item.label, 0, core.Qt__AlignJustify)
+	m.layout.AddWidget(item.separator, 0, core.Qt__AlignJustify)
+
+	return item
+}
+
+// onMousePress returns a mouse press handler for the given block, used to send click events.
+func (m *Module) onMousePress(item *blockItem) func(*gui.QMouseEvent) {
+	return func(event *gui.QMouseEvent) {
+		var button int
+		switch event.Button() {
+		case core.Qt__LeftButton:
+			button = 1
+		case core.Qt__MiddleButton:
+			button = 2
+		case core.Qt__RightButton:
+			button = 3
+		default:
+			return
+		}
+
+		m.sendClick(item, button, event.GlobalX(), event.GlobalY(), event.X(), event.Y())
+	}
+}
+
+// onWheel returns a mouse wheel handler for the given block, used to send scrolling as click
+// events, like i3bar does.
+func (m *Module) onWheel(item *blockItem) func(*gui.QWheelEvent) {
+	return func(event *gui.QWheelEvent) {
+		button := 5
+		if event.AngleDelta().Y() > 0 {
+			button = 4
+		}
+
+		m.sendClick(item, button, event.GlobalX(), event.GlobalY(), event.X(), event.Y())
+	}
+}
+
+// sendClick sends a click event for the given block to the status command, if it asked for them.
+func (m *Module) sendClick(item *blockItem, button, x, y, relativeX, relativeY int) {
+	m.clicksMu.Lock()
+	defer m.clicksMu.Unlock()
+
+	if !m.clickEvents {
+		return
+	}
+
+	bs, err := json.Marshal(ClickEvent{
+		Name:      item.block.Name,
+		Instance:  item.block.Instance,
+		Button:    button,
+		X:         x,
+		Y:         y,
+		RelativeX: relativeX,
+		RelativeY: relativeY,
+		Width:     item.label.Width(),
+		Height:    item.label.Height(),
+	})
+
+	if err != nil {
+		log.Println(err)
+		return
+	}
+
+	_, err = fmt.Fprintf(m.clicks, "%s,\n", bs)
+	if err != nil {
+		log.Println(err)
+	}
+}
+
+// update shows the given block. The separator after the last block is hidden.
+func (i *blockItem) update(block Block, last bool) {
+	i.block = block
+
+	i.label.SetText(block.FullText)
+	i.label.SetToolTip(block.ShortText)
+
+	if block.Markup == "pango" {
+		// Pango markup is close enough to Qt's rich text for the simple markup status commands use.
+		i.label.SetTextFormat(core.Qt__RichText)
+	} else {
+		i.label.SetTextFormat(core.Qt__PlainText)
+	}
+
+	switch block.Align {
+	case "center":
+		i.label.SetAlignment(core.Qt__AlignCenter)
+	case "right":
+		i.label.SetAlignment(core.Qt__AlignRight | core.Qt__AlignVCenter)
+	default:
+		i.label.SetAlignment(core.Qt__AlignLeft | core.Qt__AlignVCenter)
+	}
+
+	minWidth := block.MinWidth.Pixels
+	if block.MinWidth.Text != "" {
+		minWidth = i.label.FontMetrics().Width(block.MinWidth.Text, -1)
+	}
+
+	i.label.SetMinimumWidth(minWidth)
+	i.label.SetStyleSheet(blockStyleSheet(block))
+
+	if block.Urgent {
+		barbara.SetClass(i.label, barbara.ClassUrgent)
+	} else {
+		barbara.SetClass(i.label)
+	}
+
+	i.separator.SetVisible(!last)
+	i.separator.SetFixedWidth(block.GapWidth())
+
+	if block.HasSeparator() {
+		i.separator.SetFrameShape(widgets.QFrame__VLine)
+	} else {
+		i.separator.SetFrameShape(widgets.QFrame__NoFrame)
+	}
+}
+
+// destroy frees up the resources used by this blockItem.
+func (i *blockItem) destroy() {
+	i.label.Destroy(true, true)
+	i.separator.Destroy(true, true)
+}
+
+// blockStyleSheet returns a stylesheet that applies the given block's colors. Urgent blocks don't
+// use the block's text color, so that the urgent style can be seen.
+func blockStyleSheet(block Block) string {
+	var rules []string
+	if block.Color != "" && !block.Urgent {
+		rules = append(rules, fmt.Sprintf("color: %s;", block.Color))
+	}
+
+	if block.Background != "" {
+		rules = append(rules, fmt.Sprintf("background-color: %s;", block.Background))
+	}
+
+	if block.Border != "" {
+		rules = append(rules, fmt.Sprintf("border: 1px solid %s;", block.Border))
+	}
+
+	return strings.Join(rules, " ")
+}
@@ -0,0 +1,144 @@
+package i3bar
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// defaultSeparatorBlockWidth is the gap left after a block, if the block doesn't specify one.
+const defaultSeparatorBlockWidth = 9
+
+// Header is the first message sent by a status command using the i3bar protocol.
+type Header struct {
+	Version     int  `json:"version"`
+	StopSignal  int  `json:"stop_signal,omitempty"`
+	ContSignal  int  `json:"cont_signal,omitempty"`
+	ClickEvents bool `json:"click_events,omitempty"`
+}
+
+// Block is a single block in a status line sent by a status command.
+type Block struct {
+	FullText            string   `json:"full_text"`
+	ShortText           string   `json:"short_text,omitempty"`
+	Color               string   `json:"color,omitempty"`
+	Background          string   `json:"background,omitempty"`
+	Border              string   `json:"border,omitempty"`
+	MinWidth            MinWidth `json:"min_width,omitempty"`
+	Align               string   `json:"align,omitempty"`
+	Name                string   `json:"name,omitempty"`
+	Instance            string   `json:"instance,omitempty"`
+	Urgent              bool     `json:"urgent,omitempty"`
+	Separator           *bool    `json:"separator,omitempty"`
+	SeparatorBlockWidth *int     `json:"separator_block_width,omitempty"`
+	Markup              string   `json:"markup,omitempty"`
+}
+
+// HasSeparator returns true if a separator line should be drawn after this block.
+func (b Block) HasSeparator() bool {
+	return b.Separator == nil || *b.Separator
+}
+
+// GapWidth returns the width of the gap that should be left after this block.
+func (b Block) GapWidth() int {
+	if b.SeparatorBlockWidth == nil {
+		return defaultSeparatorBlockWidth
+	}
+
+	return *b.SeparatorBlockWidth
+}
+
+// MinWidth is the minimum width of a block. It's either a number of pixels, or a string, in which
+// case the minimum width is the width of the string.
+type MinWidth struct {
+	Pixels int
+	Text   string
+}
+
+// UnmarshalJSON allows a JSON number or string to be unmarshalled into a MinWidth.
+func (w *MinWidth) UnmarshalJSON(raw []byte) error {
+	if err := json.Unmarshal(raw, &w.Pixels); err == nil {
+		return nil
+	}
+
+	err := json.Unmarshal(raw, &w.Text)
+	if err != nil {
+		return fmt.Errorf("invalid min_width %s", raw)
+	}
+
+	return nil
+}
+
+// ClickEvent is sent to the status command when a block is clicked, if it asked for click events.
+type ClickEvent struct {
+	Name      string `json:"name,omitempty"`
+	Instance  string `json:"instance,omitempty"`
+	Button    int    `json:"button"`
+	X         int    `json:"x"`
+	Y         int    `json:"y"`
+	RelativeX int    `json:"relative_x"`
+	RelativeY int    `json:"relative_y"`
+	Width     int    `json:"width"`
+	Height    int    `json:"height"`
+}
+
+// Decoder reads status lines sent by a status command using the i3bar protocol.
+type Decoder struct {
+	dec    *json.Decoder
+	header *Header
+}
+
+// NewDecoder returns a new Decoder instance, reading from the given reader.
+func NewDecoder(r io.Reader) *Decoder {
+	return &Decoder{
+		dec: json.NewDecoder(r),
+	}
+}
+
+// Header reads the protocol header, and the start of the infinite array of status lines. It must
+// be called before Next.
+func (d *Decoder) Header() (Header, error) {
+	var header Header
+
+	err := d.dec.Decode(&header)
+	if err != nil {
+		return header, fmt.Errorf("i3bar: failed to read header: %v", err)
+	}
+
+	if header.Version != 1 {
+		return header, fmt.Errorf("i3bar: unsupported protocol version %d", header.Version)
+	}
+
+	token, err := d.dec.Token()
+	if err != nil {
+		return header, fmt.Errorf("i3bar: failed to read start of status lines: %v", err)
+	}
+
+	if delim, ok := token.(json.Delim); !ok || delim != '[' {
+		return header, fmt.Errorf("i3bar: expected start of status lines, got %v", token)
+	}
+
+	d.header = &header
+
+	return header, nil
+}
+
+// Next reads the next status line.
+func (d *Decoder) Next() ([]Block, error) {
+	if d.header == nil {
+		return nil, fmt.Errorf("i3bar: header must be read before status lines")
+	}
+
+	if !d.dec.More() {
+		return nil, fmt.Errorf("i3bar: end of status lines")
+	}
+
+	var blocks []Block
+
+	err := d.dec.Decode(&blocks)
+	if err != nil {
+		return nil, fmt.Errorf("i3bar: failed to read status line: %v", err)
+	}
+
+	return blocks, nil
+}
@@ -0,0 +1,187 @@
+package i3bar
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestDecoder_Header(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected Header
+		valid    bool
+	}{
+		{
+			name:     "minimal",
+			input:    `{"version":1} [`,
+			expected: Header{Version: 1},
+			valid:    true,
+		},
+		{
+			name:     "full",
+			input:    `{"version":1,"stop_signal":10,"cont_signal":12,"click_events":true}` + "\n[\n",
+			expected: Header{Version: 1, StopSignal: 10, ContSignal: 12, ClickEvents: true},
+			valid:    true,
+		},
+		{
+			name:  "unsupported version",
+			input: `{"version":2} [`,
+		},
+		{
+			name:  "not json",
+			input: `hello`,
+		},
+		{
+			name:  "missing status lines",
+			input: `{"version":1} {"full_text":"hello"}`,
+		},
+		{
+			name:  "truncated",
+			input: `{"version":1`,
+		},
+		{
+			name:  "empty",
+			input: ``,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			header, err := NewDecoder(strings.NewReader(test.input)).Header()
+			if !test.valid {
+				if err == nil {
+					t.Error("expected an error")
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if header != test.expected {
+				t.Errorf("expected %+v, got %+v", test.expected, header)
+			}
+		})
+	}
+}
+
+func TestDecoder_Next(t *testing.T) {
+	input := strings.Join([]string{
+		`{"version":1}`,
+		`[`,
+		`[{"full_text":"first","min_width":100}]`,
+		`,[{"full_text":"second","min_width":"00:00:00","separator":false,"separator_block_width":0}],`,
+		`[]`,
+		`,[{"full_text":"fourth","name":"clock","instance":"utc","urgent":true}]`,
+	}, "\n")
+
+	separator := false
+	separatorBlockWidth := 0
+
+	expected := [][]Block{
+		{{FullText: "first", MinWidth: MinWidth{Pixels: 100}}},
+		{{FullText: "second", MinWidth: MinWidth{Text: "00:00:00"}, Separator: &separator, SeparatorBlockWidth: &separatorBlockWidth}},
+		{},
+		{{FullText: "fourth", Name: "clock", Instance: "utc", Urgent: true}},
+	}
+
+	dec := NewDecoder(strings.NewReader(input))
+
+	_, err := dec.Header()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i, blocks := range expected {
+		actual, err := dec.Next()
+		if err != nil {
+			t.Fatalf("status line %d: %v", i, err)
+		}
+
+		if !reflect.DeepEqual(actual, blocks) {
+			t.Errorf("status line %d: expected %+v, got %+v", i, blocks, actual)
+		}
+	}
+
+	// The stream ends once the status command exits, without closing the infinite array.
+	_, err = dec.Next()
+	if err == nil {
+		t.Error("expected an error at the end of the stream")
+	}
+}
+
+func TestDecoder_Next_Errors(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+	}{
+		{"truncated status line", `{"version":1} [ [{"full_text":"hel`},
+		{"truncated between status lines", `{"version":1} [ [{"full_text":"hello"}],`},
+		{"not a status line", `{"version":1} [ {"full_text":"hello"}`},
+		{"invalid min_width", `{"version":1} [ [{"full_text":"hello","min_width":true}]`},
+		{"end of status lines", `{"version":1} [ ]`},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			dec := NewDecoder(strings.NewReader(test.input))
+
+			_, err := dec.Header()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// A truncated stream may still have complete status lines before the truncated one.
+			for i := 0; i < 2; i++ {
+				if _, err = dec.Next(); err != nil {
+					break
+				}
+			}
+
+			if err == nil {
+				t.Error("expected an error")
+			}
+		})
+	}
+}
+
+func TestDecoder_Next_BeforeHeader(t *testing.T) {
+	_, err := NewDecoder(strings.NewReader(`[[]]`)).Next()
+	if err == nil {
+		t.Error("expected an error")
+	}
+}
+
+func TestBlock_Separator(t *testing.T) {
+	yes, no := true, false
+	zero, wide := 0, 20
+
+	tests := []struct {
+		name      string
+		block     Block
+		separator bool
+		gapWidth  int
+	}{
+		{"defaults", Block{}, true, defaultSeparatorBlockWidth},
+		{"separator", Block{Separator: &yes}, true, defaultSeparatorBlockWidth},
+		{"no separator", Block{Separator: &no}, false, defaultSeparatorBlockWidth},
+		{"no gap", Block{SeparatorBlockWidth: &zero}, true, 0},
+		{"wide gap", Block{Separator: &no, SeparatorBlockWidth: &wide}, false, 20},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if separator := test.block.HasSeparator(); separator != test.separator {
+				t.Errorf("expected separator %v, got %v", test.separator, separator)
+			}
+
+			if gapWidth := test.block.GapWidth(); gapWidth != test.gapWidth {
+				t.Errorf("expected gap width %d, got %d", test.gapWidth, gapWidth)
+			}
+		})
+	}
+}
@@ -0,0 +1,70 @@
+package i3blocks
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// Config holds all i3blocks module configuration. The options match those of a block in an
+// i3blocks configuration file, so that existing blocks can be moved over as they are.
+type Config struct {
+	// Command is the command to run. It is run using the shell, like in i3blocks.
+	Command string `json:"command"`
+	// Interval specifies when the command is run. See Interval for more information.
+	Interval Interval `json:"interval"`
+	// Signal is the number of the real-time signal (SIGRTMIN+Signal) that causes the block to be
+	// refreshed, e.g. using `pkill -RTMIN+10 barbara`. Zero disables signal-triggered refreshes.
+	Signal int `json:"signal"`
+	// Name is passed to the command as BLOCK_NAME.
+	Name string `json:"name"`
+	// Instance is passed to the command as BLOCK_INSTANCE.
+	Instance string `json:"instance"`
+	// Label is text shown before the command's output.
+	Label string `json:"label"`
+	// Env is additional environment variables that are set when running the command.
+	Env map[string]string `json:"env"`
+}
+
+const (
+	// IntervalOnce runs the command once at startup, and then only when clicked or signalled.
+	IntervalOnce Interval = -1
+	// IntervalRepeat runs the command again as soon as it exits.
+	IntervalRepeat Interval = -2
+	// IntervalPersist runs the command once, as a long-running process. Each line it outputs is
+	// shown as the block's text, and clicks are written to it's stdin.
+	IntervalPersist Interval = -3
+)
+
+// Interval specifies when a block's command is run. It's either a positive number of seconds, or
+// one of "once", "repeat", or "persist". A zero Interval behaves like IntervalOnce.
+type Interval time.Duration
+
+// UnmarshalJSON allows a JSON number of seconds, or string to be unmarshalled into an Interval.
+func (i *Interval) UnmarshalJSON(raw []byte) error {
+	var seconds float64
+	if err := json.Unmarshal(raw, &seconds); err == nil {
+		*i = Interval(seconds * float64(time.Second))
+		return nil
+	}
+
+	var str string
+
+	err := json.Unmarshal(raw, &str)
+	if err != nil {
+		return err
+	}
+
+	switch str {
+	case "once":
+		*i = IntervalOnce
+	case "repeat":
+		*i = IntervalRepeat
+	case "persist":
+		*i = IntervalPersist
+	default:
+		return fmt.Errorf("invalid interval %q", str)
+	}
+
+	return nil
+}
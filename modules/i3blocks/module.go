@@ -0,0 +1,426 @@
+package i3blocks
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/exec"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/seeruk/barbara/barbara"
+	"github.com/therecipe/qt/core"
+	"github.com/therecipe/qt/gui"
+	"github.com/therecipe/qt/widgets"
+)
+
+const (
+	// sigRTMin is the first real-time signal available to applications on Linux, as glibc defines
+	// it. The kernel's SIGRTMIN is 32, but glibc reserves the first two for itself, so this is what
+	// scripts (e.g. "pkill -RTMIN+1") see on glibc systems. SIGRTMIN is decided by the C library at
+	// runtime, so it can't be asked for from Go; on musl systems, it's 35 instead.
+	sigRTMin = 34
+	// repeatMinInterval is the shortest time between runs of a repeating command, so a command that
+	// exits straight away isn't run in a busy loop.
+	repeatMinInterval = time.Second
+	// exitUrgent is the exit code a command uses to mark the block as urgent.
+	exitUrgent = 33
+)
+
+// Mouse button numbers, as passed to commands in BLOCK_BUTTON.
+const (
+	buttonLeft       = 1
+	buttonMiddle     = 2
+	buttonRight      = 3
+	buttonScrollUp   = 4
+	buttonScrollDown = 5
+)
+
+// click represents a click on a block.
+type click struct {
+	button int
+	x      int
+	y      int
+}
+
+// Module is a Barbara Module that runs an i3blocks block. The block's command is run using the same
+// protocol as i3blocks, so existing scripts can be used unmodified.
+type Module struct {
+	ctx context.Context
+	cfn context.CancelFunc
+
+	config  Config
+	clickCh chan click
+	layout  *widgets.QHBoxLayout
+	label   *widgets.QLabel
+}
+
+// NewModule returns a new i3blocks Module instance.
+func NewModule(mctx barbara.ModuleContext) (barbara.Module, error) {
+	var config Config
+
+	err := json.Unmarshal(mctx.Config, &config)
+	if err != nil {
+		// TODO(elliot): More context.
+		return nil, err
+	}
+
+	if config.Command == "" {
+		return nil, fmt.Errorf("i3blocks: a command must be configured")
+	}
+
+	return &Module{
+		config:  config,
+		clickCh: make(chan click, 8),
+	}, nil
+}
+
+// Render starts the block's command, and returns a label that will show the block's output, ready
+// to be placed on a bar.
+func (m *Module) Render() (widgets.QLayout_ITF, error) {
+	m.layout = widgets.NewQHBoxLayout()
+
+	m.label = widgets.NewQLabel(nil, core.Qt__Widget)
+	m.label.SetAlignment(core.Qt__AlignCenter)
+	m.label.ConnectMousePressEvent(m.onMousePress)
+	m.label.ConnectWheelEvent(m.onWheel)
+
+	m.ctx, m.cfn = context.WithCancel(context.Background())
+
+	if m.config.Interval == IntervalPersist {
+		go m.runPersistent(m.ctx)
+	} else {
+		go m.run(m.ctx)
+	}
+
+	m.layout.AddWidget(m.label, 0, core.Qt__AlignJustify)
+
+	return m.layout, nil
+}
+
+// Destroy stops background processes, killing the command if it's running, and frees up resources.
+func (m *Module) Destroy() error {
+	if m.cfn != nil {
+		m.cfn()
+	}
+
+	if m.layout != nil {
+		m.layout.DestroyQHBoxLayout()
+	}
+
+	if m.label != nil {
+		m.label.Destroy(true, true)
+	}
+
+	m.ctx = nil
+	m.cfn = nil
+	m.layout = nil
+	m.label = nil
+
+	return nil
+}
+
+// onMousePress is the mouse press handler, used to pass clicks on to the command.
+func (m *Module) onMousePress(event *gui.QMouseEvent) {
+	var button int
+	switch event.Button() {
+	case core.Qt__LeftButton:
+		button = buttonLeft
+	case core.Qt__MiddleButton:
+		button = buttonMiddle
+	case core.Qt__RightButton:
+		button = buttonRight
+	default:
+		return
+	}
+
+	m.sendClick(click{button: button, x: event.GlobalX(), y: event.GlobalY()})
+}
+
+// onWheel is the mouse wheel handler, used to pass scrolling on to the command as clicks.
+func (m *Module) onWheel(event *gui.QWheelEvent) {
+	button := buttonScrollDown
+	if event.AngleDelta().Y() > 0 {
+		button = buttonScrollUp
+	}
+
+	m.sendClick(click{button: button, x: event.GlobalX(), y: event.GlobalY()})
+}
+
+// sendClick queues a click to be handled in the background. If too many clicks are queued, the
+// click is dropped rather than blocking the UI.
+func (m *Module) sendClick(c click) {
+	select {
+	case m.clickCh <- c:
+	default:
+	}
+}
+
+// run runs the command based on the configured interval, and whenever the block is clicked or
+// signalled, until the given context is done.
+func (m *Module) run(ctx context.Context) {
+	var tickCh <-chan time.Time
+	if m.config.Interval > 0 {
+		ticker := time.NewTicker(time.Duration(m.config.Interval))
+		defer ticker.Stop()
+
+		tickCh = ticker.C
+	}
+
+	signalCh := m.notifySignal()
+	defer signal.Stop(signalCh)
+
+	lastRun := time.Now()
+	m.runOnce(ctx, click{})
+
+	for {
+		if m.config.Interval == IntervalRepeat {
+			// Repeating commands are expected to block until they have something new to show, so
+			// we don't wait for anything before running them again, unless they exit too quickly.
+			select {
+			case <-ctx.Done():
+				return
+			case c := <-m.clickCh:
+				lastRun = time.Now()
+				m.runOnce(ctx, c)
+			case <-time.After(time.Until(lastRun.Add(repeatMinInterval))):
+				lastRun = time.Now()
+				m.runOnce(ctx, click{})
+			}
+
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-tickCh:
+			m.runOnce(ctx, click{})
+		case <-signalCh:
+			m.runOnce(ctx, click{})
+		case c := <-m.clickCh:
+			m.runOnce(ctx, c)
+		}
+	}
+}
+
+// runOnce runs the command, passing the given click (if any) in the environment, and then shows the
+// block it outputs.
+func (m *Module) runOnce(ctx context.Context, c click) {
+	var stdout bytes.Buffer
+
+	cmd := m.command(ctx, c)
+	cmd.Stdout = &stdout
+
+	err := cmd.Run()
+	if ctx.Err() != nil {
+		// The module is being destroyed, there's nothing to show the block on.
+		return
+	}
+
+	var urgent bool
+	if exitErr, ok := err.(*exec.ExitError); ok {
+		if status, ok := exitErr.Sys().(syscall.WaitStatus); ok && status.ExitStatus() == exitUrgent {
+			urgent = true
+			err = nil
+		}
+	}
+
+	if err != nil {
+		text := m.config.Label + strings.TrimSpace(stdout.String())
+
+		barbara.RunOnMainThread(func() {
+			if ctx.Err() == nil {
+				m.label.SetText(text)
+				m.label.SetStyleSheet("")
+				m.showError(err)
+			}
+		})
+
+		return
+	}
+
+	m.update(ctx, parseBlock(stdout.String()), urgent)
+}
+
+// runPersistent runs the command as a long-running process. Each line it outputs is shown as the
+// block's text, and clicks are written to it's stdin.
+func (m *Module) runPersistent(ctx context.Context) {
+	cmd := m.command(ctx, click{})
+
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		log.Println(err)
+		return
+	}
+
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		log.Println(err)
+		return
+	}
+
+	err = cmd.Start()
+	if err != nil {
+		log.Println(err)
+		return
+	}
+
+	go m.writeClicks(ctx, stdin)
+
+	scanner := bufio.NewScanner(stdout)
+	for scanner.Scan() {
+		// Carry on reading until the command has been killed, update ignores lines once the
+		// context is done.
+		m.update(ctx, block{fullText: scanner.Text()}, false)
+	}
+
+	err = cmd.Wait()
+	if ctx.Err() != nil {
+		return
+	}
+
+	if err == nil {
+		err = fmt.Errorf("exited")
+	}
+
+	// Keep showing the last thing the command output, so it's clear what it was doing.
+	barbara.RunOnMainThread(func() {
+		if ctx.Err() == nil {
+			m.showError(err)
+		}
+	})
+}
+
+// writeClicks writes the button number of each click to the given writer, one per line, until the
+// given context is done.
+func (m *Module) writeClicks(ctx context.Context, w io.WriteCloser) {
+	defer w.Close()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case c := <-m.clickCh:
+			_, err := fmt.Fprintln(w, c.button)
+			if err != nil {
+				return
+			}
+		}
+	}
+}
+
+// command returns a new command that will run the configured command using the shell, with the
+// block's environment, killing it once the given context is done.
+func (m *Module) command(ctx context.Context, c click) *exec.Cmd {
+	cmd := exec.CommandContext(ctx, "sh", "-c", m.config.Command)
+	cmd.Env = append(os.Environ(),
+		"BLOCK_NAME="+m.config.Name,
+		"BLOCK_INSTANCE="+m.config.Instance,
+		"BLOCK_INTERVAL="+m.intervalString(),
+	)
+
+	if c.button != 0 {
+		cmd.Env = append(cmd.Env,
+			"BLOCK_BUTTON="+strconv.Itoa(c.button),
+			"BLOCK_X="+strconv.Itoa(c.x),
+			"BLOCK_Y="+strconv.Itoa(c.y),
+		)
+	}
+
+	for name, value := range m.config.Env {
+		cmd.Env = append(cmd.Env, fmt.Sprintf("%s=%s", name, value))
+	}
+
+	return cmd
+}
+
+// intervalString returns the configured interval as it would be written in an i3blocks
+// configuration file.
+func (m *Module) intervalString() string {
+	switch m.config.Interval {
+	case IntervalOnce:
+		return "once"
+	case IntervalRepeat:
+		return "repeat"
+	case IntervalPersist:
+		return "persist"
+	}
+
+	return strconv.Itoa(int(time.Duration(m.config.Interval) / time.Second))
+}
+
+// notifySignal returns a channel that receives the configured real-time signal. If no signal is
+// configured, the returned channel never receives anything.
+func (m *Module) notifySignal() chan os.Signal {
+	signalCh := make(chan os.Signal, 1)
+	if m.config.Signal > 0 {
+		signal.Notify(signalCh, syscall.Signal(sigRTMin+m.config.Signal))
+	}
+
+	return signalCh
+}
+
+// update shows the given block on the label, on the main thread, unless the given context is done
+// by then. Barbara doesn't shorten blocks when space is tight, like i3bar does, so the short text
+// is shown in the tooltip instead.
+func (m *Module) update(ctx context.Context, b block, urgent bool) {
+	var styleSheet string
+	if b.color != "" {
+		styleSheet = fmt.Sprintf("color: %s;", b.color)
+	}
+
+	barbara.RunOnMainThread(func() {
+		// The module may have been destroyed since the block was read.
+		if ctx.Err() != nil {
+			return
+		}
+
+		m.label.SetText(m.config.Label + b.fullText)
+		m.label.SetToolTip(b.shortText)
+		m.label.SetStyleSheet(styleSheet)
+
+		if urgent {
+			barbara.SetClass(m.label, barbara.ClassUrgent)
+		} else {
+			barbara.SetClass(m.label)
+		}
+	})
+}
+
+// showError styles the label as an error, with the given error in it's tooltip. It must be called
+// on the main thread.
+func (m *Module) showError(err error) {
+	m.label.SetToolTip(fmt.Sprintf("%s: %v", m.config.Command, err))
+	barbara.SetClass(m.label, barbara.ClassError)
+}
+
+// block is the output of a block's command.
+type block struct {
+	fullText  string
+	shortText string
+	color     string
+}
+
+// parseBlock parses the output of a block's command. The first line is the full text, the second
+// line is the short text, and the third line is the color, each of which is optional.
+func parseBlock(output string) block {
+	lines := strings.Split(strings.TrimRight(output, "\n"), "\n")
+	for len(lines) < 3 {
+		lines = append(lines, "")
+	}
+
+	return block{
+		fullText:  lines[0],
+		shortText: lines[1],
+		color:     lines[2],
+	}
+}
@@ -7,25 +7,37 @@ import (
 	"strings"
 
 	"github.com/seeruk/barbara/barbara"
+	"github.com/seeruk/barbara/icon"
 	"github.com/therecipe/qt/core"
-	"github.com/therecipe/qt/gui"
 	"github.com/therecipe/qt/widgets"
 )
 
+// iconSize is the size of the icons shown next to menu items.
+const iconSize = 16
+
 // Module is a Barbara Module that presents a menu. Menus contain menu items that are able to be
 // clicked. You can also include separators.
 type Module struct {
 	config    Config
 	alignment barbara.ModuleAlignment
 	position  barbara.WindowPosition
+	icons     *icon.Loader
 
 	layout *widgets.QHBoxLayout
 	button *widgets.QPushButton
 	menu   *widgets.QMenu
 }
 
+// NewModuleConstructor returns a barbara.ModuleConstructorFunc that creates menu modules that find
+// their icons using the given icon.Loader.
+func NewModuleConstructor(icons *icon.Loader) barbara.ModuleConstructorFunc {
+	return func(mctx barbara.ModuleContext) (barbara.Module, error) {
+		return NewModule(mctx, icons)
+	}
+}
+
 // NewModule returns a new Module instance.
-func NewModule(mctx barbara.ModuleContext) (barbara.Module, error) {
+func NewModule(mctx barbara.ModuleContext, icons *icon.Loader) (barbara.Module, error) {
 	var config Config
 
 	err := json.Unmarshal(mctx.Config, &config)
@@ -38,6 +50,7 @@ func NewModule(mctx barbara.ModuleContext) (barbara.Module, error) {
 		config:    config,
 		alignment: mctx.Alignment,
 		position:  mctx.Window.Position(),
+		icons:     icons,
 	}, nil
 }
 
@@ -97,12 +110,7 @@ func (m *Module) createMenuItem(config ItemConfig, parent widgets.QWidget_ITF) *
 	// widgets, only to override it with a new one.
 	var item *widgets.QAction
 	if config.Icon != "" {
-		// TODO(elliot): Need some kind of generic icon-getting function, so I can get icons by
-		// name, using the user's theme. Will need for tray anyway.
-		icon := gui.NewQIcon()
-		icon.SetThemeName("Paper")
-
-		item = widgets.NewQAction3(icon.FromTheme(config.Icon), config.Label, parent)
+		item = widgets.NewQAction3(m.icons.Icon(iconSize, config.Icon), config.Label, parent)
 	} else {
 		item = widgets.NewQAction2(config.Label, parent)
 	}
@@ -115,32 +123,38 @@ func (m *Module) createMenuItem(config ItemConfig, parent widgets.QWidget_ITF) *
 
 // onButtonClicked is the button click handler, used to show the menu.
 func (m *Module) onButtonClicked() func(bool) {
-	// Everything here needs to be handled dynamically, because the bar could move after being
-	// rendered - so we recalculate menu position every click.
 	return func(_ bool) {
-		bsh := m.button.SizeHint()
-		msh := m.menu.SizeHint()
-
-		var x int
-		if m.alignment == barbara.ModuleAlignmentRight {
-			// Place on the right of the button by moving the menu right the whole width of the
-			// button, minus the menu's width, lining up the right edge of the menu with the right
-			// edge of the button.
-			x = bsh.Width() - msh.Width()
-		}
+		m.Popup()
+	}
+}
 
-		var y int
-		if m.position == barbara.WindowPositionBottom {
-			// Place above button, by moving the menu up the menu's height over the button.
-			y = -msh.Height()
-		} else {
-			// Place under button, by moving the menu down the button's height.
-			y = bsh.Height()
-		}
+// Popup shows the menu, positioned next to the button, on the side of the bar that's furthest from
+// the edge of the screen.
+func (m *Module) Popup() {
+	// Everything here needs to be handled dynamically, because the bar could move after being
+	// rendered - so we recalculate menu position every time.
+	bsh := m.button.SizeHint()
+	msh := m.menu.SizeHint()
+
+	var x int
+	if m.alignment == barbara.ModuleAlignmentRight {
+		// Place on the right of the button by moving the menu right the whole width of the
+		// button, minus the menu's width, lining up the right edge of the menu with the right
+		// edge of the button.
+		x = bsh.Width() - msh.Width()
+	}
 
-		// Finally, show the menu.
-		m.menu.Popup(m.button.MapToGlobal(core.NewQPoint2(x, y)), nil)
+	var y int
+	if m.position == barbara.WindowPositionBottom {
+		// Place above button, by moving the menu up the menu's height over the button.
+		y = -msh.Height()
+	} else {
+		// Place under button, by moving the menu down the button's height.
+		y = bsh.Height()
 	}
+
+	// Finally, show the menu.
+	m.menu.Popup(m.button.MapToGlobal(core.NewQPoint2(x, y)), nil)
 }
 
 // onMenuItemTriggered is the menu item activation handler, used to execute menu item commands.
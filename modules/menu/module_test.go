@@ -0,0 +1,42 @@
+package menu
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/seeruk/barbara/barbara"
+	"github.com/seeruk/barbara/barbara/barbaratest"
+	"github.com/seeruk/barbara/icon"
+)
+
+func TestMain(m *testing.M) {
+	barbaratest.Main(m)
+}
+
+func TestModule_Golden(t *testing.T) {
+	// No icon directories are searched, so the output doesn't depend on the installed icon themes.
+	icons := icon.NewLoader(icon.NewLookup(icon.FallbackTheme, []string{}), 1)
+
+	mbf := barbara.NewModuleFactory()
+	mbf.RegisterConstructor("menu", NewModuleConstructor(icons))
+
+	harness := barbaratest.NewHarness(mbf, barbara.NewServiceRegistry(), barbara.SystemClock{})
+	screen := barbara.NewVirtualScreen("test", 0, 0, 640, 480)
+
+	config := `{
+		"kind": "menu",
+		"label": "Applications",
+		"items": [
+			{"label": "Terminal", "exec": "xterm"},
+			{"separator": true},
+			{"label": "Log out", "exec": "true"}
+		]
+	}`
+
+	img, err := harness.RenderModule(json.RawMessage(config), screen)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	barbaratest.AssertGolden(t, "menu", img)
+}
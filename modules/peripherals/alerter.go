@@ -0,0 +1,189 @@
+package peripherals
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+
+	"github.com/seeruk/barbara/barbara"
+	"github.com/seeruk/barbara/modules/battery"
+	"github.com/seeruk/barbara/notify"
+)
+
+// AlerterServiceKind is the kind of the peripherals Alerter service in the service registry. There's
+// only one, named battery.PowerSupplyAuto.
+const AlerterServiceKind = "peripherals-alerter"
+
+// notificationIcon is the icon shown on peripheral battery notifications.
+const notificationIcon = "battery-caution"
+
+// alert is a peripheral becoming low, or no longer being low, that an Alerter has been asked to
+// handle.
+type alert struct {
+	info battery.Info
+	low  bool
+}
+
+// Alerter is a service that sends desktop notifications when a peripheral's battery becomes low.
+// It's shared by every peripherals module, so that notifications aren't sent once per bar. Each
+// peripheral is only alerted about once, until it's charged, or it disconnects.
+type Alerter struct {
+	sync.Mutex
+
+	notifier *notify.Notifier
+
+	ctx     context.Context
+	cfn     context.CancelFunc
+	alertCh chan alert
+
+	threshold  float64
+	configured bool
+	low        map[string]battery.Info
+}
+
+// NewAlerter returns a new Alerter instance. If notifier is nil, alerts are only logged.
+func NewAlerter(notifier *notify.Notifier) *Alerter {
+	return &Alerter{
+		notifier: notifier,
+		alertCh:  make(chan alert, 16),
+		low:      make(map[string]battery.Info),
+	}
+}
+
+// Start begins handling alerts in the background.
+func (a *Alerter) Start() error {
+	a.ctx, a.cfn = context.WithCancel(context.Background())
+
+	go a.handleAlerts(a.ctx)
+
+	return nil
+}
+
+// Stop stops handling alerts.
+func (a *Alerter) Stop() error {
+	if a.cfn != nil {
+		a.cfn()
+	}
+
+	return nil
+}
+
+// Configure sets the threshold at or below which peripherals are low. The Alerter is shared, so
+// only the first module's threshold is used; otherwise peripherals between two thresholds would be
+// low, then not low, every time they're checked. Modules with a different threshold are logged.
+func (a *Alerter) Configure(threshold float64) {
+	a.Lock()
+	defer a.Unlock()
+
+	if !a.configured {
+		a.threshold = threshold
+		a.configured = true
+		return
+	}
+
+	if threshold != a.threshold {
+		log.Println("peripherals: modules have different thresholds, using the first module's " +
+			"for notifications")
+	}
+}
+
+// Check compares the given peripherals with the peripherals that were low when last checked,
+// sending notifications for peripherals that have become low, and closing notifications for
+// peripherals that have been charged, or have disconnected. Peripherals are low if they're at or
+// below the threshold given to Configure, if it hasn't been called, nothing is checked. This
+// method doesn't block, and is safe for concurrent use.
+func (a *Alerter) Check(infos []battery.Info) {
+	a.Lock()
+	defer a.Unlock()
+
+	if !a.configured {
+		return
+	}
+
+	seen := make(map[string]bool, len(infos))
+
+	for _, info := range infos {
+		seen[info.Name] = true
+
+		_, wasLow := a.low[info.Name]
+		low := isLow(info, a.threshold)
+
+		switch {
+		case low && !wasLow:
+			a.low[info.Name] = info
+			a.send(alert{info: info, low: true})
+		case !low && wasLow:
+			delete(a.low, info.Name)
+			a.send(alert{info: info, low: false})
+		}
+	}
+
+	for name, info := range a.low {
+		if !seen[name] {
+			delete(a.low, name)
+			a.send(alert{info: info, low: false})
+		}
+	}
+}
+
+// send queues the given alert to be handled, unless too many alerts are already queued.
+func (a *Alerter) send(alert alert) {
+	select {
+	case a.alertCh <- alert:
+	default:
+		log.Println("peripherals: dropped alert, too many pending alerts")
+	}
+}
+
+// handleAlerts handles alerts one at a time, until the given context is cancelled.
+func (a *Alerter) handleAlerts(ctx context.Context) {
+	ids := make(map[string]uint32)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case alert := <-a.alertCh:
+			name := getDeviceName(alert.info)
+
+			if !alert.low {
+				if id, ok := ids[alert.info.Name]; ok && a.notifier != nil {
+					if err := a.notifier.Close(id); err != nil {
+						log.Printf("peripherals: %v\n", err)
+					}
+				}
+
+				delete(ids, alert.info.Name)
+				continue
+			}
+
+			notification := notify.Notification{
+				Icon:    notificationIcon,
+				Summary: fmt.Sprintf("%s battery low", name),
+				Body:    fmt.Sprintf("%.0f%% remaining.", alert.info.Capacity),
+				Urgency: notify.UrgencyNormal,
+			}
+
+			if a.notifier == nil {
+				log.Printf("peripherals: %s: %s\n", notification.Summary, notification.Body)
+				continue
+			}
+
+			id, err := a.notifier.Notify(notification)
+			if err != nil {
+				log.Printf("peripherals: %v\n", err)
+				continue
+			}
+
+			ids[alert.info.Name] = id
+		}
+	}
+}
+
+// NewAlerterConstructor returns a barbara.ServiceConstructorFunc that creates Alerter instances.
+func NewAlerterConstructor(notifier *notify.Notifier) barbara.ServiceConstructorFunc {
+	return func(_ string) (barbara.Service, error) {
+		return NewAlerter(notifier), nil
+	}
+}
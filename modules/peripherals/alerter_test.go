@@ -0,0 +1,105 @@
+package peripherals
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/seeruk/barbara/modules/battery"
+)
+
+func TestAlerter_Check(t *testing.T) {
+	mouse := battery.Info{Name: "hidpp_battery_0", Capacity: 50, HasCapacity: true, Status: battery.StatusDischarging}
+	keyboard := battery.Info{Name: "hidpp_battery_1", Capacity: 50, HasCapacity: true, Status: battery.StatusDischarging}
+
+	withCapacity := func(info battery.Info, capacity float64) battery.Info {
+		info.Capacity = capacity
+		return info
+	}
+
+	withStatus := func(info battery.Info, status string) battery.Info {
+		info.Status = status
+		return info
+	}
+
+	type expectedAlert struct {
+		name string
+		low  bool
+	}
+
+	// Each step is checked in turn, with the same Alerter.
+	steps := []struct {
+		name     string
+		infos    []battery.Info
+		expected []expectedAlert
+	}{
+		{
+			name:  "not low",
+			infos: []battery.Info{mouse, keyboard},
+		},
+		{
+			name:     "low",
+			infos:    []battery.Info{withCapacity(mouse, 15), keyboard},
+			expected: []expectedAlert{{"hidpp_battery_0", true}},
+		},
+		{
+			// Peripherals are only alerted about once.
+			name:  "still low",
+			infos: []battery.Info{withCapacity(mouse, 10), keyboard},
+		},
+		{
+			name:     "charging",
+			infos:    []battery.Info{withStatus(withCapacity(mouse, 10), battery.StatusCharging), keyboard},
+			expected: []expectedAlert{{"hidpp_battery_0", false}},
+		},
+		{
+			name:     "low again",
+			infos:    []battery.Info{withCapacity(mouse, 10), withCapacity(keyboard, 20)},
+			expected: []expectedAlert{{"hidpp_battery_0", true}, {"hidpp_battery_1", true}},
+		},
+		{
+			name:     "disconnected",
+			infos:    []battery.Info{withCapacity(keyboard, 20)},
+			expected: []expectedAlert{{"hidpp_battery_0", false}},
+		},
+		{
+			name:     "recovered",
+			infos:    []battery.Info{withCapacity(keyboard, 21)},
+			expected: []expectedAlert{{"hidpp_battery_1", false}},
+		},
+	}
+
+	alerter := NewAlerter(nil)
+	alerter.Configure(DefaultThreshold)
+
+	// A module with a different threshold doesn't change when peripherals are low.
+	alerter.Configure(10)
+
+	for _, step := range steps {
+		alerter.Check(step.infos)
+
+		var alerts []expectedAlert
+
+	drain:
+		for {
+			select {
+			case alert := <-alerter.alertCh:
+				alerts = append(alerts, expectedAlert{alert.info.Name, alert.low})
+			default:
+				break drain
+			}
+		}
+
+		if !reflect.DeepEqual(alerts, step.expected) {
+			t.Errorf("%s: expected alerts %v, got %v", step.name, step.expected, alerts)
+		}
+	}
+}
+
+func TestAlerter_Check_Unconfigured(t *testing.T) {
+	alerter := NewAlerter(nil)
+	alerter.Check([]battery.Info{{Name: "hidpp_battery_0", Capacity: 5, HasCapacity: true}})
+
+	if len(alerter.alertCh) != 0 {
+		t.Error("expected no alerts before the Alerter is configured")
+	}
+}
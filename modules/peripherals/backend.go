@@ -0,0 +1,53 @@
+package peripherals
+
+import (
+	"log"
+
+	"github.com/seeruk/barbara/modules/battery"
+)
+
+// ServiceKind is the kind of service that the InfoNotifier watching peripheral batteries is
+// registered as. There's only one, named battery.PowerSupplyAuto.
+const ServiceKind = "peripherals"
+
+// Backend is a battery.Backend that reads the batteries of peripherals from sysfs, e.g. wireless
+// mice, keyboards, and headsets. Changes are watched in the same way as system batteries.
+type Backend struct {
+	*battery.SysfsBackend
+
+	reader *battery.InfoReader
+}
+
+// NewBackend returns a new Backend instance, that reads peripheral batteries using the given
+// battery.InfoReader, and watches for changes using the given battery.UeventListener.
+func NewBackend(reader *battery.InfoReader, listener battery.UeventListener) *Backend {
+	return &Backend{
+		SysfsBackend: battery.NewSysfsBackend(reader, listener),
+		reader:       reader,
+	}
+}
+
+// Read reads the battery information of every connected peripheral. Peripherals are discovered
+// each time, so that they're noticed as soon as they connect or disconnect. The power supply name
+// is ignored.
+func (b *Backend) Read(_ string) (battery.Update, error) {
+	var update battery.Update
+
+	names, err := b.reader.DiscoverDevices()
+	if err != nil {
+		return update, err
+	}
+
+	for _, name := range names {
+		info, err := b.reader.ReadDevice(name)
+		if err != nil {
+			// Peripherals often disconnect while being read, skip them and show the others.
+			log.Println(err)
+			continue
+		}
+
+		update.Batteries = append(update.Batteries, info)
+	}
+
+	return update, nil
+}
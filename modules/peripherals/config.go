@@ -0,0 +1,22 @@
+package peripherals
+
+const (
+	// DefaultThreshold is the default percentage at or below which a peripheral's battery is low.
+	DefaultThreshold = 20
+	// DefaultIconSize is the default size of each peripheral's icon, in pixels.
+	DefaultIconSize = 16
+)
+
+// Config holds all peripherals module configuration.
+type Config struct {
+	// Threshold is the percentage at or below which a peripheral's battery is low, sending a
+	// notification, and marking it's icon with the warning style class. Defaults to 20, negative
+	// values disable alerts. Notifications are shared by every bar, so if bars have different
+	// thresholds, the first bar's is used for notifications.
+	Threshold float64 `json:"threshold"`
+	// Size is the size of each peripheral's icon, in pixels. Defaults to 16.
+	Size int `json:"size"`
+	// Icons maps peripheral model names (e.g. "MX Master 3") to icon names, for peripherals whose
+	// kind can't be guessed from their name.
+	Icons map[string]string `json:"icons"`
+}
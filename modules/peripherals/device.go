@@ -0,0 +1,64 @@
+package peripherals
+
+import (
+	"strings"
+
+	"github.com/seeruk/barbara/modules/battery"
+)
+
+// fallbackIcon is the icon shown for peripherals of an unknown kind.
+const fallbackIcon = "battery"
+
+// deviceKinds maps words found in peripheral names to the icon shown for that kind of peripheral.
+var deviceKinds = []struct {
+	words []string
+	icon  string
+}{
+	{[]string{"mouse", "trackball", "trackpad", "mx master", "mx anywhere", "mx ergo"}, "input-mouse"},
+	{[]string{"keyboard", "keys"}, "input-keyboard"},
+	{[]string{"headset", "headphone", "buds", "earphone"}, "audio-headset"},
+	{[]string{"controller", "gamepad", "joystick"}, "input-gaming"},
+	{[]string{"stylus", "tablet"}, "input-tablet"},
+}
+
+// getDeviceName returns a name for the given peripheral that a person would recognise, which is
+// it's model name if it has one.
+func getDeviceName(info battery.Info) string {
+	if info.ModelName != "" {
+		return info.ModelName
+	}
+
+	return info.Name
+}
+
+// getDeviceIcons returns the icons to show for the given peripheral, in order of preference. The
+// configured icon for the peripheral's model is preferred, then an icon for the kind of peripheral,
+// guessed from it's name.
+func getDeviceIcons(info battery.Info, icons map[string]string) []string {
+	var names []string
+	if icon, ok := icons[info.ModelName]; ok {
+		names = append(names, icon)
+	}
+
+	name := strings.ToLower(getDeviceName(info))
+
+	for _, kind := range deviceKinds {
+		for _, word := range kind.words {
+			if strings.Contains(name, word) {
+				return append(names, kind.icon, fallbackIcon)
+			}
+		}
+	}
+
+	return append(names, fallbackIcon)
+}
+
+// isLow returns true if the given peripheral's battery is at or below the given threshold, and
+// isn't charging. If the peripheral doesn't know it's capacity, it's not low.
+func isLow(info battery.Info, threshold float64) bool {
+	if !info.HasCapacity {
+		return false
+	}
+
+	return threshold > 0 && info.Capacity <= threshold && !info.IsCharging() && !info.IsFull()
+}
@@ -0,0 +1,57 @@
+package peripherals
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/seeruk/barbara/modules/battery"
+)
+
+func TestGetDeviceIcons(t *testing.T) {
+	icons := map[string]string{"K380": "input-keyboard-bluetooth"}
+
+	tests := []struct {
+		name     string
+		info     battery.Info
+		expected []string
+	}{
+		{"model name", battery.Info{Name: "hidpp_battery_0", ModelName: "MX Master 3"}, []string{"input-mouse", "battery"}},
+		{"name", battery.Info{Name: "ps-controller-battery-00:11:22"}, []string{"input-gaming", "battery"}},
+		{"configured", battery.Info{Name: "hidpp_battery_1", ModelName: "K380"}, []string{"input-keyboard-bluetooth", "battery"}},
+		{"case", battery.Info{Name: "hid-1", ModelName: "Wireless HEADSET"}, []string{"audio-headset", "battery"}},
+		{"unknown", battery.Info{Name: "hidpp_battery_2", ModelName: "Unifying Receiver"}, []string{"battery"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			names := getDeviceIcons(test.info, icons)
+			if !reflect.DeepEqual(names, test.expected) {
+				t.Errorf("expected %v, got %v", test.expected, names)
+			}
+		})
+	}
+}
+
+func TestIsLow(t *testing.T) {
+	tests := []struct {
+		name      string
+		info      battery.Info
+		threshold float64
+		expected  bool
+	}{
+		{"above", battery.Info{Capacity: 21, HasCapacity: true, Status: battery.StatusDischarging}, 20, false},
+		{"at", battery.Info{Capacity: 20, HasCapacity: true, Status: battery.StatusDischarging}, 20, true},
+		{"below", battery.Info{Capacity: 5, HasCapacity: true, Status: battery.StatusDischarging}, 20, true},
+		{"charging", battery.Info{Capacity: 5, HasCapacity: true, Status: battery.StatusCharging}, 20, false},
+		{"unknown capacity", battery.Info{Status: battery.StatusDischarging}, 20, false},
+		{"disabled", battery.Info{Capacity: 5, HasCapacity: true, Status: battery.StatusDischarging}, -1, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if low := isLow(test.info, test.threshold); low != test.expected {
+				t.Errorf("expected %v, got %v", test.expected, low)
+			}
+		})
+	}
+}
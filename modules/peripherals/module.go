@@ -0,0 +1,201 @@
+package peripherals
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/seeruk/barbara/barbara"
+	"github.com/seeruk/barbara/icon"
+	"github.com/seeruk/barbara/modules/battery"
+	"github.com/therecipe/qt/core"
+	"github.com/therecipe/qt/widgets"
+)
+
+// Module is a Barbara Module that shows an icon for each connected peripheral that has a battery,
+// e.g. wireless mice, keyboards, and headsets. Each peripheral's battery level is shown in it's
+// icon's tooltip.
+type Module struct {
+	ctx context.Context
+	cfn context.CancelFunc
+
+	config   Config
+	services *barbara.ServiceRegistry
+	icons    *icon.Loader
+	notifier *battery.InfoNotifier
+	alerter  *Alerter
+	updateCh chan battery.Update
+	layout   *widgets.QHBoxLayout
+	labels   []*widgets.QLabel
+}
+
+// NewModuleConstructor returns a barbara.ModuleConstructorFunc that creates peripherals modules
+// that find their icons using the given icon.Loader.
+func NewModuleConstructor(icons *icon.Loader) barbara.ModuleConstructorFunc {
+	return func(mctx barbara.ModuleContext) (barbara.Module, error) {
+		return NewModule(mctx, icons)
+	}
+}
+
+// NewModule returns a new peripherals Module instance.
+func NewModule(mctx barbara.ModuleContext, icons *icon.Loader) (barbara.Module, error) {
+	var config Config
+
+	err := json.Unmarshal(mctx.Config, &config)
+	if err != nil {
+		// TODO(elliot): More context.
+		return nil, err
+	}
+
+	if config.Threshold == 0 {
+		config.Threshold = DefaultThreshold
+	}
+
+	if config.Size <= 0 {
+		config.Size = DefaultIconSize
+	}
+
+	return &Module{
+		config:   config,
+		services: mctx.Services,
+		icons:    icons,
+	}, nil
+}
+
+// Render acquires the shared peripheral InfoNotifier and Alerter, and returns a layout showing the
+// connected peripherals, ready to be placed on a bar.
+func (m *Module) Render() (widgets.QLayout_ITF, error) {
+	service, err := m.services.Acquire(AlerterServiceKind, battery.PowerSupplyAuto)
+	if err != nil {
+		return nil, err
+	}
+
+	m.alerter = service.(*Alerter)
+	m.alerter.Configure(m.config.Threshold)
+
+	service, err = m.services.Acquire(ServiceKind, battery.PowerSupplyAuto)
+	if err != nil {
+		// Don't keep the Alerter running for a module that won't be shown.
+		m.alerter = nil
+		m.services.Release(AlerterServiceKind, battery.PowerSupplyAuto)
+
+		return nil, err
+	}
+
+	m.notifier = service.(*battery.InfoNotifier)
+
+	m.layout = widgets.NewQHBoxLayout()
+
+	m.ctx, m.cfn = context.WithCancel(context.Background())
+	m.updateCh = make(chan battery.Update, 1)
+
+	go func(ctx context.Context, updateCh <-chan battery.Update) {
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case update := <-updateCh:
+				barbara.RunOnMainThread(func() {
+					if ctx.Err() == nil {
+						m.onUpdate(update)
+					}
+				})
+			}
+		}
+	}(m.ctx, m.updateCh)
+
+	m.notifier.Notify(m.updateCh)
+
+	return m.layout, nil
+}
+
+// Destroy stops background processes, releases the shared services, and frees up resources.
+func (m *Module) Destroy() error {
+	if m.cfn != nil {
+		m.cfn()
+	}
+
+	if m.notifier != nil {
+		m.notifier.Unnotify(m.updateCh)
+	}
+
+	for _, label := range m.labels {
+		label.Destroy(true, true)
+	}
+
+	if m.layout != nil {
+		m.layout.DestroyQHBoxLayout()
+	}
+
+	m.ctx = nil
+	m.cfn = nil
+	m.updateCh = nil
+	m.layout = nil
+	m.labels = nil
+
+	var err error
+
+	if m.notifier != nil {
+		m.notifier = nil
+		err = m.services.Release(ServiceKind, battery.PowerSupplyAuto)
+	}
+
+	if m.alerter != nil {
+		m.alerter = nil
+
+		alerterErr := m.services.Release(AlerterServiceKind, battery.PowerSupplyAuto)
+		if err == nil {
+			err = alerterErr
+		}
+	}
+
+	return err
+}
+
+// onUpdate updates the UI to show the given peripherals, adding or removing icons as peripherals
+// connect or disconnect. It must be called on the main thread.
+func (m *Module) onUpdate(update battery.Update) {
+	for len(m.labels) > len(update.Batteries) {
+		last := len(m.labels) - 1
+
+		m.labels[last].Destroy(true, true)
+		m.labels = m.labels[:last]
+	}
+
+	for len(m.labels) < len(update.Batteries) {
+		label := widgets.NewQLabel(nil, core.Qt__Widget)
+
+		m.layout.AddWidget(label, 0, core.Qt__AlignJustify)
+		m.labels = append(m.labels, label)
+	}
+
+	for i, info := range update.Batteries {
+		label := m.labels[i]
+		label.SetPixmap(m.icons.Pixmap(m.config.Size, getDeviceIcons(info, m.config.Icons)...))
+		label.SetToolTip(getTooltip(info))
+
+		if isLow(info, m.config.Threshold) {
+			barbara.SetClass(label, barbara.ClassWarning)
+		} else {
+			barbara.SetClass(label)
+		}
+	}
+
+	m.alerter.Check(update.Batteries)
+}
+
+// getTooltip returns the tooltip shown for the given peripheral.
+func getTooltip(info battery.Info) string {
+	capacity := "unknown"
+	if info.HasCapacity {
+		capacity = fmt.Sprintf("%.0f%%", info.Capacity)
+	}
+
+	tooltip := fmt.Sprintf("%s: %s", getDeviceName(info), capacity)
+
+	if info.IsCharging() {
+		tooltip += " (charging)"
+	}
+
+	return tooltip
+}
@@ -0,0 +1,12 @@
+package plugin
+
+// Config holds all plugin module configuration. The whole of the module's configuration is also
+// passed to the plugin, so plugins may define any other configuration they need alongside this.
+type Config struct {
+	// Path is the path to the plugin executable.
+	Path string `json:"path"`
+	// Args are arguments passed to the plugin executable.
+	Args []string `json:"args"`
+	// Env is additional environment variables that are set when running the plugin.
+	Env map[string]string `json:"env"`
+}
@@ -0,0 +1,27 @@
+// Package plugin provides a Barbara module that is implemented by an external executable, allowing
+// modules to be written in any language.
+//
+// The plugin executable is started by Barbara, and communicates with it using JSON-RPC 2.0 over
+// it's stdin and stdout, with one message per line. Anything written to stderr is logged.
+//
+// Once started, Barbara sends an "initialize" request, with the module's raw configuration:
+//
+//	{"jsonrpc":"2.0","id":1,"method":"initialize","params":{"config":{...},"alignment":"left","position":"bottom"}}
+//
+// The plugin must respond to it before sending anything else. After that, the plugin sends
+// "render" notifications whenever the module's state changes. Every field is optional, and each
+// notification replaces the whole state:
+//
+//	{"jsonrpc":"2.0","method":"render","params":{"text":"42%","icon":"audio-volume-high","tooltip":"Speakers","class":"muted","menu":[{"id":"mute","label":"Mute"},{"separator":true}]}}
+//
+// Barbara sends "input" notifications when the module is clicked or scrolled, and "menu"
+// notifications when a menu item is activated:
+//
+//	{"jsonrpc":"2.0","method":"input","params":{"type":"click","button":"left"}}
+//	{"jsonrpc":"2.0","method":"input","params":{"type":"scroll","delta":120}}
+//	{"jsonrpc":"2.0","method":"menu","params":{"id":"mute"}}
+//
+// When the module is destroyed, Barbara sends a "shutdown" notification, and closes the plugin's
+// stdin. Plugins that don't exit shortly afterwards are killed. If a plugin exits unexpectedly, or
+// breaks the protocol, the module shows an error and the plugin is restarted after a delay.
+package plugin
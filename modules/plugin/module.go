@@ -0,0 +1,430 @@
+package plugin
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/exec"
+	"time"
+
+	"github.com/seeruk/barbara/barbara"
+	"github.com/seeruk/barbara/icon"
+	"github.com/therecipe/qt/core"
+	"github.com/therecipe/qt/gui"
+	"github.com/therecipe/qt/widgets"
+)
+
+const (
+	// initializeTimeout is how long a plugin has to respond to the "initialize" request.
+	initializeTimeout = 10 * time.Second
+	// shutdownTimeout is how long a plugin has to exit after being told to shut down.
+	shutdownTimeout = 2 * time.Second
+	// minRestartDelay is how long to wait before restarting a plugin that has stopped.
+	minRestartDelay = time.Second
+	// maxRestartDelay is the longest time to wait before restarting a plugin that keeps stopping.
+	maxRestartDelay = time.Minute
+	// iconSize is the size of the icon shown next to the plugin's text, in pixels.
+	iconSize = 24
+)
+
+// Module is a Barbara Module that is implemented by an external plugin executable. The plugin is
+// supervised, so if it exits or misbehaves, it's restarted, without affecting the rest of the bar.
+type Module struct {
+	ctx context.Context
+	cfn context.CancelFunc
+
+	config    Config
+	rawConfig json.RawMessage
+	alignment barbara.ModuleAlignment
+	position  barbara.WindowPosition
+	icons     *icon.Loader
+	notifyCh  chan notification
+
+	layout    *widgets.QHBoxLayout
+	widget    *widgets.QWidget
+	iconLabel *widgets.QLabel
+	label     *widgets.QLabel
+	menu      *widgets.QMenu
+	hasMenu   bool
+}
+
+// NewModuleConstructor returns a barbara.ModuleConstructorFunc that creates plugin modules that
+// find their icons using the given icon.Loader.
+func NewModuleConstructor(icons *icon.Loader) barbara.ModuleConstructorFunc {
+	return func(mctx barbara.ModuleContext) (barbara.Module, error) {
+		return NewModule(mctx, icons)
+	}
+}
+
+// NewModule returns a new plugin Module instance.
+func NewModule(mctx barbara.ModuleContext, icons *icon.Loader) (barbara.Module, error) {
+	var config Config
+
+	err := json.Unmarshal(mctx.Config, &config)
+	if err != nil {
+		// TODO(elliot): More context.
+		return nil, err
+	}
+
+	if config.Path == "" {
+		return nil, fmt.Errorf("plugin: a path must be configured")
+	}
+
+	return &Module{
+		config:    config,
+		rawConfig: mctx.Config,
+		alignment: mctx.Alignment,
+		position:  mctx.Window.Position(),
+		icons:     icons,
+		notifyCh:  make(chan notification, 32),
+	}, nil
+}
+
+// Render starts the plugin in the background, and returns a layout containing the widgets that
+// will show the plugin's state, ready to be placed on a bar.
+func (m *Module) Render() (widgets.QLayout_ITF, error) {
+	m.widget = widgets.NewQWidget(nil, 0)
+	m.widget.ConnectMousePressEvent(m.onMousePress)
+	m.widget.ConnectWheelEvent(m.onWheel)
+
+	m.iconLabel = widgets.NewQLabel(nil, core.Qt__Widget)
+	m.iconLabel.SetVisible(false)
+
+	m.label = widgets.NewQLabel(nil, core.Qt__Widget)
+	m.label.SetAlignment(core.Qt__AlignCenter)
+
+	m.menu = widgets.NewQMenu(m.widget)
+
+	innerLayout := widgets.NewQHBoxLayout2(m.widget)
+	innerLayout.SetContentsMargins(0, 0, 0, 0)
+	innerLayout.AddWidget(m.iconLabel, 0, core.Qt__AlignJustify)
+	innerLayout.AddWidget(m.label, 0, core.Qt__AlignJustify)
+
+	m.layout = widgets.NewQHBoxLayout()
+	m.layout.AddWidget(m.widget, 0, core.Qt__AlignJustify)
+
+	m.ctx, m.cfn = context.WithCancel(context.Background())
+
+	go m.supervise(m.ctx)
+
+	return m.layout, nil
+}
+
+// Destroy stops the plugin, and frees up resources.
+func (m *Module) Destroy() error {
+	if m.cfn != nil {
+		m.cfn()
+	}
+
+	if m.layout != nil {
+		m.layout.DestroyQHBoxLayout()
+	}
+
+	if m.widget != nil {
+		// The labels and menu are children of the widget, so they're destroyed along with it.
+		m.widget.Destroy(true, true)
+	}
+
+	m.ctx = nil
+	m.cfn = nil
+	m.layout = nil
+	m.widget = nil
+	m.iconLabel = nil
+	m.label = nil
+	m.menu = nil
+
+	return nil
+}
+
+// Popup shows the plugin's menu, if it has one.
+func (m *Module) Popup() {
+	if !m.hasMenu {
+		return
+	}
+
+	wsh := m.widget.SizeHint()
+	msh := m.menu.SizeHint()
+
+	var x int
+	if m.alignment == barbara.ModuleAlignmentRight {
+		// Line up the right edge of the menu with the right edge of the module.
+		x = wsh.Width() - msh.Width()
+	}
+
+	var y int
+	if m.position == barbara.WindowPositionBottom {
+		y = -msh.Height()
+	} else {
+		y = wsh.Height()
+	}
+
+	m.menu.Popup(m.widget.MapToGlobal(core.NewQPoint2(x, y)), nil)
+}
+
+// supervise runs the plugin, restarting it if it stops, until the given context is done.
+func (m *Module) supervise(ctx context.Context) {
+	delay := minRestartDelay
+
+	for {
+		initialized, err := m.runPlugin(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+
+		if initialized {
+			// The plugin was working, so it's probably not going to fail again straight away.
+			delay = minRestartDelay
+		}
+
+		log.Printf("plugin %q stopped, restarting in %v: %v\n", m.config.Path, delay, err)
+
+		barbara.RunOnMainThread(func() {
+			if ctx.Err() == nil {
+				m.showError(err)
+			}
+		})
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(delay):
+		}
+
+		delay *= 2
+		if delay > maxRestartDelay {
+			delay = maxRestartDelay
+		}
+	}
+}
+
+// runPlugin starts the plugin, and handles communication with it until it stops, or the given
+// context is done. It returns true if the plugin was successfully initialized.
+func (m *Module) runPlugin(ctx context.Context) (bool, error) {
+	cmd := exec.Command(m.config.Path, m.config.Args...)
+	cmd.Stderr = os.Stderr
+	cmd.Env = os.Environ()
+	for name, value := range m.config.Env {
+		cmd.Env = append(cmd.Env, fmt.Sprintf("%s=%s", name, value))
+	}
+
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return false, err
+	}
+
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return false, err
+	}
+
+	err = cmd.Start()
+	if err != nil {
+		return false, err
+	}
+
+	conn := NewConn(stdout, stdin)
+
+	serveCh := make(chan error, 1)
+	go func() {
+		serveCh <- conn.Serve(m.onNotification(ctx))
+	}()
+
+	initCtx, initCfn := context.WithTimeout(ctx, initializeTimeout)
+	err = conn.Call(initCtx, methodInitialize, InitializeParams{
+		Config:    m.rawConfig,
+		Alignment: alignmentString(m.alignment),
+		Position:  positionString(m.position),
+	}, nil)
+	initCfn()
+
+	initialized := err == nil
+	if initialized {
+		err = m.forwardNotifications(ctx, conn, serveCh)
+	}
+
+	m.stopPlugin(cmd, conn, stdin, serveCh, ctx.Err() != nil)
+
+	return initialized, err
+}
+
+// forwardNotifications sends queued notifications to the plugin until it stops, or the given
+// context is done. The error that stopped the plugin is returned.
+func (m *Module) forwardNotifications(ctx context.Context, conn *Conn, serveCh chan error) error {
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case err := <-serveCh:
+			// Put the error back, so that stopPlugin knows that Serve has returned.
+			serveCh <- err
+			return err
+		case n := <-m.notifyCh:
+			err := conn.Notify(n.method, n.params)
+			if err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// stopPlugin stops the plugin. If graceful is true, the plugin is asked to shut down and given some
+// time to exit, otherwise it's killed straight away.
+func (m *Module) stopPlugin(cmd *exec.Cmd, conn *Conn, stdin io.Closer, serveCh chan error, graceful bool) {
+	var served bool
+	if graceful {
+		// Errors don't matter here, the plugin is killed if it doesn't exit anyway.
+		_ = conn.Notify(methodShutdown, nil)
+		_ = stdin.Close()
+
+		select {
+		case <-serveCh:
+			served = true
+		case <-time.After(shutdownTimeout):
+		}
+	}
+
+	// Killing a process that has already exited is harmless.
+	_ = cmd.Process.Kill()
+	_ = stdin.Close()
+
+	if !served {
+		select {
+		case <-serveCh:
+		case <-time.After(shutdownTimeout):
+			// Something else is holding the plugin's stdout open, we can't wait for it forever.
+		}
+	}
+
+	_ = cmd.Wait()
+}
+
+// onNotification returns the handler for notifications sent by the plugin.
+func (m *Module) onNotification(ctx context.Context) NotificationHandlerFunc {
+	return func(method string, params json.RawMessage) error {
+		if method != methodRender {
+			// Ignore anything we don't know about, it may be from a newer version of the protocol.
+			return nil
+		}
+
+		var state RenderState
+
+		err := json.Unmarshal(params, &state)
+		if err != nil {
+			return fmt.Errorf("plugin: invalid render params: %v", err)
+		}
+
+		barbara.RunOnMainThread(func() {
+			if ctx.Err() == nil {
+				m.render(state)
+			}
+		})
+
+		return nil
+	}
+}
+
+// render shows the given state. It must be called on the main thread.
+func (m *Module) render(state RenderState) {
+	m.label.SetText(state.Text)
+	m.label.SetVisible(state.Text != "")
+	m.widget.SetToolTip(state.Tooltip)
+
+	if state.Icon != "" {
+		m.iconLabel.SetPixmap(m.icons.Pixmap(iconSize, state.Icon))
+	}
+
+	m.iconLabel.SetVisible(state.Icon != "")
+
+	if state.Class != "" {
+		barbara.SetClass(m.widget, state.Class)
+	} else {
+		barbara.SetClass(m.widget)
+	}
+
+	m.menu.Clear()
+	for _, item := range state.Menu {
+		if item.Separator {
+			m.menu.AddSeparator()
+			continue
+		}
+
+		action := m.menu.AddAction(item.Label)
+		action.ConnectTriggered(m.onMenuItemTriggered(item.ID))
+	}
+
+	m.hasMenu = len(state.Menu) > 0
+}
+
+// showError shows that the plugin has stopped. It must be called on the main thread.
+func (m *Module) showError(err error) {
+	m.label.SetText("!")
+	m.label.SetVisible(true)
+	m.iconLabel.SetVisible(false)
+	m.widget.SetToolTip(fmt.Sprintf("%s: %v", m.config.Path, err))
+	m.hasMenu = false
+
+	barbara.SetClass(m.widget, barbara.ClassError)
+}
+
+// onMousePress is the mouse press handler, used to send clicks to the plugin.
+func (m *Module) onMousePress(event *gui.QMouseEvent) {
+	var button string
+	switch event.Button() {
+	case core.Qt__LeftButton:
+		button = "left"
+	case core.Qt__MiddleButton:
+		button = "middle"
+	case core.Qt__RightButton:
+		button = "right"
+	default:
+		return
+	}
+
+	m.notify(methodInput, InputParams{Type: "click", Button: button})
+
+	if button == "left" {
+		m.Popup()
+	}
+}
+
+// onWheel is the mouse wheel handler, used to send scrolling to the plugin.
+func (m *Module) onWheel(event *gui.QWheelEvent) {
+	m.notify(methodInput, InputParams{Type: "scroll", Delta: event.AngleDelta().Y()})
+}
+
+// onMenuItemTriggered returns the menu item activation handler for the menu item with the given ID.
+func (m *Module) onMenuItemTriggered(id string) func(bool) {
+	return func(_ bool) {
+		m.notify(methodMenu, MenuParams{ID: id})
+	}
+}
+
+// notify queues a notification to be sent to the plugin. If the plugin isn't keeping up, the
+// notification is dropped rather than blocking the UI.
+func (m *Module) notify(method string, params interface{}) {
+	select {
+	case m.notifyCh <- notification{method: method, params: params}:
+	default:
+	}
+}
+
+// alignmentString returns the given alignment as it's sent to plugins.
+func alignmentString(alignment barbara.ModuleAlignment) string {
+	if alignment == barbara.ModuleAlignmentRight {
+		return "right"
+	}
+
+	return "left"
+}
+
+// positionString returns the given position as it's sent to plugins.
+func positionString(position barbara.WindowPosition) string {
+	if position == barbara.WindowPositionTop {
+		return "top"
+	}
+
+	return "bottom"
+}
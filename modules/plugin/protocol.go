@@ -0,0 +1,69 @@
+package plugin
+
+import "encoding/json"
+
+// Methods used in the plugin protocol. See the package documentation for more information.
+const (
+	methodInitialize = "initialize"
+	methodRender     = "render"
+	methodInput      = "input"
+	methodMenu       = "menu"
+	methodShutdown   = "shutdown"
+)
+
+// InitializeParams are the parameters of the "initialize" request sent to plugins.
+type InitializeParams struct {
+	// Config is the module's raw configuration.
+	Config json.RawMessage `json:"config"`
+	// Alignment is the alignment of the module on the bar, either "left" or "right".
+	Alignment string `json:"alignment"`
+	// Position is the position of the bar on the screen, either "top" or "bottom".
+	Position string `json:"position"`
+}
+
+// RenderState is the state of a plugin module, sent by plugins in "render" notifications. Each
+// notification replaces the whole state.
+type RenderState struct {
+	// Text is the text shown on the bar.
+	Text string `json:"text,omitempty"`
+	// Icon is an icon name from the icon theme, or an absolute path to an image.
+	Icon string `json:"icon,omitempty"`
+	// Tooltip is the text shown when hovering over the module.
+	Tooltip string `json:"tooltip,omitempty"`
+	// Class is a style class, allowing the module to be targeted in the stylesheet.
+	Class string `json:"class,omitempty"`
+	// Menu is a list of menu items. If there are any, clicking the module opens a menu.
+	Menu []MenuItem `json:"menu,omitempty"`
+}
+
+// MenuItem is a single item in a plugin module's menu.
+type MenuItem struct {
+	// ID is sent back to the plugin when this item is activated.
+	ID string `json:"id,omitempty"`
+	// Label is the text used for this menu item.
+	Label string `json:"label,omitempty"`
+	// Separator is true if this item is a separator.
+	Separator bool `json:"separator,omitempty"`
+}
+
+// InputParams are the parameters of "input" notifications sent to plugins.
+type InputParams struct {
+	// Type is the type of input, either "click" or "scroll".
+	Type string `json:"type"`
+	// Button is the button that was clicked, either "left", "middle", or "right".
+	Button string `json:"button,omitempty"`
+	// Delta is the amount scrolled. Positive values are scrolling up.
+	Delta int `json:"delta,omitempty"`
+}
+
+// MenuParams are the parameters of "menu" notifications sent to plugins.
+type MenuParams struct {
+	// ID is the ID of the menu item that was activated.
+	ID string `json:"id"`
+}
+
+// notification is a notification waiting to be sent to a plugin.
+type notification struct {
+	method string
+	params interface{}
+}
@@ -0,0 +1,193 @@
+package plugin
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sync"
+)
+
+// jsonrpcVersion is the version of JSON-RPC used to communicate with plugins.
+const jsonrpcVersion = "2.0"
+
+// JSON-RPC error codes used when responding to plugins.
+const (
+	codeMethodNotFound = -32601
+)
+
+// message is a JSON-RPC request, notification, or response.
+type message struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      *int64          `json:"id,omitempty"`
+	Method  string          `json:"method,omitempty"`
+	Params  json.RawMessage `json:"params,omitempty"`
+	Result  json.RawMessage `json:"result,omitempty"`
+	Error   *rpcError       `json:"error,omitempty"`
+}
+
+// rpcError is a JSON-RPC error object.
+type rpcError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+// Error returns a string representation of this rpcError.
+func (e *rpcError) Error() string {
+	return fmt.Sprintf("plugin error %d: %s", e.Code, e.Message)
+}
+
+// NotificationHandlerFunc is a function that handles a notification from a plugin.
+type NotificationHandlerFunc func(method string, params json.RawMessage) error
+
+// Conn is a JSON-RPC connection to a plugin, sending and receiving one message per line.
+type Conn struct {
+	enc   *json.Encoder
+	encMu sync.Mutex
+
+	scanner *bufio.Scanner
+	done    chan struct{}
+
+	nextID    int64
+	pending   map[int64]chan message
+	pendingMu sync.Mutex
+}
+
+// NewConn returns a new Conn instance, reading messages from r, and writing messages to w.
+func NewConn(r io.Reader, w io.Writer) *Conn {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+
+	return &Conn{
+		enc:     json.NewEncoder(w),
+		scanner: scanner,
+		done:    make(chan struct{}),
+		pending: make(map[int64]chan message),
+	}
+}
+
+// Call sends a request to the plugin, and waits for it's response, decoding the result into the
+// given result value. Serve must be running for responses to be received.
+func (c *Conn) Call(ctx context.Context, method string, params, result interface{}) error {
+	rawParams, err := json.Marshal(params)
+	if err != nil {
+		return err
+	}
+
+	respCh := make(chan message, 1)
+
+	c.pendingMu.Lock()
+	c.nextID++
+	id := c.nextID
+	c.pending[id] = respCh
+	c.pendingMu.Unlock()
+
+	defer func() {
+		c.pendingMu.Lock()
+		delete(c.pending, id)
+		c.pendingMu.Unlock()
+	}()
+
+	err = c.send(message{JSONRPC: jsonrpcVersion, ID: &id, Method: method, Params: rawParams})
+	if err != nil {
+		return err
+	}
+
+	var resp message
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case resp = <-respCh:
+	case <-c.done:
+		// The plugin may have responded just before it's output ended, in which case the response
+		// is already waiting.
+		select {
+		case resp = <-respCh:
+		default:
+			return fmt.Errorf("plugin: connection closed before %q returned", method)
+		}
+	}
+
+	if resp.Error != nil {
+		return resp.Error
+	}
+
+	if result == nil || len(resp.Result) == 0 {
+		return nil
+	}
+
+	return json.Unmarshal(resp.Result, result)
+}
+
+// Notify sends a notification to the plugin.
+func (c *Conn) Notify(method string, params interface{}) error {
+	rawParams, err := json.Marshal(params)
+	if err != nil {
+		return err
+	}
+
+	return c.send(message{JSONRPC: jsonrpcVersion, Method: method, Params: rawParams})
+}
+
+// Serve reads messages from the plugin until it's output ends, or it sends something invalid.
+// Notifications are passed to the given handler, and responses are passed to waiting calls. An
+// error returned by the handler stops Serve, and is returned. Serve must only be called once.
+func (c *Conn) Serve(handler NotificationHandlerFunc) error {
+	defer close(c.done)
+
+	for c.scanner.Scan() {
+		var msg message
+
+		err := json.Unmarshal(c.scanner.Bytes(), &msg)
+		if err != nil {
+			return fmt.Errorf("plugin: invalid message: %v", err)
+		}
+
+		if msg.JSONRPC != jsonrpcVersion {
+			return fmt.Errorf("plugin: unsupported JSON-RPC version %q", msg.JSONRPC)
+		}
+
+		switch {
+		case msg.Method == "" && msg.ID != nil:
+			c.pendingMu.Lock()
+			respCh, ok := c.pending[*msg.ID]
+			c.pendingMu.Unlock()
+
+			if ok {
+				respCh <- msg
+			}
+		case msg.Method != "" && msg.ID != nil:
+			// Plugins can't call methods on Barbara, only send notifications.
+			err = c.send(message{
+				JSONRPC: jsonrpcVersion,
+				ID:      msg.ID,
+				Error:   &rpcError{Code: codeMethodNotFound, Message: "method not found"},
+			})
+		case msg.Method != "":
+			err = handler(msg.Method, msg.Params)
+		default:
+			err = fmt.Errorf("plugin: invalid message: no method or id")
+		}
+
+		if err != nil {
+			return err
+		}
+	}
+
+	if err := c.scanner.Err(); err != nil {
+		return err
+	}
+
+	return io.EOF
+}
+
+// send writes a single message to the plugin.
+func (c *Conn) send(msg message) error {
+	c.encMu.Lock()
+	defer c.encMu.Unlock()
+
+	// Encode writes a trailing newline, so each message is on it's own line.
+	return c.enc.Encode(msg)
+}
@@ -0,0 +1,350 @@
+package plugin
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakePlugin is the plugin end of a Conn, connected to it by pipes.
+type fakePlugin struct {
+	scanner *bufio.Scanner
+	reader  *io.PipeReader
+	writer  *io.PipeWriter
+}
+
+// newFakePlugin returns a new Conn, and the fakePlugin at the other end of it. Serve is started,
+// and the error it returns is sent on the returned channel. The fakePlugin must be closed once the
+// test is done with it.
+func newFakePlugin(t *testing.T, handler NotificationHandlerFunc) (*Conn, *fakePlugin, <-chan error) {
+	fromConn, toPlugin := io.Pipe()
+	fromPlugin, toConn := io.Pipe()
+
+	conn := NewConn(fromPlugin, toPlugin)
+	plugin := &fakePlugin{
+		scanner: bufio.NewScanner(fromConn),
+		reader:  fromConn,
+		writer:  toConn,
+	}
+
+	if handler == nil {
+		handler = func(string, json.RawMessage) error {
+			return nil
+		}
+	}
+
+	serveErr := make(chan error, 1)
+	go func() {
+		serveErr <- conn.Serve(handler)
+	}()
+
+	return conn, plugin, serveErr
+}
+
+// read reads the next message sent to the plugin.
+func (p *fakePlugin) read(t *testing.T) message {
+	if !p.scanner.Scan() {
+		t.Errorf("expected a message, got %v", p.scanner.Err())
+		return message{}
+	}
+
+	var msg message
+
+	err := json.Unmarshal(p.scanner.Bytes(), &msg)
+	if err != nil {
+		t.Errorf("invalid message %s: %v", p.scanner.Bytes(), err)
+	}
+
+	return msg
+}
+
+// write sends the given line to the Conn, as if the plugin wrote it.
+func (p *fakePlugin) write(t *testing.T, line string) {
+	_, err := io.WriteString(p.writer, line+"\n")
+	if err != nil {
+		t.Errorf("failed to write %q: %v", line, err)
+	}
+}
+
+// close closes the plugin's end of the pipes, as if the plugin exited.
+func (p *fakePlugin) close() {
+	p.writer.Close()
+	p.reader.Close()
+}
+
+// waitFor returns the value sent on the given channel, failing the test if it takes too long.
+func waitFor(t *testing.T, ch <-chan error) error {
+	t.Helper()
+
+	select {
+	case err := <-ch:
+		return err
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out")
+		return nil
+	}
+}
+
+func TestConn_Call(t *testing.T) {
+	tests := []struct {
+		name     string
+		reply    string
+		expected interface{}
+		err      error
+	}{
+		{
+			name:     "result",
+			reply:    `{"jsonrpc":"2.0","id":1,"result":{"text":"hello"}}`,
+			expected: RenderState{Text: "hello"},
+		},
+		{
+			name:     "no result",
+			reply:    `{"jsonrpc":"2.0","id":1}`,
+			expected: RenderState{},
+		},
+		{
+			name:  "error",
+			reply: `{"jsonrpc":"2.0","id":1,"error":{"code":-32000,"message":"not ready"}}`,
+			err:   &rpcError{Code: -32000, Message: "not ready"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			conn, plugin, _ := newFakePlugin(t, nil)
+			defer plugin.close()
+
+			go func() {
+				request := plugin.read(t)
+				if request.Method != methodInitialize || request.ID == nil || *request.ID != 1 {
+					t.Errorf("unexpected request %+v", request)
+				}
+
+				if string(request.Params) != `{"config":null,"alignment":"left","position":"top"}` {
+					t.Errorf("unexpected params %s", request.Params)
+				}
+
+				plugin.write(t, test.reply)
+			}()
+
+			var result RenderState
+
+			err := conn.Call(context.Background(), methodInitialize, InitializeParams{Alignment: "left", Position: "top"}, &result)
+			if !reflect.DeepEqual(err, test.err) {
+				t.Fatalf("expected error %v, got %v", test.err, err)
+			}
+
+			if test.err == nil && !reflect.DeepEqual(result, test.expected) {
+				t.Errorf("expected %+v, got %+v", test.expected, result)
+			}
+		})
+	}
+}
+
+func TestConn_Call_ID(t *testing.T) {
+	conn, plugin, _ := newFakePlugin(t, nil)
+	defer plugin.close()
+
+	methods := []string{methodInput, methodMenu, methodRender}
+	results := make(chan error, len(methods))
+
+	for _, method := range methods {
+		method := method
+
+		go func() {
+			var result string
+
+			err := conn.Call(context.Background(), method, nil, &result)
+			if err == nil && result != method {
+				err = errors.New("expected the result of " + method + ", got the result of " + result)
+			}
+
+			results <- err
+		}()
+	}
+
+	requests := make([]message, len(methods))
+	for i := range requests {
+		requests[i] = plugin.read(t)
+	}
+
+	// Responses can come in any order, and each is matched to it's call by it's id. Responses to
+	// calls that aren't waiting are ignored.
+	plugin.write(t, `{"jsonrpc":"2.0","id":1000,"result":"unknown"}`)
+
+	for i := len(requests) - 1; i >= 0; i-- {
+		result, err := json.Marshal(requests[i].Method)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		id, err := json.Marshal(requests[i].ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		plugin.write(t, `{"jsonrpc":"2.0","id":`+string(id)+`,"result":`+string(result)+`}`)
+	}
+
+	for range methods {
+		if err := waitFor(t, results); err != nil {
+			t.Error(err)
+		}
+	}
+}
+
+func TestConn_Call_Cancelled(t *testing.T) {
+	conn, plugin, _ := newFakePlugin(t, nil)
+	defer plugin.close()
+
+	ctx, cfn := context.WithCancel(context.Background())
+
+	go func() {
+		// The plugin receives the request, but never responds.
+		plugin.read(t)
+		cfn()
+	}()
+
+	err := conn.Call(ctx, methodShutdown, nil, nil)
+	if err != context.Canceled {
+		t.Errorf("expected %v, got %v", context.Canceled, err)
+	}
+
+	conn.pendingMu.Lock()
+	defer conn.pendingMu.Unlock()
+
+	if len(conn.pending) != 0 {
+		t.Errorf("expected no pending calls, got %d", len(conn.pending))
+	}
+}
+
+func TestConn_Call_Closed(t *testing.T) {
+	tests := []struct {
+		name  string
+		reply string
+		err   bool
+	}{
+		{"without responding", "", true},
+		{"after responding", `{"jsonrpc":"2.0","id":1,"result":null}`, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			conn, plugin, serveErr := newFakePlugin(t, nil)
+			defer plugin.close()
+
+			go func() {
+				plugin.read(t)
+
+				if test.reply != "" {
+					plugin.write(t, test.reply)
+				}
+
+				plugin.close()
+			}()
+
+			err := conn.Call(context.Background(), methodShutdown, nil, nil)
+			if test.err && err == nil {
+				t.Error("expected an error")
+			}
+
+			if !test.err && err != nil {
+				t.Error(err)
+			}
+
+			if err := waitFor(t, serveErr); err != io.EOF {
+				t.Errorf("expected Serve to return %v, got %v", io.EOF, err)
+			}
+		})
+	}
+}
+
+func TestConn_Serve(t *testing.T) {
+	type notification struct {
+		method string
+		params string
+	}
+
+	notifications := make(chan notification, 2)
+	handlerErr := errors.New("invalid render state")
+
+	conn, plugin, serveErr := newFakePlugin(t, func(method string, params json.RawMessage) error {
+		notifications <- notification{method: method, params: string(params)}
+
+		if method == "fail" {
+			return handlerErr
+		}
+
+		return nil
+	})
+	defer plugin.close()
+
+	plugin.write(t, `{"jsonrpc":"2.0","method":"render","params":{"text":"hello"}}`)
+
+	// Plugins can't call methods on Barbara, so requests get an error response.
+	plugin.write(t, `{"jsonrpc":"2.0","id":7,"method":"render"}`)
+
+	response := plugin.read(t)
+	if response.ID == nil || *response.ID != 7 || response.Error == nil || response.Error.Code != codeMethodNotFound {
+		t.Errorf("expected a method not found response, got %+v", response)
+	}
+
+	plugin.write(t, `{"jsonrpc":"2.0","method":"fail"}`)
+
+	expected := []notification{
+		{method: methodRender, params: `{"text":"hello"}`},
+		{method: "fail"},
+	}
+
+	for _, notification := range expected {
+		if actual := <-notifications; actual != notification {
+			t.Errorf("expected %+v, got %+v", notification, actual)
+		}
+	}
+
+	// An error from the handler stops Serve, and is returned.
+	if err := waitFor(t, serveErr); err != handlerErr {
+		t.Errorf("expected %v, got %v", handlerErr, err)
+	}
+
+	// Calls made after Serve has stopped don't wait forever.
+	go plugin.read(t)
+
+	err := conn.Call(context.Background(), methodShutdown, nil, nil)
+	if err == nil {
+		t.Error("expected an error")
+	}
+}
+
+func TestConn_Serve_Invalid(t *testing.T) {
+	tests := []struct {
+		name    string
+		message string
+		err     string
+	}{
+		{"not json", `hello`, "plugin: invalid message: "},
+		{"wrong version", `{"jsonrpc":"1.0","method":"render"}`, "plugin: unsupported JSON-RPC version "},
+		{"missing version", `{"method":"render"}`, "plugin: unsupported JSON-RPC version "},
+		{"no method or id", `{"jsonrpc":"2.0"}`, "plugin: invalid message: no method or id"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, plugin, serveErr := newFakePlugin(t, nil)
+			defer plugin.close()
+
+			plugin.write(t, test.message)
+
+			err := waitFor(t, serveErr)
+			if err == nil || !strings.HasPrefix(err.Error(), test.err) {
+				t.Errorf("expected an error starting with %q, got %v", test.err, err)
+			}
+		})
+	}
+}
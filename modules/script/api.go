@@ -0,0 +1,264 @@
+package script
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"go.starlark.net/starlark"
+)
+
+// readablePaths are the directories that scripts are allowed to read files from.
+var readablePaths = []string{"/proc", "/sys"}
+
+// maxExecutionSteps limits how much work a single call into a script may do, so that a script with
+// an infinite loop can't hang the module forever.
+const maxExecutionSteps = 10000000
+
+// stateKey is the thread-local key that the State being built by a script is stored under.
+const stateKey = "barbara.state"
+
+// State is the state of a script module, as set by the script.
+type State struct {
+	// Label is the text shown on the bar.
+	Label string
+	// Icon is an icon name from the icon theme, or an absolute path to an image.
+	Icon string
+	// Class is a style class, allowing the module to be targeted in the stylesheet.
+	Class string
+}
+
+// API is the sandboxed API available to scripts. Scripts can't access anything other than what is
+// provided here, and Starlark's built-in functions.
+type API struct {
+	commands       map[string]bool
+	commandTimeout time.Duration
+}
+
+// NewAPI returns a new API instance. Scripts will be able to run the given commands, which will be
+// killed if they run for longer than the given timeout.
+func NewAPI(commands []string, commandTimeout time.Duration) *API {
+	allowed := make(map[string]bool, len(commands))
+	for _, command := range commands {
+		allowed[command] = true
+	}
+
+	return &API{
+		commands:       allowed,
+		commandTimeout: commandTimeout,
+	}
+}
+
+// Predeclared returns the functions available to scripts.
+func (a *API) Predeclared() starlark.StringDict {
+	return starlark.StringDict{
+		"read_file":       starlark.NewBuiltin("read_file", a.readFile),
+		"run":             starlark.NewBuiltin("run", a.run),
+		"format_duration": starlark.NewBuiltin("format_duration", a.formatDuration),
+		"format_bytes":    starlark.NewBuiltin("format_bytes", a.formatBytes),
+		"set_label":       starlark.NewBuiltin("set_label", a.setter(func(s *State, v string) { s.Label = v })),
+		"set_icon":        starlark.NewBuiltin("set_icon", a.setter(func(s *State, v string) { s.Icon = v })),
+		"set_class":       starlark.NewBuiltin("set_class", a.setter(func(s *State, v string) { s.Class = v })),
+	}
+}
+
+// NewThread returns a new Starlark thread for running a script that will update the given State.
+// The thread can't load other modules, and is limited in how much work it can do.
+func (a *API) NewThread(name string, state *State, print func(msg string)) *starlark.Thread {
+	thread := &starlark.Thread{
+		Name: name,
+		Print: func(_ *starlark.Thread, msg string) {
+			print(msg)
+		},
+	}
+
+	thread.SetLocal(stateKey, state)
+	thread.SetMaxExecutionSteps(maxExecutionSteps)
+
+	return thread
+}
+
+// readFile implements read_file(path), which returns the contents of a file under /proc or /sys.
+func (a *API) readFile(
+	thread *starlark.Thread,
+	b *starlark.Builtin,
+	args starlark.Tuple,
+	kwargs []starlark.Tuple,
+) (starlark.Value, error) {
+	var path string
+
+	err := starlark.UnpackPositionalArgs(b.Name(), args, kwargs, 1, &path)
+	if err != nil {
+		return nil, err
+	}
+
+	// Resolve symlinks first, so that a symlink can't be used to escape the readable paths. Lots
+	// of things in /sys are symlinks, but they all point to somewhere else in /sys.
+	resolved, err := filepath.EvalSymlinks(filepath.Clean(path))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", b.Name(), err)
+	}
+
+	if !isReadable(resolved) {
+		return nil, fmt.Errorf("%s: %q is not under %s", b.Name(), path, strings.Join(readablePaths, " or "))
+	}
+
+	bs, err := ioutil.ReadFile(resolved)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", b.Name(), err)
+	}
+
+	return starlark.String(bs), nil
+}
+
+// run implements run(command, *args), which runs an allowed command, returning it's output.
+func (a *API) run(
+	thread *starlark.Thread,
+	b *starlark.Builtin,
+	args starlark.Tuple,
+	kwargs []starlark.Tuple,
+) (starlark.Value, error) {
+	if len(kwargs) > 0 {
+		return nil, fmt.Errorf("%s: unexpected keyword arguments", b.Name())
+	}
+
+	if len(args) == 0 {
+		return nil, fmt.Errorf("%s: missing command", b.Name())
+	}
+
+	strArgs := make([]string, 0, len(args))
+	for i, arg := range args {
+		str, ok := starlark.AsString(arg)
+		if !ok {
+			return nil, fmt.Errorf("%s: argument %d is not a string", b.Name(), i+1)
+		}
+
+		strArgs = append(strArgs, str)
+	}
+
+	if !a.commands[strArgs[0]] {
+		return nil, fmt.Errorf("%s: command %q is not allowed", b.Name(), strArgs[0])
+	}
+
+	ctx, cfn := context.WithTimeout(context.Background(), a.commandTimeout)
+	defer cfn()
+
+	var stdout bytes.Buffer
+
+	cmd := exec.CommandContext(ctx, strArgs[0], strArgs[1:]...)
+	cmd.Stdout = &stdout
+
+	err := cmd.Run()
+	if err != nil {
+		return nil, fmt.Errorf("%s: %q: %v", b.Name(), strArgs[0], err)
+	}
+
+	return starlark.String(stdout.String()), nil
+}
+
+// formatDuration implements format_duration(seconds), which formats a number of seconds as hours
+// and minutes, e.g. "01:30".
+func (a *API) formatDuration(
+	thread *starlark.Thread,
+	b *starlark.Builtin,
+	args starlark.Tuple,
+	kwargs []starlark.Tuple,
+) (starlark.Value, error) {
+	var seconds starlark.Value
+
+	err := starlark.UnpackPositionalArgs(b.Name(), args, kwargs, 1, &seconds)
+	if err != nil {
+		return nil, err
+	}
+
+	f, ok := starlark.AsFloat(seconds)
+	if !ok {
+		return nil, fmt.Errorf("%s: got %s, want number", b.Name(), seconds.Type())
+	}
+
+	minutes := int(f) / 60
+
+	return starlark.String(fmt.Sprintf("%02d:%02d", minutes/60, minutes%60)), nil
+}
+
+// formatBytes implements format_bytes(n), which formats a number of bytes using binary units, e.g.
+// "1.5 GiB".
+func (a *API) formatBytes(
+	thread *starlark.Thread,
+	b *starlark.Builtin,
+	args starlark.Tuple,
+	kwargs []starlark.Tuple,
+) (starlark.Value, error) {
+	var n starlark.Value
+
+	err := starlark.UnpackPositionalArgs(b.Name(), args, kwargs, 1, &n)
+	if err != nil {
+		return nil, err
+	}
+
+	f, ok := starlark.AsFloat(n)
+	if !ok {
+		return nil, fmt.Errorf("%s: got %s, want number", b.Name(), n.Type())
+	}
+
+	units := []string{"B", "KiB", "MiB", "GiB", "TiB"}
+
+	var unit int
+	for f >= 1024 && unit < len(units)-1 {
+		f /= 1024
+		unit++
+	}
+
+	if unit == 0 {
+		return starlark.String(fmt.Sprintf("%.0f %s", f, units[unit])), nil
+	}
+
+	return starlark.String(fmt.Sprintf("%.1f %s", f, units[unit])), nil
+}
+
+// setter returns the implementation of a function that sets a single string field of the State.
+func (a *API) setter(set func(state *State, value string)) func(
+	thread *starlark.Thread,
+	b *starlark.Builtin,
+	args starlark.Tuple,
+	kwargs []starlark.Tuple,
+) (starlark.Value, error) {
+	return func(
+		thread *starlark.Thread,
+		b *starlark.Builtin,
+		args starlark.Tuple,
+		kwargs []starlark.Tuple,
+	) (starlark.Value, error) {
+		var value string
+
+		err := starlark.UnpackPositionalArgs(b.Name(), args, kwargs, 1, &value)
+		if err != nil {
+			return nil, err
+		}
+
+		state, ok := thread.Local(stateKey).(*State)
+		if !ok {
+			return nil, fmt.Errorf("%s: can't be called here", b.Name())
+		}
+
+		set(state, value)
+
+		return starlark.None, nil
+	}
+}
+
+// isReadable returns true if the given path is inside one of the readable paths.
+func isReadable(path string) bool {
+	for _, readablePath := range readablePaths {
+		if path == readablePath || strings.HasPrefix(path, readablePath+"/") {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,16 @@
+package script
+
+import "github.com/seeruk/barbara/barbara"
+
+// Config holds all script module configuration.
+type Config struct {
+	// Path is the path to the Starlark script file.
+	Path string `json:"path"`
+	// Interval is how often the script's update function is called. Defaults to 5 seconds.
+	Interval barbara.Duration `json:"interval"`
+	// Commands is the list of commands the script is allowed to run. Commands not in this list
+	// can't be run by the script at all.
+	Commands []string `json:"commands"`
+	// CommandTimeout is how long a command run by the script may run for. Defaults to 5 seconds.
+	CommandTimeout barbara.Duration `json:"command_timeout"`
+}
@@ -0,0 +1,227 @@
+package script
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/seeruk/barbara/barbara"
+	"github.com/seeruk/barbara/icon"
+	"github.com/therecipe/qt/core"
+	"github.com/therecipe/qt/widgets"
+	"go.starlark.net/starlark"
+)
+
+const (
+	// defaultInterval is the interval used if no interval is configured.
+	defaultInterval = 5 * time.Second
+	// defaultCommandTimeout is the command timeout used if no command timeout is configured.
+	defaultCommandTimeout = 5 * time.Second
+	// updateFunctionName is the name of the function in a script that's called on each interval.
+	updateFunctionName = "update"
+	// iconSize is the size of the icon shown next to the script's label, in pixels.
+	iconSize = 24
+)
+
+// Module is a Barbara Module that is implemented by a Starlark script. The script is run in a
+// sandbox, and it's update function is called on an interval to update what's shown on the bar.
+type Module struct {
+	ctx context.Context
+	cfn context.CancelFunc
+
+	api    *API
+	config Config
+	icons  *icon.Loader
+
+	layout    *widgets.QHBoxLayout
+	iconLabel *widgets.QLabel
+	label     *widgets.QLabel
+}
+
+// NewModuleConstructor returns a barbara.ModuleConstructorFunc that creates script modules that
+// find their icons using the given icon.Loader.
+func NewModuleConstructor(icons *icon.Loader) barbara.ModuleConstructorFunc {
+	return func(mctx barbara.ModuleContext) (barbara.Module, error) {
+		return NewModule(mctx, icons)
+	}
+}
+
+// NewModule returns a new script Module instance.
+func NewModule(mctx barbara.ModuleContext, icons *icon.Loader) (barbara.Module, error) {
+	var config Config
+
+	err := json.Unmarshal(mctx.Config, &config)
+	if err != nil {
+		// TODO(elliot): More context.
+		return nil, err
+	}
+
+	if config.Path == "" {
+		return nil, fmt.Errorf("script: a path must be configured")
+	}
+
+	if config.Interval <= 0 {
+		config.Interval = barbara.Duration(defaultInterval)
+	}
+
+	if config.CommandTimeout <= 0 {
+		config.CommandTimeout = barbara.Duration(defaultCommandTimeout)
+	}
+
+	return &Module{
+		api:    NewAPI(config.Commands, config.CommandTimeout.Duration()),
+		config: config,
+		icons:  icons,
+	}, nil
+}
+
+// Render starts a background process that runs the script, and returns a layout containing the
+// widgets that will show the script's state, ready to be placed on a bar.
+func (m *Module) Render() (widgets.QLayout_ITF, error) {
+	m.layout = widgets.NewQHBoxLayout()
+
+	m.iconLabel = widgets.NewQLabel(nil, core.Qt__Widget)
+	m.iconLabel.SetVisible(false)
+
+	m.label = widgets.NewQLabel(nil, core.Qt__Widget)
+	m.label.SetAlignment(core.Qt__AlignCenter)
+
+	m.ctx, m.cfn = context.WithCancel(context.Background())
+
+	go m.run(m.ctx)
+
+	m.layout.AddWidget(m.iconLabel, 0, core.Qt__AlignJustify)
+	m.layout.AddWidget(m.label, 0, core.Qt__AlignJustify)
+
+	return m.layout, nil
+}
+
+// Destroy stops background processes and frees up resources.
+func (m *Module) Destroy() error {
+	if m.cfn != nil {
+		m.cfn()
+	}
+
+	if m.layout != nil {
+		m.layout.DestroyQHBoxLayout()
+	}
+
+	if m.iconLabel != nil {
+		m.iconLabel.Destroy(true, true)
+	}
+
+	if m.label != nil {
+		m.label.Destroy(true, true)
+	}
+
+	m.ctx = nil
+	m.cfn = nil
+	m.layout = nil
+	m.iconLabel = nil
+	m.label = nil
+
+	return nil
+}
+
+// run loads the script, and calls it's update function immediately, and then again every interval,
+// until the given context is done. If the script fails to load, it's loaded again on the next
+// interval, so that fixing a script doesn't require restarting Barbara.
+func (m *Module) run(ctx context.Context) {
+	ticker := time.NewTicker(m.config.Interval.Duration())
+	defer ticker.Stop()
+
+	var update starlark.Callable
+
+	for {
+		var state State
+		var err error
+
+		if update == nil {
+			update, err = m.load(&state)
+		}
+
+		if err == nil {
+			thread := m.api.NewThread(m.config.Path, &state, m.print)
+			_, err = starlark.Call(thread, update, nil, nil)
+		}
+
+		barbara.RunOnMainThread(func() {
+			if ctx.Err() != nil {
+				// The module has been destroyed.
+				return
+			}
+
+			if err != nil {
+				m.showError(err)
+			} else {
+				m.render(state)
+			}
+		})
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// load runs the script file, returning it's update function. The top level of the script may also
+// update the given State.
+func (m *Module) load(state *State) (starlark.Callable, error) {
+	thread := m.api.NewThread(m.config.Path, state, m.print)
+
+	globals, err := starlark.ExecFile(thread, m.config.Path, nil, m.api.Predeclared())
+	if err != nil {
+		return nil, err
+	}
+
+	update, ok := globals[updateFunctionName].(starlark.Callable)
+	if !ok {
+		return nil, fmt.Errorf("%s: no %s() function defined", m.config.Path, updateFunctionName)
+	}
+
+	return update, nil
+}
+
+// print handles the script's print calls, logging the message.
+func (m *Module) print(msg string) {
+	log.Printf("%s: %s\n", m.config.Path, msg)
+}
+
+// render shows the given state. It must be called on the main thread.
+func (m *Module) render(state State) {
+	m.label.SetText(state.Label)
+	m.label.SetToolTip("")
+	m.label.SetVisible(state.Label != "")
+
+	if state.Icon != "" {
+		m.iconLabel.SetPixmap(m.icons.Pixmap(iconSize, state.Icon))
+	}
+
+	m.iconLabel.SetVisible(state.Icon != "")
+
+	if state.Class != "" {
+		barbara.SetClass(m.label, state.Class)
+	} else {
+		barbara.SetClass(m.label)
+	}
+}
+
+// showError shows the given script error in the module's slot. It must be called on the main
+// thread.
+func (m *Module) showError(err error) {
+	msg := err.Error()
+	if evalErr, ok := err.(*starlark.EvalError); ok {
+		msg = evalErr.Backtrace()
+	}
+
+	m.label.SetText("script error")
+	m.label.SetToolTip(msg)
+	m.label.SetVisible(true)
+	m.iconLabel.SetVisible(false)
+
+	barbara.SetClass(m.label, barbara.ClassError)
+}
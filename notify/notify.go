@@ -0,0 +1,187 @@
+// Package notify sends desktop notifications using the org.freedesktop.Notifications D-Bus API,
+// which is implemented by notification daemons like dunst, mako, and most desktop environments.
+package notify
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/godbus/dbus"
+)
+
+const (
+	// busName is the well-known name of the notification daemon.
+	busName = "org.freedesktop.Notifications"
+	// objectPath is the path of the notification daemon's object.
+	objectPath = "/org/freedesktop/Notifications"
+	// appName is the application name that notifications are sent with.
+	appName = "Barbara"
+)
+
+// Urgency is the urgency level of a notification. Notification daemons may show notifications
+// differently depending on their urgency, e.g. critical notifications may not time out.
+type Urgency byte
+
+const (
+	// UrgencyLow is the urgency level used for unimportant notifications.
+	UrgencyLow Urgency = iota
+	// UrgencyNormal is the default urgency level.
+	UrgencyNormal
+	// UrgencyCritical is the urgency level used for notifications that need attention.
+	UrgencyCritical
+)
+
+// Action is a button shown on a notification. When it's clicked, the notification daemon emits the
+// action's key.
+type Action struct {
+	Key   string
+	Label string
+}
+
+// Notification is a desktop notification.
+type Notification struct {
+	// ReplacesID is the ID of an existing notification to replace, or 0 to show a new one.
+	ReplacesID uint32
+	// Icon is the name of an icon in the icon theme, or a path to an icon.
+	Icon    string
+	Summary string
+	Body    string
+	Actions []Action
+	Urgency Urgency
+	// Timeout is how long the notification is shown for. If it's 0, the notification daemon decides.
+	// If it's negative, the notification is shown until it's closed.
+	Timeout time.Duration
+}
+
+// Notifier sends notifications to the notification daemon.
+type Notifier struct {
+	conn *dbus.Conn
+}
+
+// NewNotifier returns a new Notifier instance, sending notifications over the given connection,
+// which should be a session bus connection.
+func NewNotifier(conn *dbus.Conn) *Notifier {
+	return &Notifier{
+		conn: conn,
+	}
+}
+
+// Notify shows the given notification, returning it's ID. The ID can be used to replace or close
+// the notification later, or to wait for one of it's actions to be invoked.
+func (n *Notifier) Notify(notification Notification) (uint32, error) {
+	actions := make([]string, 0, len(notification.Actions)*2)
+	for _, action := range notification.Actions {
+		actions = append(actions, action.Key, action.Label)
+	}
+
+	hints := map[string]dbus.Variant{
+		"urgency": dbus.MakeVariant(byte(notification.Urgency)),
+	}
+
+	timeout := int32(-1)
+	switch {
+	case notification.Timeout < 0:
+		timeout = 0
+	case notification.Timeout > 0:
+		timeout = int32(notification.Timeout / time.Millisecond)
+	}
+
+	var id uint32
+
+	err := n.object().Call(busName+".Notify", 0,
+		appName,
+		notification.ReplacesID,
+		notification.Icon,
+		notification.Summary,
+		notification.Body,
+		actions,
+		hints,
+		timeout,
+	).Store(&id)
+
+	if err != nil {
+		return 0, fmt.Errorf("notify: failed to send notification: %v", err)
+	}
+
+	return id, nil
+}
+
+// Close closes the notification with the given ID.
+func (n *Notifier) Close(id uint32) error {
+	err := n.object().Call(busName+".CloseNotification", 0, id).Err
+	if err != nil {
+		return fmt.Errorf("notify: failed to close notification: %v", err)
+	}
+
+	return nil
+}
+
+// Subscribe starts listening for the actions of notifications being invoked, and notifications
+// being closed. Subscribe before sending a notification that has actions, otherwise the action may
+// be invoked before we're listening for it. The Subscription should be closed once it's done with.
+func (n *Notifier) Subscribe() (*Subscription, error) {
+	rule := fmt.Sprintf("type='signal',interface='%s'", busName)
+
+	err := n.conn.BusObject().Call("org.freedesktop.DBus.AddMatch", 0, rule).Err
+	if err != nil {
+		return nil, fmt.Errorf("notify: failed to listen for actions: %v", err)
+	}
+
+	signals := make(chan *dbus.Signal, 16)
+
+	n.conn.Signal(signals)
+
+	return &Subscription{
+		conn:    n.conn,
+		rule:    rule,
+		signals: signals,
+	}, nil
+}
+
+// object returns the notification daemon's object.
+func (n *Notifier) object() dbus.BusObject {
+	return n.conn.Object(busName, objectPath)
+}
+
+// Subscription receives signals from the notification daemon, so that the actions of notifications
+// can be waited for. It's created using Notifier.Subscribe.
+type Subscription struct {
+	conn    *dbus.Conn
+	rule    string
+	signals chan *dbus.Signal
+}
+
+// WaitAction blocks until one of the actions of the notification with the given ID is invoked,
+// returning the action's key. If the notification is closed without an action being invoked, an
+// empty key is returned. If the given context is cancelled, it's error is returned.
+func (s *Subscription) WaitAction(ctx context.Context, id uint32) (string, error) {
+	for {
+		select {
+		case <-ctx.Done():
+			return "", ctx.Err()
+		case signal := <-s.signals:
+			if signal.Path != objectPath || len(signal.Body) < 2 {
+				continue
+			}
+
+			if signalID, ok := signal.Body[0].(uint32); !ok || signalID != id {
+				continue
+			}
+
+			switch signal.Name {
+			case busName + ".ActionInvoked":
+				key, _ := signal.Body[1].(string)
+				return key, nil
+			case busName + ".NotificationClosed":
+				return "", nil
+			}
+		}
+	}
+}
+
+// Close stops listening for signals from the notification daemon.
+func (s *Subscription) Close() {
+	s.conn.RemoveSignal(s.signals)
+	s.conn.BusObject().Call("org.freedesktop.DBus.RemoveMatch", 0, s.rule)
+}
@@ -0,0 +1,13 @@
+#!/usr/bin/env bash
+
+set -e
+
+scriptDir=$(dirname $0)
+
+pushd "$scriptDir/.." > /dev/null || exit 1
+
+    # Golden images are rendered offscreen, so this works without a display server. Check the
+    # images written to each package's testdata directory before committing them.
+    BARBARA_UPDATE_GOLDEN=1 go test -count=1 -run 'Golden' ./modules/battery ./modules/clock ./modules/menu
+
+popd > /dev/null || exit 1